@@ -0,0 +1,38 @@
+// Command bootstrap-admin creates the first portal operator account from the environment.
+//
+//	PORTAL_ADMIN_EMAIL=admin@example.com PORTAL_ADMIN_PASSWORD=... go run ./cmd/bootstrap-admin
+//
+// It does nothing when a portal account already exists, so it can run on every deployment.
+package main
+
+import (
+	"log"
+	"os"
+
+	"self-service-portal/internal/config"
+	"self-service-portal/internal/database"
+)
+
+func main() {
+	email := os.Getenv("PORTAL_ADMIN_EMAIL")
+	password := os.Getenv("PORTAL_ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Fatal("❌ PORTAL_ADMIN_EMAIL and PORTAL_ADMIN_PASSWORD must be set")
+	}
+
+	cfg := config.Load()
+	db, err := database.Initialize(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize database: %v", err)
+	}
+
+	user, created, err := database.BootstrapAdmin(db, email, password, os.Getenv("PORTAL_ADMIN_FIRST_NAME"), os.Getenv("PORTAL_ADMIN_LAST_NAME"))
+	if err != nil {
+		log.Fatalf("❌ Failed to create portal admin: %v", err)
+	}
+	if !created {
+		log.Println("ℹ️ Portal accounts already exist, nothing to do")
+		return
+	}
+	log.Printf("✅ Portal admin %s created", user.Email)
+}
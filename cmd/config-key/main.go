@@ -0,0 +1,79 @@
+// Command config-key manages the master key that encrypts secrets in portal-config.json.
+//
+//	go run ./cmd/config-key generate   # print a new key for PORTAL_CONFIG_KEY
+//	go run ./cmd/config-key rotate     # switch to a new key and re-encrypt all secrets
+//	go run ./cmd/config-key retire     # drop previous keys from the keyfile once rotated
+//
+// With PORTAL_CONFIG_KEY set, rotate only re-encrypts: put the new key in PORTAL_CONFIG_KEY
+// and the old one in PORTAL_CONFIG_PREVIOUS_KEYS first, then remove the old key afterwards.
+// Otherwise the keyfile (PORTAL_CONFIG_KEYFILE, default portal-config.key) is updated in place.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"self-service-portal/internal/config"
+	"self-service-portal/internal/handlers"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("❌ Usage: config-key generate|rotate|retire")
+	}
+
+	switch os.Args[1] {
+	case "generate":
+		key, err := config.GenerateMasterKey()
+		if err != nil {
+			log.Fatalf("❌ Failed to generate key: %v", err)
+		}
+		fmt.Println(key)
+
+	case "rotate":
+		if os.Getenv(config.MasterKeyEnv) == "" {
+			path := config.MasterKeyFilePath()
+			keys, err := config.ReadMasterKeyFile(path)
+			if err != nil {
+				log.Fatalf("❌ Failed to read keyfile: %v", err)
+			}
+			key, err := config.GenerateMasterKey()
+			if err != nil {
+				log.Fatalf("❌ Failed to generate key: %v", err)
+			}
+			if err := config.WriteMasterKeyFile(path, append([]string{key}, keys...)); err != nil {
+				log.Fatalf("❌ Failed to update keyfile: %v", err)
+			}
+			log.Printf("🔑 Added new master key to %s", path)
+		}
+		reencrypt()
+
+	case "retire":
+		reencrypt()
+		if os.Getenv(config.MasterKeyEnv) != "" {
+			log.Printf("ℹ️ Remove %s from the environment to retire previous keys", config.PreviousKeysEnv)
+			return
+		}
+		path := config.MasterKeyFilePath()
+		keys, err := config.ReadMasterKeyFile(path)
+		if err != nil {
+			log.Fatalf("❌ Failed to read keyfile: %v", err)
+		}
+		if err := config.WriteMasterKeyFile(path, keys[:1]); err != nil {
+			log.Fatalf("❌ Failed to update keyfile: %v", err)
+		}
+		log.Printf("🗑️ Retired %d previous master key(s) from %s", len(keys)-1, path)
+
+	default:
+		log.Fatalf("❌ Unknown command %q, expected generate, rotate or retire", os.Args[1])
+	}
+}
+
+// reencrypt rewrites the portal configuration with every secret under the current key
+func reencrypt() {
+	if err := handlers.NewConfigHandler().ReencryptSecrets(); err != nil {
+		log.Fatalf("❌ Failed to re-encrypt configuration secrets: %v", err)
+	}
+	log.Println("✅ Configuration secrets encrypted with the current master key")
+}
@@ -0,0 +1,255 @@
+// Command mock-idp is a minimal OpenID Connect provider for testing portal single sign-on locally.
+// It signs in every request as the configured user without asking for credentials.
+//
+//	MOCK_IDP_EMAIL=helpdesk@example.com MOCK_IDP_GROUPS=portal-helpdesk go run ./cmd/mock-idp
+//
+// Point the portal's SSO settings at it with issuer_url http://localhost:9000, client_id
+// portal and redirect_url http://localhost:8080/auth/oidc/callback. The login_hint query
+// parameter overrides the email for a single login.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// authorization is an issued authorization code waiting to be exchanged
+type authorization struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	Email         string
+	ExpiresAt     time.Time
+}
+
+type mockIDP struct {
+	issuer   string
+	clientID string
+	secret   string
+	email    string
+	groups   []string
+	key      *rsa.PrivateKey
+	keyID    string
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+func main() {
+	addr := getEnv("MOCK_IDP_ADDR", ":9000")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("❌ Failed to generate signing key: %v", err)
+	}
+
+	idp := &mockIDP{
+		issuer:   strings.TrimRight(getEnv("MOCK_IDP_ISSUER", "http://localhost:9000"), "/"),
+		clientID: getEnv("MOCK_IDP_CLIENT_ID", "portal"),
+		secret:   os.Getenv("MOCK_IDP_CLIENT_SECRET"),
+		email:    getEnv("MOCK_IDP_EMAIL", "admin@example.com"),
+		groups:   splitList(getEnv("MOCK_IDP_GROUPS", "portal-admins")),
+		key:      key,
+		keyID:    randomString(8),
+		codes:    make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+
+	log.Printf("🧪 Mock OIDC provider %s listening on %s (user %s, groups %v)", idp.issuer, addr, idp.email, idp.groups)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+func (idp *mockIDP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                idp.issuer,
+		"authorization_endpoint":                idp.issuer + "/authorize",
+		"token_endpoint":                        idp.issuer + "/token",
+		"jwks_uri":                              idp.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email", "groups"},
+	})
+}
+
+func (idp *mockIDP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != idp.clientID || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString(24)
+	auth := authorization{
+		ClientID:      q.Get("client_id"),
+		RedirectURI:   q.Get("redirect_uri"),
+		CodeChallenge: q.Get("code_challenge"),
+		Nonce:         q.Get("nonce"),
+		Email:         getFirst(q.Get("login_hint"), idp.email),
+		ExpiresAt:     time.Now().Add(time.Minute),
+	}
+	idp.mu.Lock()
+	idp.codes[code] = auth
+	idp.mu.Unlock()
+
+	values := redirectURI.Query()
+	values.Set("code", code)
+	values.Set("state", q.Get("state"))
+	redirectURI.RawQuery = values.Encode()
+	log.Printf("🧪 Issued authorization code for %s", auth.Email)
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (idp *mockIDP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if clientID != idp.clientID || (idp.secret != "" && secret != idp.secret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	auth, found := idp.codes[r.Form.Get("code")]
+	delete(idp.codes, r.Form.Get("code"))
+	idp.mu.Unlock()
+
+	if !found || time.Now().After(auth.ExpiresAt) || auth.ClientID != clientID || auth.RedirectURI != r.Form.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.CodeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	name := strings.SplitN(auth.Email, "@", 2)[0]
+	claims := map[string]interface{}{
+		"iss":            idp.issuer,
+		"sub":            "mock-" + auth.Email,
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(10 * time.Minute).Unix(),
+		"nonce":          auth.Nonce,
+		"email":          auth.Email,
+		"email_verified": true,
+		"given_name":     name,
+		"family_name":    "Mock",
+		"groups":         idp.groups,
+	}
+
+	idToken, err := idp.sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(24),
+		"token_type":   "Bearer",
+		"expires_in":   600,
+		"id_token":     idToken,
+	})
+}
+
+func (idp *mockIDP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &idp.key.PublicKey,
+		KeyID:     idp.keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (idp *mockIDP) sign(claims map[string]interface{}) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: idp.key, KeyID: idp.keyID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return signed.CompactSerialize()
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getFirst(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -13,11 +13,12 @@ import (
 	"self-service-portal/internal/handlers"
 
 	"self-service-portal/internal/config"
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/secrets"
 
 	"runtime/debug"
 
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 )
 
@@ -28,22 +29,6 @@ func main() {
 	// Create a new Gin engine
 	r := gin.Default()
 
-	// Configure session store with valid 32-byte keys
-	authKey := []byte("12345678901234567890123456789012") // 32 bytes
-	encKey := []byte("abcdefghijklmnopqrstuvwxyzabcdef")  // 32 bytes
-	store := cookie.NewStore(authKey, encKey)
-	store.Options(sessions.Options{
-		Path:     "/",
-		MaxAge:   86400, // 24 hours
-		HttpOnly: true,
-		Secure:   false, // Set to true in production
-	})
-	r.Use(sessions.Sessions("session", store))
-
-	log.Println("✅ Session store configured with proper keys")
-	log.Printf("   Hash key length: %d bytes", len(authKey))
-	log.Printf("   Block key length: %d bytes", len(encKey))
-
 	// Serve static files
 	r.Static("/static", "./web/static")
 
@@ -52,12 +37,100 @@ func main() {
 
 	log.Println("🚀 Starting Self Service Portal...")
 
+	// Initialize database
+	cfg := config.Load()
+	db, err := database.Initialize(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize database: %v", err)
+	}
+
+	// Client IPs (used for rate limiting) are only taken from X-Forwarded-For sent by these proxies;
+	// without any, the connection's remote address is used and forwarded headers are ignored
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
+	if len(cfg.TrustedProxies) == 0 {
+		log.Println("⚠️ TRUSTED_PROXIES is not set; X-Forwarded-For is ignored and client IPs are the remote addresses")
+	}
+
+	// Every request gets an ID that ties its log lines and audit events together
+	r.Use(handlers.RequestID())
+
+	// Session keys are derived from SESSION_SECRET; cookie settings follow ENVIRONMENT
+	store, err := handlers.NewSessionStore(cfg, db)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize session store: %v", err)
+	}
+	r.Use(sessions.Sessions("session", store))
+
+	// State-changing requests must come from a portal page (or carry an API token)
+	r.Use(handlers.NewCSRFProtection(cfg.CSRFTrustedOrigins).Middleware())
+
+	// Portal operators are created with cmd/bootstrap-admin; seed the first one from the environment
+	if email, password := os.Getenv("PORTAL_ADMIN_EMAIL"), os.Getenv("PORTAL_ADMIN_PASSWORD"); email != "" && password != "" {
+		if _, _, err := database.BootstrapAdmin(db, email, password, os.Getenv("PORTAL_ADMIN_FIRST_NAME"), os.Getenv("PORTAL_ADMIN_LAST_NAME")); err != nil {
+			log.Printf("❌ Failed to bootstrap portal admin: %v", err)
+		}
+	}
+	if count, err := database.CountPortalUsers(db); err == nil && count == 0 {
+		log.Println("⚠️ No portal accounts exist. Run `go run ./cmd/bootstrap-admin` with PORTAL_ADMIN_EMAIL and PORTAL_ADMIN_PASSWORD set.")
+	}
+
 	// Initialize handlers
 	log.Println("Initializing handlers...")
-	authHandler := &handlers.AuthHandler{}
-	loginHandler := &handlers.LoginHandler{}
+	authHandler := handlers.NewAuthHandler()
+	loginHandler := handlers.NewLoginHandler(db)
 	configHandler := handlers.NewConfigHandler()
-	verificationHandler := handlers.NewVerificationHandler(configHandler)
+	configHandler.SetProduction(cfg.IsProduction())
+	access := handlers.NewAccessControl(db)
+	ssoHandler := handlers.NewSSOHandler(loginHandler, configHandler)
+	loginHandler.SetSSOHandler(ssoHandler)
+
+	// SDO credentials are kept on the server; sessions and API tokens only carry their ID
+	sdoCredentials, err := handlers.NewSDOCredentialStore(cfg.SDOCredentialStore, db, cfg.RedisURL)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize SDO credential store: %v", err)
+	}
+	log.Printf("🗄️ SDO credential store: %s (ttl %s)", cfg.SDOCredentialStore, cfg.SDOCredentialTTL)
+	authHandler.SetSDOCredentialStore(sdoCredentials, cfg.SDOCredentialTTL)
+	loginHandler.SetAuthHandler(authHandler)
+
+	// Signed API tokens for machine clients; routes guarded by access.Require accept either
+	// a portal session or a bearer token with the matching scope
+	apiTokens, err := handlers.NewAPITokens(db, cfg)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize API tokens: %v", err)
+	}
+	authHandler.SetAPITokens(apiTokens)
+	access.SetAPITokens(apiTokens)
+
+	// Token buckets per IP, session and target email for logins, searches, invitations and verifications
+	rateLimitStore, err := handlers.NewRateLimitStore(cfg.RateLimitStore, cfg.RedisURL)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize rate limit store: %v", err)
+	}
+	limiter, err := handlers.NewRateLimiter(rateLimitStore, cfg.RateLimits)
+	if err != nil {
+		log.Fatalf("❌ Invalid rate limit: %v", err)
+	}
+	log.Printf("🗄️ Rate limit store: %s", cfg.RateLimitStore)
+
+	verificationStore, err := handlers.NewVerificationStore(cfg.VerificationStore, db, cfg.VerificationStorePath)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize verification store: %v", err)
+	}
+	log.Printf("🗄️ Verification store: %s", cfg.VerificationStore)
+	verificationHandler := handlers.NewVerificationHandler(configHandler, verificationStore)
+	authHandler.SetVerificationHandler(verificationHandler)
+
+	// Hash-chained audit log of operator actions and verification results
+	audit := handlers.NewAuditLog(db)
+	verificationHandler.SetAuditLog(audit)
+
+	// Server-side enrollment flow shared by the SDO and verification steps
+	enrollmentFlows := handlers.NewEnrollmentFlowManager(handlers.NewEnrollmentFlowStore(cfg.VerificationStore, db), verificationStore)
+	authHandler.SetEnrollmentFlows(enrollmentFlows)
+	verificationHandler.SetEnrollmentFlows(enrollmentFlows)
 
 	// Start background task for cleaning up expired verification sessions
 	go func() {
@@ -65,9 +138,38 @@ func main() {
 		defer ticker.Stop()
 		for range ticker.C {
 			verificationHandler.CleanupExpiredSessions()
+			authHandler.PurgeSDOCredentials()
+			enrollmentFlows.Purge()
+			apiTokens.PurgeRetiredKeys()
+			limiter.Purge()
 		}
 	}()
-	log.Println("🔄 Started verification session cleanup background task")
+	log.Println("🔄 Started verification session, enrollment flow and SDO credential cleanup background task")
+
+	// Poll the provider only as a fallback for results that never arrived through the webhook
+	pollingInterval := 300
+	if portalConfig, err := configHandler.LoadConfig(); err == nil {
+		if err := configHandler.CheckProductionConfig(portalConfig); err != nil {
+			log.Fatalf("❌ Refusing to start: %v", err)
+		}
+		pollingInterval = portalConfig.API.ResultPollingInterval
+		switch provider := portalConfig.API.VerificationProvider; provider {
+		case handlers.ProviderMock:
+			log.Println("⚠️ Verification provider: mock - verifications use scripted results and prove nothing")
+		case handlers.ProviderOnfido:
+			log.Println("🛡️ Verification provider: onfido")
+		default:
+			switch mode := portalConfig.API.Au10tixMode; mode {
+			case handlers.Au10tixModeDemo:
+				log.Println("⚠️ Au10tix mode: demo - verifications use scripted results and prove nothing")
+			case handlers.Au10tixModeSandbox:
+				log.Printf("⚠️ Au10tix mode: sandbox (%s)", portalConfig.API.Au10tixSandboxURL)
+			default:
+				log.Println("🛡️ Au10tix mode: production")
+			}
+		}
+	}
+	verificationHandler.StartResultPolling(time.Duration(pollingInterval) * time.Second)
 
 	// Add custom recovery middleware to log panics
 	r.Use(func(c *gin.Context) {
@@ -88,11 +190,18 @@ func main() {
 	})
 
 	r.GET("/login", loginHandler.LoginPage)
-	r.GET("/logout", loginHandler.Logout)
-	r.POST("/login", func(c *gin.Context) {
+	r.GET("/logout", audit.Track(handlers.AuditLogout), loginHandler.Logout)
+	r.POST("/login", audit.Track(handlers.AuditLogin), limiter.Limit(handlers.RateLimitLogin), func(c *gin.Context) {
 		loginHandler.ProcessLogin(c)
 	})
 
+	// Single sign-on for portal operators
+	r.GET("/auth/oidc/login", ssoHandler.OIDCLogin)
+	r.GET("/auth/oidc/callback", audit.Track(handlers.AuditSSOLogin), ssoHandler.OIDCCallback)
+	r.GET("/auth/saml/login", ssoHandler.SAMLLogin)
+	r.GET("/saml/metadata", ssoHandler.SAMLMetadata)
+	r.POST("/saml/acs", audit.Track(handlers.AuditSSOLogin), ssoHandler.SAMLACS)
+
 	r.GET("/health", func(c *gin.Context) {
 		log.Println("Health check accessed")
 		c.JSON(http.StatusOK, gin.H{"status": "healthy", "timestamp": time.Now()})
@@ -102,11 +211,13 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Test endpoint working"})
 	})
 
-	// Dashboard route (now public, no authentication required)
-	r.GET("/dashboard", func(c *gin.Context) {
-		log.Println("Dashboard accessed (public)")
+	// Dashboard route (portal staff only)
+	r.GET("/dashboard", access.Require(handlers.PermViewDashboard), func(c *gin.Context) {
+		log.Printf("Dashboard accessed by %s", c.GetString("user"))
 		c.HTML(http.StatusOK, "dashboard.html", gin.H{
-			"user": "admin", // Default user since no login required
+			"user":      c.GetString("user"),
+			"role":      c.GetString("role"),
+			"csrfToken": handlers.CSRFToken(c),
 		})
 	})
 
@@ -114,28 +225,14 @@ func main() {
 	r.GET("/self-service", func(c *gin.Context) {
 		log.Println("Self-service flow accessed (public)")
 
-		// Load config and create SDO config JSON
+		// Only the SDO address goes to the browser; the page signs in to SDO through the
+		// server-held service session at /api/sdo/service-session
 		cfg := config.Load()
-
-		// Read portal config directly for SDO credentials
 		sdoConfig := map[string]string{
-			"url":      cfg.SDODefaultURL,
-			"email":    "",
-			"password": "",
+			"url": cfg.SDODefaultURL,
 		}
-
-		// Try to read portal-config.json for SDO credentials
-		if data, err := os.ReadFile("portal-config.json"); err == nil {
-			var portalConfig struct {
-				Auth struct {
-					SDOEmail    string `json:"sdo_email"`
-					SDOPassword string `json:"sdo_password"`
-				} `json:"auth"`
-			}
-			if json.Unmarshal(data, &portalConfig) == nil {
-				sdoConfig["email"] = portalConfig.Auth.SDOEmail
-				sdoConfig["password"] = portalConfig.Auth.SDOPassword
-			}
+		if sdoURL, err := secrets.Default().Get(c.Request.Context(), secrets.SDOURL); err == nil {
+			sdoConfig["url"] = sdoURL
 		}
 
 		sdoConfigJSON, _ := json.Marshal(sdoConfig)
@@ -143,81 +240,134 @@ func main() {
 		c.HTML(http.StatusOK, "self-service-flow.html", gin.H{
 			"user":          "admin", // Default user since no login required
 			"SDOConfigJSON": string(sdoConfigJSON),
+			"csrfToken":     handlers.CSRFToken(c),
 		})
 	})
 
-	// Configuration routes (now public, no authentication required)
-	r.GET("/config", configHandler.ConfigPage)
-	r.POST("/save-config", configHandler.SaveConfig)
-	r.GET("/get-config", configHandler.GetConfig)
-	r.GET("/export-config", configHandler.ExportConfig)
-	r.POST("/import-config", configHandler.ImportConfig)
-	r.POST("/test-sdo-connection", configHandler.TestSDOConnection)
-	r.POST("/test-au10tix-connection", configHandler.TestAu10tixConnection)
-
-	// Verification routes (now public, no authentication required)
-	r.POST("/start-verification", verificationHandler.StartVerification)
-	r.GET("/check-verification/:id", verificationHandler.GetVerificationStatus)
-
-	// Protected routes
-	log.Println("Setting up protected routes...")
-	protected := r.Group("/")
-	protected.Use(authMiddleware())
+	// Configuration routes (admins manage, auditors may view)
+	r.GET("/config", access.Require(handlers.PermViewConfig), configHandler.ConfigPage)
+	r.POST("/save-config", audit.Track(handlers.AuditConfigUpdate), access.Require(handlers.PermManageConfig), configHandler.SaveConfig)
+	r.GET("/get-config", access.Require(handlers.PermViewConfig), configHandler.GetConfig)
+	r.GET("/export-config", access.Require(handlers.PermManageConfig), configHandler.ExportConfig)
+	r.POST("/import-config", audit.Track(handlers.AuditConfigImport), access.Require(handlers.PermManageConfig), configHandler.ImportConfig)
+	r.POST("/test-sdo-connection", access.Require(handlers.PermManageConfig), configHandler.TestSDOConnection)
+	r.POST("/test-au10tix-connection", access.Require(handlers.PermManageConfig), configHandler.TestAu10tixConnection)
+
+	// Verification routes
+	r.POST("/start-verification", audit.Track(handlers.AuditVerificationStart), limiter.Limit(handlers.RateLimitVerification), access.Require(handlers.PermStartVerification), verificationHandler.StartVerification)
+	r.GET("/check-verification/:id", access.Require(handlers.PermViewVerification), verificationHandler.GetVerificationStatus)
+	r.GET("/verification/demo/:id", verificationHandler.DemoCapturePage)
+	r.GET("/verification/mock/:id", verificationHandler.MockCapturePage)
+	r.POST("/verification/mock/:id/submit", verificationHandler.MockCaptureSubmit)
 
 	// API routes
+	// Public keys for verifying API tokens
+	r.GET("/.well-known/jwks.json", apiTokens.JWKS)
+
 	api := r.Group("/api")
 
 	// Auth API routes
-	api.POST("/auth/login", loginHandler.ProcessLogin)
-	api.POST("/auth/logout", loginHandler.Logout)
+	api.POST("/auth/login", audit.Track(handlers.AuditLogin), limiter.Limit(handlers.RateLimitLogin), loginHandler.ProcessLogin)
+	api.POST("/auth/logout", audit.Track(handlers.AuditLogout), loginHandler.Logout)
 	api.GET("/auth/check", loginHandler.CheckAuth)
+	api.POST("/auth/change-password", audit.Track(handlers.AuditPasswordChange), access.Require(handlers.PermChangePassword), loginHandler.ChangePassword)
+
+	// Portal account management
+	api.GET("/portal-users", access.Require(handlers.PermManageAccounts), loginHandler.ListPortalUsers)
+	api.POST("/portal-users", audit.Track(handlers.AuditPortalUserCreate), access.Require(handlers.PermManageAccounts), loginHandler.CreatePortalUser)
+	api.PATCH("/portal-users/:id", audit.Track(handlers.AuditPortalUserUpdate), access.Require(handlers.PermManageAccounts), loginHandler.UpdatePortalUser)
+
+	// API token administration (admin)
+	api.GET("/tokens", access.Require(handlers.PermManageAPITokens), apiTokens.ListTokens)
+	api.POST("/tokens", audit.Track(handlers.AuditAPITokenCreate), access.Require(handlers.PermManageAPITokens), apiTokens.CreateToken)
+	api.DELETE("/tokens/:id", audit.Track(handlers.AuditAPITokenRevoke), access.Require(handlers.PermManageAPITokens), apiTokens.RevokeToken)
+	api.POST("/tokens/keys/rotate", audit.Track(handlers.AuditAPIKeyRotate), access.Require(handlers.PermManageAPITokens), apiTokens.RotateSigningKey)
 
 	// SDO API routes
-	api.POST("/sdo/auth", authHandler.SDOAuth)
-	api.GET("/sdo/status", authHandler.GetSDOStatus)
-	api.POST("/sdo/logout", authHandler.LogoutSDO)
-	api.POST("/sdo/test-connection", authHandler.TestSDOConnection)
-	api.GET("/sdo/search", authHandler.SearchUsers)
+	api.POST("/sdo/auth", audit.Track(handlers.AuditSDOConnect), limiter.Limit(handlers.RateLimitLogin), access.Require(handlers.PermConnectSDO), authHandler.SDOAuth)
+	api.POST("/sdo/auth/token", audit.Track(handlers.AuditSDOConnect), limiter.Limit(handlers.RateLimitLogin), authHandler.SDOAuthJWT)
+	api.POST("/sdo/service-session", limiter.Limit(handlers.RateLimitSDOSession), access.Require(handlers.PermUseSDO), authHandler.SDOAuthFromConfig)
+	api.GET("/sdo/status", access.Require(handlers.PermUseSDO), authHandler.GetSDOStatus)
+	api.POST("/sdo/logout", access.Require(handlers.PermUseSDO), authHandler.LogoutSDO)
+	api.POST("/sdo/test-connection", access.Require(handlers.PermConnectSDO), authHandler.TestSDOConnection)
+	api.GET("/sdo/search", audit.Track(handlers.AuditSDOSearch), limiter.Limit(handlers.RateLimitSearch), access.Require(handlers.PermSearchUsers), authHandler.SearchUsers)
 
 	// SDO invitation and QR code routes
 	sdo := api.Group("/sdo")
-	sdo.POST("/invite", authHandler.SendInvitation)
-	sdo.POST("/qr", authHandler.GenerateQRCode)
-	sdo.POST("/verify-user", authHandler.VerifyUserState)
+	sdo.POST("/invite", audit.Track(handlers.AuditSDOInvite), limiter.Limit(handlers.RateLimitInvite), access.Require(handlers.PermSendInvitations), authHandler.SendInvitation)
+	sdo.POST("/qr", audit.Track(handlers.AuditSDOQRCode), limiter.Limit(handlers.RateLimitInvite), access.Require(handlers.PermSendInvitations), authHandler.GenerateQRCode)
+	sdo.POST("/verify-user", audit.Track(handlers.AuditSDOVerifyUser), access.Require(handlers.PermSendInvitations), authHandler.VerifyUserState)
 
 	// Portal and validation
-	sdo.GET("/portal/check", authHandler.CheckSDOPortal)
-	sdo.GET("/validate", authHandler.ValidateInvitationID)
+	sdo.GET("/portal/check", access.Require(handlers.PermUseSDO), authHandler.CheckSDOPortal)
+	sdo.GET("/validate", access.Require(handlers.PermUseSDO), authHandler.ValidateInvitationID)
 
 	// Verification API routes
-	api.POST("/verification/start", func(c *gin.Context) {
-		log.Println("🛡️ Au10tix verification start API route accessed")
+	api.POST("/verification/start", audit.Track(handlers.AuditVerificationStart), limiter.Limit(handlers.RateLimitVerification), access.Require(handlers.PermStartVerification), func(c *gin.Context) {
+		log.Println("🛡️ Verification start API route accessed")
 		verificationHandler.StartVerification(c)
 	})
 
-	api.GET("/verification/:id/status", func(c *gin.Context) {
-		log.Printf("📊 Au10tix verification status check accessed")
+	api.GET("/verification/:id/status", access.Require(handlers.PermViewVerification), func(c *gin.Context) {
+		log.Printf("📊 Verification status check accessed")
 		verificationHandler.GetVerificationStatus(c)
 	})
 
+	// Enrollment flow
+	api.POST("/enrollment/identify", access.Require(handlers.PermSendInvitations), authHandler.IdentifyUser)
+	api.GET("/enrollment/flow", access.Require(handlers.PermSendInvitations), authHandler.GetEnrollmentFlow)
+
+	// Manual review of identity matches
+	api.GET("/verification/reviews", access.Require(handlers.PermListReviews), verificationHandler.ListIdentityReviews)
+	api.POST("/verification/:id/review", audit.Track(handlers.AuditVerificationReview), access.Require(handlers.PermReviewIdentity), verificationHandler.ReviewIdentityMatch)
+
+	// Audit log (admins and auditors; API tokens with the audit:view scope)
+	api.GET("/audit", access.Require(handlers.PermViewAuditLog), audit.ListEvents)
+	api.GET("/audit/export", access.Require(handlers.PermViewAuditLog), audit.ExportEvents)
+	api.GET("/audit/verify", access.Require(handlers.PermViewAuditLog), audit.VerifyChain)
+
+	// Au10tix mode and token state (admins and auditors)
+	api.GET("/au10tix/status", access.Require(handlers.PermViewConfig), verificationHandler.Au10tixStatus)
+
+	// Configured verification provider and what each provider supports (admins and auditors)
+	api.GET("/verification/provider", access.Require(handlers.PermViewConfig), verificationHandler.VerificationProviderStatus)
+
+	// Provider result callbacks (authenticated by each provider's HMAC signature)
+	api.POST("/webhooks/:provider", verificationHandler.VerificationWebhook)
+
 	// Start server
 	port := ":8080"
 	log.Printf("🚀 Server starting on port %s", port)
 	log.Printf("📱 Visit: http://localhost%s/", port)
-	log.Printf("🏠 Dashboard: http://localhost%s/dashboard (no login required)", port)
-	log.Printf("⚙️ Configuration: http://localhost%s/config (no login required)", port)
+	log.Printf("🏠 Dashboard: http://localhost%s/dashboard (portal login required)", port)
+	log.Printf("⚙️ Configuration: http://localhost%s/config (admin or auditor login required)", port)
 	log.Printf("🏥 Health: http://localhost%s/health", port)
 	log.Printf("🧪 Test: http://localhost%s/test", port)
 	log.Println("=====================================")
 	log.Println("🔧 API Routes Available:")
 	log.Println("   ✅ POST /api/sdo/auth           - SDO Authentication")
+	log.Println("   ✅ POST /api/sdo/service-session - SDO Service Session")
 	log.Println("   ✅ GET  /api/sdo/status         - SDO Status")
 	log.Println("   ✅ GET  /api/sdo/search         - Search Users")
 	log.Println("   ✅ POST /api/sdo/test-connection - SDO Connection Test")
 	log.Println("   ✅ GET  /api/sdo/portal/check   - SDO Portal Check")
 	log.Println("   ✅ GET  /api/sdo/validate       - SDO Validation")
-	log.Println("   ✅ POST /api/verification/start - Au10tix Verification")
+	log.Println("   ✅ POST /api/enrollment/identify - Start Enrollment Flow")
+	log.Println("   ✅ GET  /api/enrollment/flow    - Enrollment Flow State")
+	log.Println("   ✅ POST /api/verification/start - Identity Verification")
 	log.Println("   ✅ GET  /api/verification/:id/status - Check Status")
+	log.Println("   ✅ GET  /api/au10tix/status     - Au10tix Mode and Token")
+	log.Println("   ✅ GET  /api/verification/provider - Verification Provider")
+	log.Println("   ✅ POST /api/webhooks/:provider - Provider Result Webhooks")
+	log.Println("   ✅ POST /api/auth/change-password - Change Portal Password")
+	log.Println("   ✅ GET  /api/verification/reviews - Identity Match Reviews")
+	log.Println("   ✅ GET  /api/portal-users       - Portal Accounts (admin)")
+	log.Println("   ✅ POST /api/sdo/auth/token     - SDO Login for API Clients")
+	log.Println("   ✅ GET  /api/tokens             - API Tokens (admin)")
+	log.Println("   ✅ GET  /api/audit              - Audit Log")
+	log.Println("   ✅ GET  /.well-known/jwks.json  - API Token Signing Keys")
+	log.Println("   ✅ GET  /auth/oidc/login        - OIDC Single Sign-On")
+	log.Println("   ✅ GET  /auth/saml/login        - SAML Single Sign-On")
 	log.Println("=====================================")
 
 	// Create server
@@ -249,21 +399,3 @@ func main() {
 
 	log.Println("Server exiting")
 }
-
-// authMiddleware checks if the user is authenticated
-func authMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
-		authenticated := session.Get("authenticated")
-		username := session.Get("username")
-
-		if authenticated == nil || !authenticated.(bool) || username == nil {
-			log.Printf("🚫 Unauthorized access attempt to %s from IP: %s", c.Request.URL.Path, c.ClientIP())
-			c.Redirect(http.StatusFound, "/login")
-			c.Abort()
-			return
-		}
-		c.Set("user", username)
-		c.Next()
-	}
-}
@@ -5,27 +5,53 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Environment    string
-	Port           string
-	DatabaseURL    string
-	SessionSecret  string
-	SDODefaultURL  string
-	Au10tixBaseURL string
-	APITimeout     int
-	APIRetries     int
+	Environment            string
+	Port                   string
+	DatabaseURL            string
+	SessionSecret          string
+	SessionPreviousSecrets []string
+	SessionStore           string
+	SessionMaxAge          time.Duration
+	SessionSameSite        string
+	SDODefaultURL          string
+	Au10tixBaseURL         string
+	APITimeout             int
+	APIRetries             int
+	VerificationStore      string
+	VerificationStorePath  string
+	SDOCredentialStore     string
+	SDOCredentialTTL       time.Duration
+	RedisURL               string
+	APITokenIssuer         string
+	APITokenAudience       string
+	APITokenAlgorithm      string
+	APITokenMaxTTL         time.Duration
+	CSRFTrustedOrigins     []string
+	TrustedProxies         []string
+	RateLimitStore         string
+	RateLimits             map[string]string // Policy per route group, e.g. "ip=20/1m,session=10/1m,target=5/15m"
 }
 
 type PortalConfig struct {
 	Auth struct {
-		SDOURL       string `json:"sdo_url"`
-		SDOEmail     string `json:"sdo_email"`
-		SDOPassword  string `json:"sdo_password"`
-		Au10tixToken string `json:"au10tix_token"`
+		SDOURL               string `json:"sdo_url"`
+		SDOEmail             string `json:"sdo_email"`
+		SDOPassword          string `json:"sdo_password"`
+		Au10tixToken         string `json:"au10tix_token"`
+		Au10tixWebhookSecret string `json:"au10tix_webhook_secret"`
+		Au10tixClientID      string `json:"au10tix_client_id"`
+		Au10tixClientSecret  string `json:"au10tix_client_secret"`
+		Au10tixPrivateKey    string `json:"au10tix_private_key"`
+		OnfidoAPIToken       string `json:"onfido_api_token"`
+		OnfidoWebhookToken   string `json:"onfido_webhook_token"`
 	} `json:"auth"`
 	Updated string `json:"updated"`
 }
@@ -43,7 +69,41 @@ func Load() *Config {
 		Au10tixBaseURL: getEnv("AU10TIX_BASE_URL", "https://eus-api.au10tixservicesstaging.com"),
 		APITimeout:     30,
 		APIRetries:     3,
+
+		SessionPreviousSecrets: getListEnv("SESSION_PREVIOUS_SECRETS"),
+		SessionStore:           getEnv("SESSION_STORE", "cookie"),
+		SessionSameSite:        getEnv("SESSION_SAMESITE", "lax"),
+
+		VerificationStore:     getEnv("VERIFICATION_STORE", "sql"),
+		VerificationStorePath: getEnv("VERIFICATION_STORE_PATH", "verifications.json"),
+		SDOCredentialStore:    getEnv("SDO_CREDENTIAL_STORE", "memory"),
+		SDOCredentialTTL:      getDurationEnv("SDO_CREDENTIAL_TTL", 12*time.Hour),
+		RedisURL:              getEnv("REDIS_URL", "redis://localhost:6379/0"),
+
+		APITokenIssuer:    getEnv("API_TOKEN_ISSUER", "self-service-portal"),
+		APITokenAudience:  getEnv("API_TOKEN_AUDIENCE", "self-service-portal-api"),
+		APITokenAlgorithm: getEnv("API_TOKEN_ALGORITHM", "EdDSA"),
+		APITokenMaxTTL:    getDurationEnv("API_TOKEN_MAX_TTL", 90*24*time.Hour),
+
+		CSRFTrustedOrigins: getListEnv("CSRF_TRUSTED_ORIGINS"),
+		TrustedProxies:     getListEnv("TRUSTED_PROXIES"),
+
+		RateLimitStore: getEnv("RATE_LIMIT_STORE", "memory"),
+		RateLimits: map[string]string{
+			"login":        getEnv("RATE_LIMIT_LOGIN", "ip=20/1m,session=10/1m,target=5/15m"),
+			"search":       getEnv("RATE_LIMIT_SEARCH", "ip=60/1m,session=30/1m"),
+			"verification": getEnv("RATE_LIMIT_VERIFICATION", "ip=10/1h,session=3/1h,target=3/1h"),
+			"invite":       getEnv("RATE_LIMIT_INVITE", "ip=30/1h,session=10/1h,target=3/1h"),
+			"sdo_session":  getEnv("RATE_LIMIT_SDO_SESSION", "ip=30/1m,session=5/1m"),
+		},
+	}
+
+	// Production sessions are shorter lived unless configured otherwise
+	defaultMaxAge := 24 * time.Hour
+	if config.IsProduction() {
+		defaultMaxAge = 8 * time.Hour
 	}
+	config.SessionMaxAge = getDurationEnv("SESSION_MAX_AGE", defaultMaxAge)
 
 	// Override with portal config if available
 	if portalConfig != nil {
@@ -55,21 +115,99 @@ func Load() *Config {
 	return config
 }
 
+// IsProduction reports whether the portal runs with ENVIRONMENT=production
+func (c *Config) IsProduction() bool {
+	return strings.EqualFold(c.Environment, "production")
+}
+
+// placeholderSessionSecrets are the example values shipped in this repository's templates
+var placeholderSessionSecrets = []string{
+	defaultSessionSecret,
+	"your-super-secret-session-key",
+	"your-super-secret-session-key-change-this",
+	"your-super-secret-session-key-change-this-in-production",
+	"your-production-secret",
+	"your-production-session-secret",
+}
+
+// ValidateSessionSecret rejects session secrets that anyone with the repository could know.
+// Outside production it only warns, so development setups start without extra steps.
+func (c *Config) ValidateSessionSecret() error {
+	var problem string
+	for _, placeholder := range placeholderSessionSecrets {
+		if c.SessionSecret == placeholder {
+			problem = "SESSION_SECRET is a published example value"
+			break
+		}
+	}
+	if problem == "" && len(c.SessionSecret) < 32 {
+		problem = "SESSION_SECRET must be at least 32 characters"
+	}
+	if problem == "" {
+		return nil
+	}
+	if c.IsProduction() {
+		return fmt.Errorf("%s", problem)
+	}
+	log.Printf("⚠️ %s; sessions can be forged. Set a random SESSION_SECRET before going to production.", problem)
+	return nil
+}
+
 func LoadPortalConfig() *PortalConfig {
-	data, err := os.ReadFile("portal-config.json")
+	config, err := LoadPortalConfigFile("portal-config.json")
 	if err != nil {
-		log.Printf("📥 Could not read portal-config.json: %v", err)
+		log.Printf("📥 Could not load portal-config.json: %v", err)
 		return nil
 	}
 
+	log.Printf("📥 Loaded configuration from portal-config.json")
+	return config
+}
+
+// LoadPortalConfigFile reads the auth section of a portal configuration file with its secrets decrypted
+func LoadPortalConfigFile(path string) (*PortalConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
 	var config PortalConfig
 	if err := json.Unmarshal(data, &config); err != nil {
-		log.Printf("📥 Could not parse portal-config.json: %v", err)
-		return nil
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
 	}
 
-	log.Printf("📥 Loaded configuration from portal-config.json")
-	return &config
+	if err := decryptPortalSecrets(&config); err != nil {
+		return nil, fmt.Errorf("could not decrypt secrets in %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// decryptPortalSecrets opens the secrets that ConfigHandler stores encrypted
+func decryptPortalSecrets(config *PortalConfig) error {
+	secrets := []*string{
+		&config.Auth.SDOPassword, &config.Auth.Au10tixToken, &config.Auth.Au10tixWebhookSecret,
+		&config.Auth.Au10tixClientSecret, &config.Auth.Au10tixPrivateKey,
+		&config.Auth.OnfidoAPIToken, &config.Auth.OnfidoWebhookToken,
+	}
+
+	var secretCipher *SecretCipher
+	for _, secret := range secrets {
+		if !IsEncryptedSecret(*secret) {
+			continue
+		}
+		if secretCipher == nil {
+			var err error
+			if secretCipher, err = DefaultSecretCipher(); err != nil {
+				return err
+			}
+		}
+		plaintext, err := secretCipher.Decrypt(*secret)
+		if err != nil {
+			return err
+		}
+		*secret = plaintext
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -79,11 +217,38 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getListEnv splits a comma separated variable, dropping empty entries
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("⚠️ Invalid %s %q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// defaultSessionSecret is used when SESSION_SECRET is not set; production refuses to start with it
+const defaultSessionSecret = "your-secret-key-change-this-in-production"
+
 func generateSessionSecret() string {
 	secret := os.Getenv("SESSION_SECRET")
 	if secret == "" {
 		log.Println("Warning: Using default session secret. Set SESSION_SECRET environment variable for production.")
-		return "your-secret-key-change-this-in-production"
+		return defaultSessionSecret
 	}
 	return secret
 }
@@ -0,0 +1,401 @@
+// File: internal/config/envelope.go - Envelope encryption for secrets stored in portal-config.json
+package config
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EncryptedSecretPrefix marks a configuration value produced by SecretCipher.Encrypt.
+// The full format is enc:v1:<provider>:<key id>:<wrapped data key>:<nonce+ciphertext>.
+const EncryptedSecretPrefix = "enc:v1:"
+
+// Environment variables that configure the built-in local key provider
+const (
+	KeyProviderEnv       = "PORTAL_CONFIG_KEY_PROVIDER"
+	MasterKeyEnv         = "PORTAL_CONFIG_KEY"
+	PreviousKeysEnv      = "PORTAL_CONFIG_PREVIOUS_KEYS"
+	MasterKeyFileEnv     = "PORTAL_CONFIG_KEYFILE"
+	DefaultMasterKeyFile = "portal-config.key"
+	LocalKeyProvider     = "local"
+)
+
+// KeyProvider wraps and unwraps the per-secret data keys with a key encryption key.
+// The local provider holds the key in process; KMS plugins call out to an external service
+// and register themselves with RegisterKeyProvider.
+type KeyProvider interface {
+	// Name identifies the provider in encrypted values
+	Name() string
+	// KeyID identifies the key that WrapKey currently uses
+	KeyID() string
+	WrapKey(dataKey []byte) ([]byte, error)
+	// UnwrapKey must accept data keys wrapped by retired keys while they are being rotated out
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// KeyProviderFactory builds a key provider from the process environment
+type KeyProviderFactory func() (KeyProvider, error)
+
+var (
+	keyProvidersMu sync.RWMutex
+	keyProviders   = map[string]KeyProviderFactory{
+		LocalKeyProvider: newLocalKeyProviderFromEnv,
+	}
+)
+
+// RegisterKeyProvider makes a key provider selectable through PORTAL_CONFIG_KEY_PROVIDER.
+// KMS plugins call it from an init function and are linked in with a blank import.
+func RegisterKeyProvider(name string, factory KeyProviderFactory) {
+	keyProvidersMu.Lock()
+	defer keyProvidersMu.Unlock()
+	keyProviders[name] = factory
+}
+
+// KeyProviders lists the registered key provider names
+func KeyProviders() []string {
+	keyProvidersMu.RLock()
+	defer keyProvidersMu.RUnlock()
+	names := make([]string, 0, len(keyProviders))
+	for name := range keyProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SecretCipher encrypts configuration secrets with a fresh AES-256-GCM data key per value
+type SecretCipher struct {
+	provider KeyProvider
+}
+
+// NewSecretCipher creates a cipher that wraps data keys with the given provider
+func NewSecretCipher(provider KeyProvider) *SecretCipher {
+	return &SecretCipher{provider: provider}
+}
+
+var (
+	defaultCipherOnce sync.Once
+	defaultCipher     *SecretCipher
+	defaultCipherErr  error
+)
+
+// DefaultSecretCipher returns the process-wide cipher selected by PORTAL_CONFIG_KEY_PROVIDER
+func DefaultSecretCipher() (*SecretCipher, error) {
+	defaultCipherOnce.Do(func() {
+		name := getEnv(KeyProviderEnv, LocalKeyProvider)
+
+		keyProvidersMu.RLock()
+		factory, ok := keyProviders[name]
+		keyProvidersMu.RUnlock()
+		if !ok {
+			defaultCipherErr = fmt.Errorf("unknown config key provider %q (registered: %s)", name, strings.Join(KeyProviders(), ", "))
+			return
+		}
+
+		provider, err := factory()
+		if err != nil {
+			defaultCipherErr = fmt.Errorf("config key provider %s: %w", name, err)
+			return
+		}
+		log.Printf("🔐 Configuration secrets protected by %s key provider (key %s)", provider.Name(), provider.KeyID())
+		defaultCipher = NewSecretCipher(provider)
+	})
+	return defaultCipher, defaultCipherErr
+}
+
+// IsEncryptedSecret reports whether the value is an encrypted secret rather than plaintext
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, EncryptedSecretPrefix)
+}
+
+// encryptedSecret is the parsed form of an encrypted configuration value
+type encryptedSecret struct {
+	provider   string
+	keyID      string
+	wrappedKey []byte
+	sealed     []byte
+}
+
+func parseEncryptedSecret(value string) (*encryptedSecret, error) {
+	parts := strings.Split(strings.TrimPrefix(value, EncryptedSecretPrefix), ":")
+	if len(parts) != 4 {
+		return nil, errors.New("malformed encrypted secret")
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed wrapped data key: %w", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ciphertext: %w", err)
+	}
+	return &encryptedSecret{provider: parts[0], keyID: parts[1], wrappedKey: wrappedKey, sealed: sealed}, nil
+}
+
+// Encrypt seals a secret under a new data key. Empty values stay empty.
+func (s *SecretCipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	sealed, err := sealAESGCM(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := s.provider.WrapKey(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return EncryptedSecretPrefix + strings.Join([]string{
+		s.provider.Name(),
+		s.provider.KeyID(),
+		base64.RawStdEncoding.EncodeToString(wrappedKey),
+		base64.RawStdEncoding.EncodeToString(sealed),
+	}, ":"), nil
+}
+
+// Decrypt opens an encrypted secret. Plaintext values written before encryption was
+// enabled are returned unchanged so existing configuration keeps working until it is re-saved.
+func (s *SecretCipher) Decrypt(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+
+	secret, err := parseEncryptedSecret(value)
+	if err != nil {
+		return "", err
+	}
+	if secret.provider != s.provider.Name() {
+		return "", fmt.Errorf("secret was encrypted by key provider %q, but %q is configured", secret.provider, s.provider.Name())
+	}
+	dataKey, err := s.provider.UnwrapKey(secret.keyID, secret.wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := openAESGCM(dataKey, secret.sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReencryption reports whether a stored value is plaintext or sealed under a key
+// other than the current one, and should be written again
+func (s *SecretCipher) NeedsReencryption(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !IsEncryptedSecret(value) {
+		return true
+	}
+	secret, err := parseEncryptedSecret(value)
+	if err != nil {
+		return true
+	}
+	return secret.provider != s.provider.Name() || secret.keyID != s.provider.KeyID()
+}
+
+func sealAESGCM(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openAESGCM(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("secret could not be decrypted with the configured key")
+	}
+	return plaintext, nil
+}
+
+// localKeyProvider wraps data keys with AES-256-GCM master keys held in process
+type localKeyProvider struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewLocalKeyProvider creates a provider that wraps with current and still unwraps with previous keys
+func NewLocalKeyProvider(current []byte, previous ...[]byte) (KeyProvider, error) {
+	if len(current) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(current))
+	}
+	provider := &localKeyProvider{currentID: MasterKeyID(current), keys: map[string][]byte{}}
+	provider.keys[provider.currentID] = current
+	for _, key := range previous {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("previous master key must be 32 bytes, got %d", len(key))
+		}
+		provider.keys[MasterKeyID(key)] = key
+	}
+	return provider, nil
+}
+
+func (p *localKeyProvider) Name() string  { return LocalKeyProvider }
+func (p *localKeyProvider) KeyID() string { return p.currentID }
+
+func (p *localKeyProvider) WrapKey(dataKey []byte) ([]byte, error) {
+	return sealAESGCM(p.keys[p.currentID], dataKey)
+}
+
+func (p *localKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %s is not available", keyID)
+	}
+	return openAESGCM(key, wrapped)
+}
+
+// MasterKeyID derives the short identifier recorded with every value wrapped by the key
+func MasterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:6])
+}
+
+// GenerateMasterKey returns a new random master key in the encoding PORTAL_CONFIG_KEY expects
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// DecodeMasterKey parses a base64 encoded 32 byte master key
+func DecodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must decode to 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// MasterKeyFilePath returns the keyfile used when PORTAL_CONFIG_KEY is not set
+func MasterKeyFilePath() string {
+	return getEnv(MasterKeyFileEnv, DefaultMasterKeyFile)
+}
+
+// ReadMasterKeyFile reads a keyfile holding one base64 key per line, current key first.
+// Blank lines and lines starting with # are ignored.
+func ReadMasterKeyFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyfile %s contains no keys", path)
+	}
+	return keys, nil
+}
+
+// WriteMasterKeyFile replaces the keyfile with the given keys, current key first
+func WriteMasterKeyFile(path string, keys []string) error {
+	content := "# Portal configuration master keys: the first key encrypts, the others only decrypt\n" +
+		strings.Join(keys, "\n") + "\n"
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// newLocalKeyProviderFromEnv loads master keys from PORTAL_CONFIG_KEY (plus
+// PORTAL_CONFIG_PREVIOUS_KEYS) or from the keyfile. Outside production a missing
+// keyfile is created so development setups encrypt secrets without extra steps.
+func newLocalKeyProviderFromEnv() (KeyProvider, error) {
+	var encoded []string
+	if current := os.Getenv(MasterKeyEnv); current != "" {
+		encoded = append(encoded, current)
+		for _, previous := range strings.Split(os.Getenv(PreviousKeysEnv), ",") {
+			if previous = strings.TrimSpace(previous); previous != "" {
+				encoded = append(encoded, previous)
+			}
+		}
+	} else {
+		path := MasterKeyFilePath()
+		keys, err := ReadMasterKeyFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			if getEnv("ENVIRONMENT", "development") == "production" {
+				return nil, fmt.Errorf("set %s or provide the keyfile %s", MasterKeyEnv, path)
+			}
+			key, genErr := GenerateMasterKey()
+			if genErr != nil {
+				return nil, genErr
+			}
+			if err := WriteMasterKeyFile(path, []string{key}); err != nil {
+				return nil, fmt.Errorf("failed to create keyfile %s: %w", path, err)
+			}
+			log.Printf("⚠️ Generated configuration master key in %s. Set %s in production.", path, MasterKeyEnv)
+			keys = []string{key}
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read keyfile %s: %w", path, err)
+		}
+		encoded = keys
+	}
+
+	decoded := make([][]byte, 0, len(encoded))
+	for _, value := range encoded {
+		key, err := DecodeMasterKey(value)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, key)
+	}
+	return NewLocalKeyProvider(decoded[0], decoded[1:]...)
+}
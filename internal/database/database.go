@@ -4,8 +4,11 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"gorm.io/driver/postgres"
@@ -75,16 +78,68 @@ func Initialize(databaseURL string) (*gorm.DB, error) {
 func runMigrations(db *gorm.DB) error {
 	log.Println("🔄 Running database migrations...")
 
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Verification{},
+		&models.EnrollmentFlow{},
+		&models.SDOCredential{},
+		&models.APIToken{},
+		&models.APISigningKey{},
+		&models.AuditEvent{},
 		&models.ConfigSetting{},
-	)
+		&models.SchemaMigration{},
+	); err != nil {
+		return err
+	}
+
+	for _, migration := range dataMigrations {
+		if err := runDataMigration(db, migration.version, migration.apply); err != nil {
+			return fmt.Errorf("migration %s failed: %w", migration.version, err)
+		}
+	}
+	return nil
+}
+
+// dataMigrations change existing rows once per database, in order. Versions must never be
+// renamed or reused; each is recorded in schema_migrations when it has been applied.
+var dataMigrations = []struct {
+	version string
+	apply   func(tx *gorm.DB) error
+}{
+	{
+		// Portal accounts created before roles existed were bootstrapped admins
+		version: "0001_admin_role_for_existing_accounts",
+		apply: func(tx *gorm.DB) error {
+			return tx.Model(&models.User{}).
+				Where("password_hash <> '' AND role = ?", models.RoleSelfService).
+				Update("role", models.RoleAdmin).Error
+		},
+	},
+}
+
+// runDataMigration applies a data migration and records it in one transaction, unless it was
+// applied before
+func runDataMigration(db *gorm.DB, version string, apply func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var applied int64
+		if err := tx.Model(&models.SchemaMigration{}).Where("version = ?", version).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return nil
+		}
+
+		if err := apply(tx); err != nil {
+			return err
+		}
+		log.Printf("🔄 Applied migration %s", version)
+		return tx.Create(&models.SchemaMigration{Version: version, AppliedAt: time.Now()}).Error
+	})
 }
 
 // isPostgresURL checks if the database URL is for PostgreSQL
 func isPostgresURL(url string) bool {
-	return len(url) > 10 && (url[:10] == "postgres://" || url[:11] == "postgresql://")
+	return strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://")
 }
 
 // Helper functions for common database operations
@@ -105,6 +160,7 @@ func CreateUser(db *gorm.DB, email, firstName, lastName string) (*models.User, e
 		Email:     email,
 		FirstName: firstName,
 		LastName:  lastName,
+		Role:      models.RoleSelfService,
 	}
 
 	if err := db.Create(&user).Error; err != nil {
@@ -170,3 +226,430 @@ func SaveUserConfig(db *gorm.DB, userID uint, section string, config map[string]
 
 	return tx.Commit().Error
 }
+
+// FindOrCreateUser retrieves a user by email, creating it when it does not exist yet
+func FindOrCreateUser(db *gorm.DB, email, firstName, lastName string) (*models.User, error) {
+	user, err := GetUserByEmail(db, email)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return CreateUser(db, email, firstName, lastName)
+}
+
+// GetVerificationBySessionID retrieves a verification by its portal session ID
+func GetVerificationBySessionID(db *gorm.DB, sessionID string) (*models.Verification, error) {
+	var verification models.Verification
+	err := db.Preload("User").Where("session_id = ?", sessionID).First(&verification).Error
+	if err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// GetVerificationByProviderSession retrieves a verification by the session ID its provider
+// assigned. Verifications stored without a provider belong to Au10tix.
+func GetVerificationByProviderSession(db *gorm.DB, provider, providerSessionID string) (*models.Verification, error) {
+	providers := []string{provider}
+	if provider == "au10tix" {
+		providers = append(providers, "")
+	}
+
+	var verification models.Verification
+	err := db.Preload("User").
+		Where("au10tix_session_id = ? AND COALESCE(provider, '') IN ?", providerSessionID, providers).
+		First(&verification).Error
+	if err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
+
+// SaveVerification creates or updates a verification keyed by its session ID
+func SaveVerification(db *gorm.DB, verification *models.Verification) error {
+	if verification.ID == 0 {
+		var existing models.Verification
+		err := db.Select("id", "created_at").Where("session_id = ?", verification.SessionID).First(&existing).Error
+		if err == nil {
+			verification.ID = existing.ID
+			verification.CreatedAt = existing.CreatedAt
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return db.Omit("User").Save(verification).Error
+}
+
+// VerificationQuery narrows the verifications returned by ListVerifications
+type VerificationQuery struct {
+	Statuses     []string
+	Email        string
+	CreatedAfter time.Time
+	Limit        int
+}
+
+// ListVerifications retrieves verifications matching the query, newest first
+func ListVerifications(db *gorm.DB, q VerificationQuery) ([]models.Verification, error) {
+	query := db.Preload("User").Order("verifications.created_at DESC")
+	if len(q.Statuses) > 0 {
+		query = query.Where("verifications.status IN ?", q.Statuses)
+	}
+	if q.Email != "" {
+		query = query.Joins("JOIN users ON users.id = verifications.user_id").
+			Where("LOWER(users.email) = ?", strings.ToLower(q.Email))
+	}
+	if !q.CreatedAfter.IsZero() {
+		query = query.Where("verifications.created_at > ?", q.CreatedAfter)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	var verifications []models.Verification
+	err := query.Find(&verifications).Error
+	return verifications, err
+}
+
+// ExpireVerificationsBefore marks unfinished verifications created before the given time as expired.
+// Rows are kept so that finished and abandoned checks stay available for lookups.
+func ExpireVerificationsBefore(db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.Model(&models.Verification{}).
+		Where("created_at < ? AND status IN ?", cutoff, []string{models.VerificationStatusPending, models.VerificationStatusInProgress}).
+		Update("status", models.VerificationStatusExpired)
+	return result.RowsAffected, result.Error
+}
+
+// GetEnrollmentFlow retrieves an enrollment flow by its flow ID
+func GetEnrollmentFlow(db *gorm.DB, flowID string) (*models.EnrollmentFlow, error) {
+	var flow models.EnrollmentFlow
+	if err := db.Where("flow_id = ?", flowID).First(&flow).Error; err != nil {
+		return nil, err
+	}
+	return &flow, nil
+}
+
+// SaveEnrollmentFlow creates or updates an enrollment flow, keyed by flow ID
+func SaveEnrollmentFlow(db *gorm.DB, flow *models.EnrollmentFlow) error {
+	if flow.ID == 0 {
+		var existing models.EnrollmentFlow
+		err := db.Select("id", "created_at").Where("flow_id = ?", flow.FlowID).First(&existing).Error
+		if err == nil {
+			flow.ID = existing.ID
+			flow.CreatedAt = existing.CreatedAt
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return db.Save(flow).Error
+}
+
+// DeleteStaleEnrollmentFlows removes enrollment flows last updated before the given time
+func DeleteStaleEnrollmentFlows(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("updated_at < ?", before).Delete(&models.EnrollmentFlow{})
+	return result.RowsAffected, result.Error
+}
+
+// GetSDOCredential retrieves a stored SDO credential by its credential ID
+func GetSDOCredential(db *gorm.DB, credentialID string) (*models.SDOCredential, error) {
+	var credential models.SDOCredential
+	if err := db.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// CreateSDOCredential stores a new SDO credential
+func CreateSDOCredential(db *gorm.DB, credential *models.SDOCredential) error {
+	return db.Create(credential).Error
+}
+
+// RevokeSDOCredential marks an SDO credential as revoked; revoking twice keeps the first time
+func RevokeSDOCredential(db *gorm.DB, credentialID string, revokedAt time.Time) error {
+	return db.Model(&models.SDOCredential{}).
+		Where("credential_id = ? AND revoked_at IS NULL", credentialID).
+		Update("revoked_at", revokedAt).Error
+}
+
+// DeleteStaleSDOCredentials removes SDO credentials that expired or were revoked before the given time
+func DeleteStaleSDOCredentials(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("expires_at < ? OR revoked_at < ?", before, before).Delete(&models.SDOCredential{})
+	return result.RowsAffected, result.Error
+}
+
+// CreateAPIToken records a newly issued API token
+func CreateAPIToken(db *gorm.DB, token *models.APIToken) error {
+	return db.Create(token).Error
+}
+
+// GetAPIToken retrieves an issued API token by its token ID
+func GetAPIToken(db *gorm.DB, tokenID string) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := db.Where("token_id = ?", tokenID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListAPITokens returns issued API tokens, newest first
+func ListAPITokens(db *gorm.DB) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := db.Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeAPIToken marks an API token as revoked; revoking twice keeps the first revocation
+func RevokeAPIToken(db *gorm.DB, tokenID, revokedBy string, revokedAt time.Time) (bool, error) {
+	result := db.Model(&models.APIToken{}).
+		Where("token_id = ? AND revoked_at IS NULL", tokenID).
+		Updates(map[string]interface{}{"revoked_at": revokedAt, "revoked_by": revokedBy})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListAPISigningKeys returns the API token signing keys, newest first
+func ListAPISigningKeys(db *gorm.DB) ([]models.APISigningKey, error) {
+	var keys []models.APISigningKey
+	err := db.Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RotateAPISigningKey stores a new signing key and retires the keys it replaces
+func RotateAPISigningKey(db *gorm.DB, key *models.APISigningKey) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APISigningKey{}).
+			Where("retired_at IS NULL").
+			Update("retired_at", key.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Create(key).Error
+	})
+}
+
+// DeleteRetiredAPISigningKeys removes keys retired before the given time
+func DeleteRetiredAPISigningKeys(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("retired_at < ?", before).Delete(&models.APISigningKey{})
+	return result.RowsAffected, result.Error
+}
+
+// AppendAuditEvent links the event to the end of the audit chain and stores it. The unique
+// sequence makes a concurrent append from another instance fail instead of forking the chain.
+func AppendAuditEvent(db *gorm.DB, event *models.AuditEvent) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var last []models.AuditEvent
+		if err := tx.Order("sequence DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+
+		event.Sequence, event.PrevHash = 1, ""
+		if len(last) > 0 {
+			event.Sequence = last[0].Sequence + 1
+			event.PrevHash = last[0].Hash
+		}
+		event.Hash = event.ComputeHash()
+		return tx.Create(event).Error
+	})
+}
+
+// AuditQuery filters audit events. Action matches exactly, or as a prefix when it ends in "*".
+type AuditQuery struct {
+	Actor     string
+	Action    string
+	Target    string
+	Outcome   string
+	RequestID string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// apply adds the query's filters to a gorm query
+func (q AuditQuery) apply(query *gorm.DB) *gorm.DB {
+	if q.Actor != "" {
+		query = query.Where("LOWER(actor) = ?", strings.ToLower(q.Actor))
+	}
+	if prefix, ok := strings.CutSuffix(q.Action, "*"); ok {
+		query = query.Where("action LIKE ?", prefix+"%")
+	} else if q.Action != "" {
+		query = query.Where("action = ?", q.Action)
+	}
+	if q.Target != "" {
+		query = query.Where("LOWER(target) = ?", strings.ToLower(q.Target))
+	}
+	if q.Outcome != "" {
+		query = query.Where("outcome = ?", q.Outcome)
+	}
+	if q.RequestID != "" {
+		query = query.Where("request_id = ?", q.RequestID)
+	}
+	if !q.From.IsZero() {
+		query = query.Where("occurred_at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		query = query.Where("occurred_at < ?", q.To)
+	}
+	return query
+}
+
+// ListAuditEvents returns one page of matching events, newest first, with the total match count
+func ListAuditEvents(db *gorm.DB, q AuditQuery) ([]models.AuditEvent, int64, error) {
+	var total int64
+	if err := q.apply(db.Model(&models.AuditEvent{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query := q.apply(db).Order("sequence DESC")
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	if q.Offset > 0 {
+		query = query.Offset(q.Offset)
+	}
+	var events []models.AuditEvent
+	err := query.Find(&events).Error
+	return events, total, err
+}
+
+// EachAuditEvent calls fn for every matching event in chain order, loading them in batches
+func EachAuditEvent(db *gorm.DB, q AuditQuery, fn func(*models.AuditEvent) error) error {
+	var batch []models.AuditEvent
+	return q.apply(db).Order("sequence ASC").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// AuditChainError describes the first audit event that does not fit the hash chain
+type AuditChainError struct {
+	Sequence uint64
+	Reason   string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at sequence %d: %s", e.Sequence, e.Reason)
+}
+
+// VerifyAuditChain recomputes the hash chain and returns the number of events checked. A
+// tampered, inserted or missing event is reported as an *AuditChainError.
+func VerifyAuditChain(db *gorm.DB) (int, error) {
+	checked := 0
+	var previous *models.AuditEvent
+	err := EachAuditEvent(db, AuditQuery{}, func(event *models.AuditEvent) error {
+		expectedSequence, expectedPrev := uint64(1), ""
+		if previous != nil {
+			expectedSequence, expectedPrev = previous.Sequence+1, previous.Hash
+		}
+		switch {
+		case event.Sequence != expectedSequence:
+			return &AuditChainError{Sequence: event.Sequence, Reason: fmt.Sprintf("expected sequence %d", expectedSequence)}
+		case event.PrevHash != expectedPrev:
+			return &AuditChainError{Sequence: event.Sequence, Reason: "previous hash does not match"}
+		case event.ComputeHash() != event.Hash:
+			return &AuditChainError{Sequence: event.Sequence, Reason: "content does not match its hash"}
+		}
+		clone := *event
+		previous = &clone
+		checked++
+		return nil
+	})
+	return checked, err
+}
+
+// operatorRoles are the roles that can sign in to the portal
+var operatorRoles = []string{models.RoleAdmin, models.RoleHelpdesk, models.RoleAuditor}
+
+// GetPortalUser retrieves a portal operator by email
+func GetPortalUser(db *gorm.DB, email string) (*models.User, error) {
+	var user models.User
+	err := db.Where("LOWER(email) = ? AND role IN ?", strings.ToLower(strings.TrimSpace(email)), operatorRoles).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by primary key
+func GetUserByID(db *gorm.DB, id uint) (*models.User, error) {
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CountPortalUsers returns the number of users that can log in to the portal
+func CountPortalUsers(db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&models.User{}).Where("role IN ?", operatorRoles).Count(&count).Error
+	return count, err
+}
+
+// ListPortalUsers returns all users that can log in to the portal, ordered by email
+func ListPortalUsers(db *gorm.DB) ([]models.User, error) {
+	var users []models.User
+	err := db.Where("role IN ?", operatorRoles).Order("email").Find(&users).Error
+	return users, err
+}
+
+// CountPortalUsersWithRole returns the number of portal users with the given role
+func CountPortalUsersWithRole(db *gorm.DB, role string) (int64, error) {
+	var count int64
+	err := db.Model(&models.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+// GetUserByExternalID retrieves a user by the subject issued by an identity provider
+func GetUserByExternalID(db *gorm.DB, provider, externalID string) (*models.User, error) {
+	var user models.User
+	err := db.Where("identity_provider = ? AND external_id = ?", provider, externalID).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SaveUser persists all fields of an existing user
+func SaveUser(db *gorm.DB, user *models.User) error {
+	return db.Save(user).Error
+}
+
+// BootstrapAdmin creates the first portal operator. It does nothing and returns false when a
+// portal operator already exists, so it is safe to run on every deployment.
+func BootstrapAdmin(db *gorm.DB, email, password, firstName, lastName string) (*models.User, bool, error) {
+	count, err := CountPortalUsers(db)
+	if err != nil {
+		return nil, false, err
+	}
+	if count > 0 {
+		return nil, false, nil
+	}
+	if err := models.ValidatePassword(password); err != nil {
+		return nil, false, err
+	}
+	if firstName == "" {
+		firstName = "Portal"
+	}
+	if lastName == "" {
+		lastName = "Admin"
+	}
+
+	user, err := FindOrCreateUser(db, strings.TrimSpace(email), firstName, lastName)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, false, err
+	}
+	user.Role = models.RoleAdmin
+	if err := SaveUser(db, user); err != nil {
+		return nil, false, err
+	}
+
+	log.Printf("✅ Bootstrapped portal admin: %s", user.Email)
+	return user, true, nil
+}
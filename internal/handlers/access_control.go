@@ -0,0 +1,167 @@
+// File: internal/handlers/access_control.go - Role-based access control for portal routes
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Permission names an action that can be granted to a role
+type Permission string
+
+// Portal permissions
+const (
+	PermViewDashboard     Permission = "dashboard:view"
+	PermViewConfig        Permission = "config:view"
+	PermManageConfig      Permission = "config:manage"
+	PermManageAccounts    Permission = "accounts:manage"
+	PermChangePassword    Permission = "accounts:change_password"
+	PermUseSDO            Permission = "sdo:session"
+	PermConnectSDO        Permission = "sdo:connect"
+	PermSearchUsers       Permission = "sdo:search"
+	PermSendInvitations   Permission = "sdo:invite"
+	PermStartVerification Permission = "verification:start"
+	PermViewVerification  Permission = "verification:view"
+	PermListReviews       Permission = "verification:list_reviews"
+	PermReviewIdentity    Permission = "verification:review"
+	PermManageAPITokens   Permission = "api_tokens:manage"
+	PermViewAuditLog      Permission = "audit:view"
+)
+
+// rolePermissions lists what each role may do. Visitors without a portal login act as
+// self-service end users; their enrollment steps are further limited by the enrollment flow.
+// Only operators may connect to SDO with their own credentials; self-service visitors get the
+// portal's server-held service session.
+var rolePermissions = map[string][]Permission{
+	models.RoleAdmin: {
+		PermViewDashboard, PermViewConfig, PermManageConfig, PermManageAccounts, PermChangePassword,
+		PermUseSDO, PermConnectSDO, PermSearchUsers, PermSendInvitations, PermStartVerification, PermViewVerification,
+		PermListReviews, PermReviewIdentity, PermManageAPITokens, PermViewAuditLog,
+	},
+	models.RoleHelpdesk: {
+		PermViewDashboard, PermChangePassword, PermUseSDO, PermConnectSDO, PermSearchUsers, PermSendInvitations,
+		PermStartVerification, PermViewVerification, PermListReviews, PermReviewIdentity,
+	},
+	models.RoleAuditor: {
+		PermViewDashboard, PermViewConfig, PermChangePassword, PermViewVerification, PermListReviews,
+		PermViewAuditLog,
+	},
+	models.RoleSelfService: {
+		PermUseSDO, PermSearchUsers, PermSendInvitations, PermStartVerification, PermViewVerification,
+	},
+}
+
+// RoleHasPermission reports whether the role grants the permission
+func RoleHasPermission(role string, permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// isOperatorRequest reports whether access control admitted the request for a portal operator or
+// an API client rather than a self-service visitor
+func isOperatorRequest(c *gin.Context) bool {
+	role := c.GetString("role")
+	return role != "" && role != models.RoleSelfService
+}
+
+// AccessControl enforces per-route permissions based on the portal user in the session, or on
+// the scopes of an API token when the request carries one
+type AccessControl struct {
+	db        *gorm.DB
+	apiTokens *APITokens
+}
+
+// NewAccessControl creates the access control middleware factory
+func NewAccessControl(db *gorm.DB) *AccessControl {
+	return &AccessControl{db: db}
+}
+
+// SetAPITokens lets machine clients authenticate with API tokens instead of a portal session
+func (a *AccessControl) SetAPITokens(tokens *APITokens) {
+	a.apiTokens = tokens
+}
+
+// currentUser returns the portal operator logged in to this session, or nil for visitors.
+// The user is reloaded on every request so role changes take effect immediately.
+func (a *AccessControl) currentUser(c *gin.Context) *models.User {
+	session := sessions.Default(c)
+	if authenticated, _ := session.Get("authenticated").(bool); !authenticated {
+		return nil
+	}
+	userID, ok := session.Get("user_id").(uint)
+	if !ok || a.db == nil {
+		return nil
+	}
+
+	user, err := database.GetUserByID(a.db, userID)
+	if err != nil || !user.IsPortalOperator() {
+		log.Printf("⚠️ Session for portal user %d is no longer valid: %v", userID, err)
+		session.Clear()
+		if err := session.Save(); err != nil {
+			log.Printf("⚠️ Failed to clear session: %v", err)
+		}
+		return nil
+	}
+	return user
+}
+
+// Require returns middleware that allows the request only when the caller's role grants the permission
+func (a *AccessControl) Require(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Bearer tokens are checked on their own; a cookie sent alongside is ignored
+		if _, ok := bearerToken(c); ok && a.apiTokens != nil {
+			if a.apiTokens.authorize(c, permission) {
+				c.Next()
+			}
+			return
+		}
+
+		role := models.RoleSelfService
+		username := "anonymous"
+		if user := a.currentUser(c); user != nil {
+			role = user.Role
+			username = user.Email
+			c.Set("user", user.Email)
+			c.Set("user_id", user.ID)
+		}
+		c.Set("role", role)
+
+		if RoleHasPermission(role, permission) {
+			c.Next()
+			return
+		}
+
+		log.Printf("🚫 Access denied: %s (%s) lacks %s for %s %s from IP: %s",
+			username, role, permission, c.Request.Method, c.Request.URL.Path, c.ClientIP())
+
+		if role == models.RoleSelfService {
+			if c.Request.Method == http.MethodGet && !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				c.Redirect(http.StatusFound, "/login")
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Authentication required",
+			})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "You do not have permission to perform this action",
+		})
+	}
+}
@@ -0,0 +1,634 @@
+// File: internal/handlers/api_tokens.go - Signed API tokens for machine clients
+package handlers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"self-service-portal/internal/config"
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// API token signing algorithms selectable through API_TOKEN_ALGORITHM
+const (
+	APITokenEdDSA = "EdDSA"
+	APITokenRS256 = "RS256"
+)
+
+const (
+	// apiTokenLeeway tolerates clock skew between the portal instances and their clients
+	apiTokenLeeway = 30 * time.Second
+	// apiSigningKeyRefresh is how often other instances' key rotations are picked up
+	apiSigningKeyRefresh = time.Minute
+	// defaultAPITokenTTL applies when a token is issued without a lifetime
+	defaultAPITokenTTL = 30 * 24 * time.Hour
+	// apiClientRole is set as the caller's role for requests authenticated by an API token
+	apiClientRole = "api_client"
+)
+
+// apiTokenScopes are the permissions that may be granted to machine clients. API clients are
+// operators, so invitations and verification starts are not bound to an enrollment flow; the
+// identity cross-check still applies to the verification an invitation names.
+var apiTokenScopes = []Permission{
+	PermUseSDO, PermSearchUsers, PermSendInvitations, PermStartVerification, PermViewVerification, PermViewAuditLog,
+}
+
+// ErrAPITokenInvalid is returned for tokens that are malformed, badly signed, expired or revoked
+var ErrAPITokenInvalid = errors.New("invalid API token")
+
+// JWTClaims are the claims of a portal API token. Scope holds space separated permissions.
+// Tokens from SDOAuthJWT name the operator's stored SDO credential in SDOTokenRef; tokens for
+// service accounts carry no reference and use the portal's SDO service account.
+type JWTClaims struct {
+	jwt.Claims
+	Scope       string `json:"scope"`
+	Email       string `json:"email,omitempty"`
+	SDOURL      string `json:"sdo_url,omitempty"`
+	SDOTokenRef string `json:"sdo_token_ref,omitempty"`
+}
+
+// HasScope reports whether the token grants the permission
+func (c *JWTClaims) HasScope(scope Permission) bool {
+	for _, granted := range strings.Fields(c.Scope) {
+		if granted == string(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenRequest describes a token to issue
+type APITokenRequest struct {
+	Name        string
+	Subject     string
+	Scopes      []Permission
+	TTL         time.Duration
+	IssuedBy    string
+	Email       string
+	SDOURL      string
+	SDOTokenRef string
+}
+
+// apiSigningKey is a loaded signing key pair
+type apiSigningKey struct {
+	id        string
+	algorithm string
+	private   crypto.Signer
+	public    jose.JSONWebKey
+	retired   bool
+}
+
+// APITokens issues and verifies API tokens. Signing keys are kept in the database with the
+// private key encrypted, so every portal instance signs with the same current key and
+// accepts tokens signed by keys it has rotated away from.
+type APITokens struct {
+	db        *gorm.DB
+	issuer    string
+	audience  string
+	algorithm string
+	maxTTL    time.Duration
+
+	mu       sync.Mutex
+	keys     []*apiSigningKey
+	loadedAt time.Time
+}
+
+// NewAPITokens creates the token service configured by cfg
+func NewAPITokens(db *gorm.DB, cfg *config.Config) (*APITokens, error) {
+	algorithm := cfg.APITokenAlgorithm
+	switch {
+	case strings.EqualFold(algorithm, APITokenEdDSA):
+		algorithm = APITokenEdDSA
+	case strings.EqualFold(algorithm, APITokenRS256):
+		algorithm = APITokenRS256
+	default:
+		return nil, fmt.Errorf("unsupported API_TOKEN_ALGORITHM %q (use %s or %s)", cfg.APITokenAlgorithm, APITokenEdDSA, APITokenRS256)
+	}
+	if db == nil {
+		return nil, fmt.Errorf("API tokens require a database connection")
+	}
+
+	return &APITokens{
+		db:        db,
+		issuer:    cfg.APITokenIssuer,
+		audience:  cfg.APITokenAudience,
+		algorithm: algorithm,
+		maxTTL:    cfg.APITokenMaxTTL,
+	}, nil
+}
+
+// loadKeysLocked reads the signing keys from the database when the cache is stale or forced
+func (t *APITokens) loadKeysLocked(force bool) error {
+	if !force && t.keys != nil && time.Since(t.loadedAt) < apiSigningKeyRefresh {
+		return nil
+	}
+
+	records, err := database.ListAPISigningKeys(t.db)
+	if err != nil {
+		return fmt.Errorf("failed to load API signing keys: %w", err)
+	}
+
+	keys := make([]*apiSigningKey, 0, len(records))
+	for i := range records {
+		key, err := parseAPISigningKey(&records[i])
+		if err != nil {
+			log.Printf("⚠️ Skipping API signing key %s: %v", records[i].KeyID, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	t.keys = keys
+	t.loadedAt = time.Now()
+	return nil
+}
+
+// parseAPISigningKey decrypts and parses a stored key pair
+func parseAPISigningKey(record *models.APISigningKey) (*apiSigningKey, error) {
+	privatePEM, err := openStoredSecret(record.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	return &apiSigningKey{
+		id:        record.KeyID,
+		algorithm: record.Algorithm,
+		private:   signer,
+		public: jose.JSONWebKey{
+			Key:       signer.Public(),
+			KeyID:     record.KeyID,
+			Algorithm: record.Algorithm,
+			Use:       "sig",
+		},
+		retired: record.RetiredAt != nil,
+	}, nil
+}
+
+// signingKey returns the current key for the configured algorithm, creating one when there is none
+func (t *APITokens) signingKey() (*apiSigningKey, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.loadKeysLocked(false); err != nil {
+		return nil, err
+	}
+	for _, key := range t.keys {
+		if !key.retired && key.algorithm == t.algorithm {
+			return key, nil
+		}
+	}
+	return t.rotateLocked()
+}
+
+// verificationKey returns the key with the given ID, reloading once for keys rotated in elsewhere
+func (t *APITokens) verificationKey(keyID string) (*apiSigningKey, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := t.loadKeysLocked(attempt > 0); err != nil {
+			log.Printf("❌ %v", err)
+			return nil, false
+		}
+		for _, key := range t.keys {
+			if key.id == keyID {
+				return key, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// RotateKey creates a new signing key and retires the current one. Tokens signed by the old
+// key stay valid until they expire.
+func (t *APITokens) RotateKey() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key, err := t.rotateLocked()
+	if err != nil {
+		return "", err
+	}
+	return key.id, nil
+}
+
+func (t *APITokens) rotateLocked() (*apiSigningKey, error) {
+	var signer crypto.Signer
+	switch t.algorithm {
+	case APITokenRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 3072)
+		if err != nil {
+			return nil, err
+		}
+		signer = key
+	default:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer = key
+	}
+
+	public := jose.JSONWebKey{Key: signer.Public()}
+	thumbprint, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	keyID := base64.RawURLEncoding.EncodeToString(thumbprint[:12])
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealStoredSecret(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})))
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.APISigningKey{
+		KeyID:      keyID,
+		Algorithm:  t.algorithm,
+		PrivateKey: sealed,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		CreatedAt:  time.Now(),
+	}
+	if err := database.RotateAPISigningKey(t.db, record); err != nil {
+		return nil, fmt.Errorf("failed to store API signing key: %w", err)
+	}
+	log.Printf("🔑 Rotated API token signing key: %s (%s)", keyID, t.algorithm)
+
+	if err := t.loadKeysLocked(true); err != nil {
+		return nil, err
+	}
+	for _, key := range t.keys {
+		if key.id == keyID {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("API signing key %s could not be loaded", keyID)
+}
+
+// Issue signs a new token and records it so it can be listed and revoked
+func (t *APITokens) Issue(req APITokenRequest) (string, *models.APIToken, error) {
+	if req.Subject == "" || len(req.Scopes) == 0 {
+		return "", nil, fmt.Errorf("API tokens need a subject and at least one scope")
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !isAPITokenScope(scope) {
+			return "", nil, fmt.Errorf("scope %q cannot be granted to API tokens", scope)
+		}
+		scopes = append(scopes, string(scope))
+	}
+
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = defaultAPITokenTTL
+	}
+	if t.maxTTL > 0 && ttl > t.maxTTL {
+		ttl = t.maxTTL
+	}
+
+	key, err := t.signingKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.algorithm), Key: key.private},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", key.id),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create token signer: %w", err)
+	}
+
+	now := time.Now()
+	claims := JWTClaims{
+		Claims: jwt.Claims{
+			ID:        uuid.New().String(),
+			Issuer:    t.issuer,
+			Subject:   req.Subject,
+			Audience:  jwt.Audience{t.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Expiry:    jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Scope:       strings.Join(scopes, " "),
+		Email:       req.Email,
+		SDOURL:      req.SDOURL,
+		SDOTokenRef: req.SDOTokenRef,
+	}
+
+	raw, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign API token: %w", err)
+	}
+
+	record := &models.APIToken{
+		TokenID:   claims.ID,
+		Name:      req.Name,
+		Subject:   req.Subject,
+		Scopes:    claims.Scope,
+		KeyID:     key.id,
+		IssuedBy:  req.IssuedBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := database.CreateAPIToken(t.db, record); err != nil {
+		return "", nil, fmt.Errorf("failed to record API token: %w", err)
+	}
+
+	log.Printf("🎫 Issued API token %s for %s (scopes: %s, expires %s)", record.TokenID, req.Subject, claims.Scope, record.ExpiresAt.Format(time.RFC3339))
+	return raw, record, nil
+}
+
+// Verify checks the signature, issuer, audience, time claims and revocation of a token
+func (t *APITokens) Verify(raw string) (*JWTClaims, error) {
+	token, err := jwt.ParseSigned(raw, []jose.SignatureAlgorithm{jose.EdDSA, jose.RS256})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAPITokenInvalid, err)
+	}
+	if len(token.Headers) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one signature", ErrAPITokenInvalid)
+	}
+
+	header := token.Headers[0]
+	key, ok := t.verificationKey(header.KeyID)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrAPITokenInvalid, header.KeyID)
+	}
+	if header.Algorithm != key.algorithm {
+		return nil, fmt.Errorf("%w: algorithm %s does not match key %s", ErrAPITokenInvalid, header.Algorithm, key.id)
+	}
+
+	var claims JWTClaims
+	if err := token.Claims(key.public.Key, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAPITokenInvalid, err)
+	}
+	if claims.ID == "" || claims.IssuedAt == nil || claims.Expiry == nil {
+		return nil, fmt.Errorf("%w: jti, iat and exp are required", ErrAPITokenInvalid)
+	}
+	if err := claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:      t.issuer,
+		AnyAudience: jwt.Audience{t.audience},
+		Time:        time.Now(),
+	}, apiTokenLeeway); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAPITokenInvalid, err)
+	}
+
+	record, err := database.GetAPIToken(t.db, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: token %s is not on record", ErrAPITokenInvalid, claims.ID)
+	}
+	if record.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: token %s was revoked", ErrAPITokenInvalid, claims.ID)
+	}
+	return &claims, nil
+}
+
+// Revoke adds a token to the revocation list. It reports false when the token was unknown or
+// already revoked.
+func (t *APITokens) Revoke(tokenID, revokedBy string) (bool, error) {
+	revoked, err := database.RevokeAPIToken(t.db, tokenID, revokedBy, time.Now())
+	if err == nil && revoked {
+		log.Printf("🗑️ Revoked API token %s (by %s)", tokenID, revokedBy)
+	}
+	return revoked, err
+}
+
+// PurgeRetiredKeys deletes retired signing keys once no token they signed can still be valid
+func (t *APITokens) PurgeRetiredKeys() {
+	purged, err := database.DeleteRetiredAPISigningKeys(t.db, time.Now().Add(-t.maxTTL-apiTokenLeeway))
+	if err != nil {
+		log.Printf("❌ Failed to purge retired API signing keys: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("🧹 Purged %d retired API signing keys", purged)
+	}
+}
+
+// isAPITokenScope reports whether the permission may be granted to machine clients
+func isAPITokenScope(scope Permission) bool {
+	for _, allowed := range apiTokenScopes {
+		if scope == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(c *gin.Context) (string, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	return token, ok && token != ""
+}
+
+// Require returns middleware that admits requests with a valid API token granting the scope
+func (t *APITokens) Require(scope Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if t.authorize(c, scope) {
+			c.Next()
+		}
+	}
+}
+
+// authorize checks the request's API token. It aborts with 401 for a missing or invalid token
+// and with 403 when the token lacks the scope.
+func (t *APITokens) authorize(c *gin.Context, scope Permission) bool {
+	raw, ok := bearerToken(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Bearer realm="`+t.audience+`"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Authorization header required",
+		})
+		return false
+	}
+
+	claims, err := t.Verify(raw)
+	if err != nil {
+		log.Printf("🚫 API token rejected for %s %s from IP %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+		c.Header("WWW-Authenticate", `Bearer realm="`+t.audience+`", error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error":   "Invalid or expired token",
+		})
+		return false
+	}
+
+	if !claims.HasScope(scope) {
+		log.Printf("🚫 API token %s (%s) lacks scope %s for %s %s", claims.ID, claims.Subject, scope, c.Request.Method, c.Request.URL.Path)
+		c.Header("WWW-Authenticate", `Bearer realm="`+t.audience+`", error="insufficient_scope", scope="`+string(scope)+`"`)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Token does not grant " + string(scope),
+		})
+		return false
+	}
+
+	c.Set("jwt_claims", claims)
+	c.Set("user", claims.Subject)
+	c.Set("role", apiClientRole)
+	return true
+}
+
+// JWKS handles GET /.well-known/jwks.json with the public keys of current and retired signing keys
+func (t *APITokens) JWKS(c *gin.Context) {
+	t.mu.Lock()
+	err := t.loadKeysLocked(false)
+	keys := make([]jose.JSONWebKey, 0, len(t.keys))
+	for _, key := range t.keys {
+		keys = append(keys, key.public)
+	}
+	t.mu.Unlock()
+
+	if err != nil {
+		log.Printf("❌ %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Signing keys unavailable"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jose.JSONWebKeySet{Keys: keys})
+}
+
+// CreateToken handles POST /api/tokens and issues a token for a named service account.
+// The token is only returned in this response.
+func (t *APITokens) CreateToken(c *gin.Context) {
+	var req struct {
+		Name   string   `json:"name" binding:"required"`
+		Scopes []string `json:"scopes" binding:"required"`
+		TTL    string   `json:"ttl"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "ttl must be a positive duration such as 720h"})
+			return
+		}
+		ttl = parsed
+	}
+
+	scopes := make([]Permission, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !isAPITokenScope(Permission(scope)) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success":        false,
+				"error":          "Scope cannot be granted to API tokens: " + scope,
+				"allowed_scopes": apiTokenScopes,
+			})
+			return
+		}
+		scopes = append(scopes, Permission(scope))
+	}
+
+	name := strings.TrimSpace(req.Name)
+	setAuditTarget(c, "service:"+name)
+	addAuditDetail(c, "scopes", req.Scopes)
+	raw, record, err := t.Issue(APITokenRequest{
+		Name:     name,
+		Subject:  "service:" + name,
+		Scopes:   scopes,
+		TTL:      ttl,
+		IssuedBy: c.GetString("user"),
+	})
+	if err != nil {
+		log.Printf("❌ Failed to issue API token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to issue API token"})
+		return
+	}
+	addAuditDetail(c, "token_id", record.TokenID)
+	addAuditDetail(c, "expires_at", record.ExpiresAt)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":      true,
+		"token":        raw,
+		"token_type":   "Bearer",
+		"api_token":    record,
+		"expires_at":   record.ExpiresAt,
+		"jwks_uri":     "/.well-known/jwks.json",
+		"audience":     t.audience,
+		"token_issuer": t.issuer,
+	})
+}
+
+// ListTokens handles GET /api/tokens
+func (t *APITokens) ListTokens(c *gin.Context) {
+	tokens, err := database.ListAPITokens(t.db)
+	if err != nil {
+		log.Printf("❌ Failed to list API tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list API tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "tokens": tokens})
+}
+
+// RevokeToken handles DELETE /api/tokens/:id
+func (t *APITokens) RevokeToken(c *gin.Context) {
+	setAuditTarget(c, c.Param("id"))
+	revoked, err := t.Revoke(c.Param("id"), c.GetString("user"))
+	if err != nil {
+		log.Printf("❌ Failed to revoke API token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to revoke API token"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "API token not found or already revoked"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "API token revoked"})
+}
+
+// RotateSigningKey handles POST /api/tokens/keys/rotate
+func (t *APITokens) RotateSigningKey(c *gin.Context) {
+	keyID, err := t.RotateKey()
+	if err != nil {
+		log.Printf("❌ Failed to rotate API signing key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to rotate signing key"})
+		return
+	}
+	setAuditTarget(c, keyID)
+	addAuditDetail(c, "algorithm", t.algorithm)
+	c.JSON(http.StatusOK, gin.H{"success": true, "kid": keyID, "algorithm": t.algorithm})
+}
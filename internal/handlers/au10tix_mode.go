@@ -0,0 +1,323 @@
+// File: internal/handlers/au10tix_mode.go - Selection of the Au10tix backend by the configured mode
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"self-service-portal/internal/secrets"
+	"self-service-portal/internal/services/au10tix"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Au10tix modes, set as api.au10tix_mode in the portal configuration
+const (
+	Au10tixModeProduction = "production" // Au10tix with the configured token; fails closed without one
+	Au10tixModeSandbox    = "sandbox"    // The Au10tix staging API at api.au10tix_sandbox_url
+	Au10tixModeDemo       = "demo"       // The built-in demo provider with scripted results
+)
+
+// Au10tix authentication methods, set as auth.au10tix_auth_method in the portal configuration
+const (
+	Au10tixAuthToken             = "token"              // An access token pasted into the configuration
+	Au10tixAuthClientCredentials = "client_credentials" // Tokens fetched from the issuer with the client credentials
+)
+
+// demoCapturePath serves the capture page the demo provider links to
+const demoCapturePath = "/verification/demo"
+
+// demoProcessingTime is how long the demo provider takes to produce a result
+const demoProcessingTime = 15 * time.Second
+
+// Errors that make verification unavailable in production and sandbox mode
+var (
+	ErrAu10tixTokenMissing = errors.New("Au10tix token is not configured")
+	ErrAu10tixTokenInvalid = errors.New("Au10tix token is invalid")
+	ErrAu10tixTokenExpired = errors.New("Au10tix token has expired")
+	ErrAu10tixNoAPIURL     = errors.New("Au10tix API URL is not configured")
+	ErrAu10tixNoToken      = errors.New("Au10tix access token could not be obtained")
+)
+
+// ErrAu10tixDemoInProduction refuses demo mode, which approves verifications without Au10tix,
+// on a portal running with ENVIRONMENT=production
+var ErrAu10tixDemoInProduction = errors.New("Au10tix demo mode cannot be used when ENVIRONMENT=production")
+
+// isAu10tixMode reports whether the value names a mode
+func isAu10tixMode(mode string) bool {
+	return mode == Au10tixModeProduction || mode == Au10tixModeSandbox || mode == Au10tixModeDemo
+}
+
+// au10tixMode returns the configured mode. An unset mode is production, so nothing runs
+// against a sandbox or the demo provider unless it was chosen explicitly.
+func au10tixMode(config *PortalConfig) string {
+	if config.API.Au10tixMode == "" {
+		return Au10tixModeProduction
+	}
+	return config.API.Au10tixMode
+}
+
+// isAu10tixAuthMethod reports whether the value names an authentication method
+func isAu10tixAuthMethod(method string) bool {
+	return method == Au10tixAuthToken || method == Au10tixAuthClientCredentials
+}
+
+// au10tixAuthMethod returns the configured authentication method; unset means a pasted token
+func au10tixAuthMethod(config *PortalConfig) string {
+	if config.Auth.Au10tixAuthMethod == "" {
+		return Au10tixAuthToken
+	}
+	return config.Auth.Au10tixAuthMethod
+}
+
+// au10tixBackend is the Au10tix API selected by the configured mode
+type au10tixBackend struct {
+	mode   string
+	api    au10tix.API
+	source string             // Secret provider that supplied the token, "demo" in demo mode
+	token  *Au10tixJWTPayload // Decoded token, nil in demo mode
+}
+
+// au10tixBackend resolves the API for the configured mode. Production and sandbox mode fail
+// closed when the token is missing, unreadable or expired; there is no fallback token.
+func (h *VerificationHandler) au10tixBackend(config *PortalConfig) (*au10tixBackend, error) {
+	mode := au10tixMode(config)
+	switch mode {
+	case Au10tixModeDemo:
+		if h.configHandler.production {
+			return nil, ErrAu10tixDemoInProduction
+		}
+		return &au10tixBackend{mode: mode, api: h.demo, source: "demo"}, nil
+	case Au10tixModeProduction, Au10tixModeSandbox:
+	default:
+		return nil, fmt.Errorf("unknown Au10tix mode %q", mode)
+	}
+
+	if au10tixAuthMethod(config) == Au10tixAuthClientCredentials {
+		return h.au10tixClientCredentialsBackend(config, mode)
+	}
+
+	token, source, err := h.configHandler.Au10tixToken()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := h.configHandler.VerifyAu10tixToken(context.Background(), config, token)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > payload.EXP {
+		return nil, fmt.Errorf("%w (expired %s)", ErrAu10tixTokenExpired, time.Unix(payload.EXP, 0).Format("2006-01-02 15:04:05"))
+	}
+
+	baseURL, err := au10tixAPIURL(config, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &au10tixBackend{mode: mode, api: h.au10tixClient(config, baseURL, token), source: source, token: payload}, nil
+}
+
+// au10tixClient creates an API client that trusts the configured CA bundle
+func (h *VerificationHandler) au10tixClient(config *PortalConfig, baseURL, token string) *au10tix.Client {
+	timeout := time.Duration(config.API.APITimeout) * time.Second
+	client := au10tix.NewClient(baseURL, token, timeout, config.API.APIRetries)
+	client.Client = h.configHandler.au10tixHTTPClient(timeout)
+	return client
+}
+
+// au10tixClientCredentialsBackend uses the token cached by the configuration handler's token
+// manager. The client renews the token itself when Au10tix rejects it.
+func (h *VerificationHandler) au10tixClientCredentialsBackend(config *PortalConfig, mode string) (*au10tixBackend, error) {
+	tokens := h.configHandler.au10tixTokens
+	token, err := tokens.Token(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAu10tixNoToken, err)
+	}
+
+	// Issued tokens carry the same claims as pasted ones and are verified the same way
+	payload, err := h.configHandler.VerifyAu10tixToken(context.Background(), config, token)
+	if err != nil {
+		return nil, err
+	}
+	baseURL, err := au10tixAPIURL(config, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	client := h.au10tixClient(config, baseURL, "")
+	client.Tokens = tokens
+	return &au10tixBackend{mode: mode, api: client, source: Au10tixAuthClientCredentials, token: payload}, nil
+}
+
+// au10tixClientCredentials assembles the client credentials for the token manager. The issuer
+// defaults to the iss claim of the pasted token, the authorization server that issued it.
+func (h *ConfigHandler) au10tixClientCredentials(ctx context.Context) (au10tix.ClientCredentials, error) {
+	config, err := h.LoadConfig()
+	if err != nil {
+		return au10tix.ClientCredentials{}, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	credentials := au10tix.ClientCredentials{
+		Issuer: config.Auth.Au10tixIssuer,
+		Scopes: strings.Fields(config.Auth.Au10tixScopes),
+	}
+	for name, value := range map[string]*string{
+		secrets.Au10tixClientID:     &credentials.ClientID,
+		secrets.Au10tixClientSecret: &credentials.ClientSecret,
+		secrets.Au10tixPrivateKey:   &credentials.PrivateKey,
+	} {
+		*value, err = h.secretStore.Get(ctx, name)
+		if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			return au10tix.ClientCredentials{}, fmt.Errorf("failed to load %s: %w", name, err)
+		}
+	}
+
+	if credentials.Issuer == "" {
+		if token, _, err := h.Au10tixToken(); err == nil {
+			// Only an issuer that would be trusted to sign tokens receives the credentials
+			if payload, err := h.DecodeAu10tixToken(token); err == nil && au10tixIssuerTrusted(config, payload.ISS) {
+				credentials.Issuer = payload.ISS
+			}
+		}
+	}
+	return credentials, nil
+}
+
+// Au10tixStatus handles GET /api/au10tix/status: the mode, the authentication method and the
+// state of the token in use, never the token itself
+func (h *VerificationHandler) Au10tixStatus(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load configuration",
+		})
+		return
+	}
+
+	mode := au10tixMode(config)
+	method := au10tixAuthMethod(config)
+	status := gin.H{
+		"success":     true,
+		"mode":        mode,
+		"auth_method": method,
+		"timestamp":   time.Now().Unix(),
+	}
+	if mode == Au10tixModeDemo {
+		c.JSON(http.StatusOK, status)
+		return
+	}
+
+	status["allowed_hosts"] = au10tixAllowedHosts(config)
+	status["jwks_source"] = "issuer"
+	if config.API.Au10tixJWKSFile != "" {
+		status["jwks_source"] = "file"
+	}
+
+	if method == Au10tixAuthClientCredentials {
+		status["client_credentials"] = h.configHandler.au10tixTokens.Status()
+		c.JSON(http.StatusOK, status)
+		return
+	}
+
+	token := gin.H{"status": "missing"}
+	if raw, source, err := h.configHandler.Au10tixToken(); err == nil {
+		token["source"] = source
+		token["signature"] = "verified"
+		payload, err := h.configHandler.VerifyAu10tixToken(c.Request.Context(), config, raw)
+		if err != nil {
+			token["signature"] = "invalid"
+			token["signature_error"] = err.Error()
+			payload, _ = h.configHandler.DecodeAu10tixToken(raw)
+		}
+		if payload == nil {
+			token["status"] = "invalid"
+		} else {
+			token["status"] = "active"
+			if err != nil {
+				token["status"] = "untrusted"
+			} else if time.Now().Unix() > payload.EXP {
+				token["status"] = "expired"
+			}
+			token["issuer"] = payload.ISS
+			token["organization"] = payload.ClientOrganizationName
+			token["token_expires_at"] = payload.EXP
+		}
+	} else if !errors.Is(err, ErrAu10tixTokenMissing) {
+		token["status"] = "error"
+		token["last_error"] = err.Error()
+	}
+	status["token"] = token
+	c.JSON(http.StatusOK, status)
+}
+
+// au10tixBaseURL returns the API URL for the mode: the sandbox URL in sandbox mode, otherwise
+// the URL embedded in the token and then the configured base URL
+func au10tixBaseURL(config *PortalConfig, payload *Au10tixJWTPayload) string {
+	if au10tixMode(config) == Au10tixModeSandbox {
+		if config.API.Au10tixSandboxURL != "" {
+			return config.API.Au10tixSandboxURL
+		}
+		return au10tix.StagingBaseURL
+	}
+	if payload != nil && payload.APIUrl != "" {
+		return payload.APIUrl
+	}
+	return config.API.Au10tixBaseURL
+}
+
+// DemoCapturePage handles GET /verification/demo/:id, the capture page of the demo provider.
+// It only exists in demo mode and never in production.
+func (h *VerificationHandler) DemoCapturePage(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil || au10tixMode(config) != Au10tixModeDemo || h.configHandler.production {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	scenario := h.demo.Scenario(c.Param("id"))
+	if scenario == "" {
+		c.String(http.StatusNotFound, "Demo session not found")
+		return
+	}
+
+	page := strings.NewReplacer(
+		"{{SCENARIO}}", html.EscapeString(scenario),
+		"{{SECONDS}}", fmt.Sprint(int(h.demo.ProcessingTime().Seconds())),
+	).Replace(demoCapturePage)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// demoCapturePage stands in for the Au10tix capture experience in demo mode
+const demoCapturePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Demo Verification - Self Service Portal</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+</head>
+<body class="bg-light">
+    <div class="container py-5" style="max-width: 560px;">
+        <div class="alert alert-warning">
+            <strong>Demo mode.</strong> This portal is not connected to Au10tix. No documents or
+            photos are captured and no real identity check takes place.
+        </div>
+        <div class="card shadow-sm">
+            <div class="card-body">
+                <h5 class="card-title">Identity verification (demo)</h5>
+                <p class="card-text">This session plays the <code>{{SCENARIO}}</code> scenario. Its
+                result will be ready about {{SECONDS}} seconds after the session was started.</p>
+                <p class="card-text text-muted small">Put <code>fail</code>, <code>review</code>,
+                <code>expired</code> or <code>mismatch</code> in the email address or last name to
+                play another scenario.</p>
+            </div>
+        </div>
+    </div>
+</body>
+</html>`
@@ -0,0 +1,151 @@
+// File: internal/handlers/au10tix_trust.go - Verification of Au10tix tokens, API hosts and TLS trust
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"self-service-portal/internal/services/au10tix"
+)
+
+// Errors for tokens and URLs the portal refuses to use
+var (
+	ErrAu10tixSignature      = errors.New("Au10tix token signature could not be verified")
+	ErrAu10tixHostNotAllowed = errors.New("Au10tix API host is not allowed")
+)
+
+// au10tixAllowedHosts returns the hosts bearer tokens may be sent to
+func au10tixAllowedHosts(config *PortalConfig) []string {
+	if len(config.API.Au10tixAllowedHosts) > 0 {
+		return config.API.Au10tixAllowedHosts
+	}
+	return au10tix.DefaultAllowedHosts
+}
+
+// hostSetting reads a host list from a save-config request, either a JSON array or a string
+// separated by commas or whitespace as the configuration form sends it
+func hostSetting(value interface{}) ([]string, bool) {
+	var hosts []string
+	switch v := value.(type) {
+	case string:
+		hosts = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' })
+	case []interface{}:
+		hosts = claimStrings(v)
+	default:
+		return nil, false
+	}
+
+	cleaned := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			cleaned = append(cleaned, host)
+		}
+	}
+	return cleaned, true
+}
+
+// au10tixIssuerTrusted reports whether tokens of the issuer may be verified with its keys: the
+// configured client-credentials issuer, or an https issuer on one of the trusted issuer hosts
+func au10tixIssuerTrusted(config *PortalConfig, issuer string) bool {
+	if configured := strings.TrimSuffix(config.Auth.Au10tixIssuer, "/"); configured != "" && issuer == configured {
+		return true
+	}
+	hosts := config.API.Au10tixIssuerHosts
+	if len(hosts) == 0 {
+		hosts = au10tix.DefaultIssuerHosts
+	}
+	return au10tix.HostAllowed(issuer, hosts)
+}
+
+// au10tixAPIURL returns the API URL for the mode and refuses hosts outside the allowlist, so a
+// token naming another apiUrl cannot send the bearer token elsewhere
+func au10tixAPIURL(config *PortalConfig, payload *Au10tixJWTPayload) (string, error) {
+	baseURL := au10tixBaseURL(config, payload)
+	if baseURL == "" {
+		return "", ErrAu10tixNoAPIURL
+	}
+	if !au10tix.HostAllowed(baseURL, au10tixAllowedHosts(config)) {
+		return "", fmt.Errorf("%w: %s", ErrAu10tixHostNotAllowed, baseURL)
+	}
+	return strings.TrimSuffix(baseURL, "/"), nil
+}
+
+// VerifyAu10tixToken checks the token's signature against the keys of its issuer, or the
+// configured JWKS file, and returns its claims. Expiry is checked by the caller.
+func (h *ConfigHandler) VerifyAu10tixToken(ctx context.Context, config *PortalConfig, token string) (*Au10tixJWTPayload, error) {
+	trusted := func(issuer string) bool { return au10tixIssuerTrusted(config, issuer) }
+	claims, err := h.au10tixKeys.Verify(ctx, token, config.API.Au10tixJWKSFile, trusted)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAu10tixSignature, err)
+	}
+
+	var payload Au10tixJWTPayload
+	if err := json.Unmarshal(claims, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAu10tixTokenInvalid, err)
+	}
+	return &payload, nil
+}
+
+// au10tixHTTPClient returns a client for Au10tix and its authorization server that verifies
+// certificates against the system roots and the configured CA bundle
+func (h *ConfigHandler) au10tixHTTPClient(timeout time.Duration) *http.Client {
+	return au10tix.NewHTTPClient(h.au10tixTransport, timeout)
+}
+
+// au10tixTransport sends requests through a transport for the CA bundle currently configured,
+// rebuilt when api.au10tix_ca_bundle changes
+type au10tixTransport struct {
+	config *ConfigHandler
+
+	mu        sync.Mutex
+	bundle    string
+	transport *http.Transport
+}
+
+func (t *au10tixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := t.current()
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+// current returns the transport for the configured bundle
+func (t *au10tixTransport) current() (*http.Transport, error) {
+	bundle := ""
+	if config, err := t.config.LoadConfig(); err == nil {
+		bundle = config.API.Au10tixCABundle
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transport != nil && t.bundle == bundle {
+		return t.transport, nil
+	}
+	transport, err := au10tix.NewTransport(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if t.transport != nil {
+		t.transport.CloseIdleConnections()
+	}
+	t.bundle, t.transport = bundle, transport
+	return transport, nil
+}
+
+// reset drops the transport so a changed bundle file is read again
+func (t *au10tixTransport) reset() {
+	t.mu.Lock()
+	if t.transport != nil {
+		t.transport.CloseIdleConnections()
+	}
+	t.transport = nil
+	t.mu.Unlock()
+}
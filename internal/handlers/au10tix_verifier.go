@@ -0,0 +1,269 @@
+// File: internal/handlers/au10tix_verifier.go - Au10tix as an identity verification provider
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"self-service-portal/internal/secrets"
+	"self-service-portal/internal/services/au10tix"
+)
+
+// Au10tix webhook headers. The signature is the hex encoded HMAC-SHA256 of the timestamp, a dot
+// and the raw body, so a captured callback cannot be replayed once the timestamp is stale.
+const (
+	Au10tixSignatureHeader = "X-Au10tix-Signature"
+	Au10tixTimestampHeader = "X-Au10tix-Timestamp"
+)
+
+// au10tixWebhookTolerance is how far the signed timestamp may be from the current time
+const au10tixWebhookTolerance = 5 * time.Minute
+
+// au10tixChecks are the checks Au10tix results report
+var au10tixChecks = []string{"document_authenticity", "face_match", "liveness"}
+
+// au10tixVerifier runs verifications through Au10tix in the configured mode. The backend is
+// resolved on first use, so webhooks are accepted even while the token cannot be used.
+type au10tixVerifier struct {
+	handler *VerificationHandler
+	config  *PortalConfig
+	backend *au10tixBackend
+}
+
+// api returns the backend for the configured mode
+func (v *au10tixVerifier) api() (*au10tixBackend, error) {
+	if v.backend == nil {
+		backend, err := v.handler.au10tixBackend(v.config)
+		if err != nil {
+			return nil, verifierUnavailable(err)
+		}
+		v.backend = backend
+	}
+	return v.backend, nil
+}
+
+// CreateSession starts the profile's Au10tix workflow for the user
+func (v *au10tixVerifier) CreateSession(ctx context.Context, request VerificationRequest) (*ProviderSession, error) {
+	backend, err := v.api()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🔑 Au10tix mode: %s, token from: %s", backend.mode, backend.source)
+	if backend.token != nil {
+		log.Printf("🏢 Organization: %s (ID: %d)", backend.token.ClientOrganizationName, backend.token.ClientOrganizationID)
+	}
+
+	session, err := createAu10tixWorkflow(ctx, backend.api, request, ProviderAu10tix)
+	if err != nil {
+		return nil, err
+	}
+	session.CredentialSource = backend.source
+	return session, nil
+}
+
+// GetResult returns the detailed result, or the session state while Au10tix is processing
+func (v *au10tixVerifier) GetResult(ctx context.Context, sessionID string) (*ProviderResult, error) {
+	backend, err := v.api()
+	if err != nil {
+		return nil, err
+	}
+
+	provider := ProviderAu10tix
+	if backend.mode == Au10tixModeDemo {
+		provider = au10tix.DemoProvider
+	}
+	return au10tixResult(ctx, backend.api, sessionID, provider)
+}
+
+// ParseWebhook authenticates a callback with the shared webhook secret
+func (v *au10tixVerifier) ParseWebhook(r *http.Request, body []byte) (*WebhookEvent, error) {
+	secret := v.handler.au10tixWebhookSecret()
+	if secret == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+	if err := verifyWebhookSignature(secret, r.Header.Get(Au10tixTimestampHeader), body, r.Header.Get(Au10tixSignatureHeader), time.Now()); err != nil {
+		return nil, err
+	}
+
+	var payload Au10tixWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookPayload, err)
+	}
+
+	event := &WebhookEvent{Status: payload.Status}
+	for _, id := range []string{payload.SessionID, payload.WorkflowID, payload.ID} {
+		if id != "" {
+			event.SessionID = id
+			break
+		}
+	}
+	if event.SessionID == "" {
+		return nil, fmt.Errorf("%w: no session ID", ErrWebhookPayload)
+	}
+
+	// Notifications without result data leave the result to be fetched from the API
+	if payload.Status == "" && payload.Result == nil {
+		return event, nil
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookPayload, err)
+	}
+	event.Result = au10tixProviderResult(raw, false, ProviderAu10tix)
+	return event, nil
+}
+
+// Capabilities describes Au10tix in the configured mode
+func (v *au10tixVerifier) Capabilities() VerifierCapabilities {
+	mode := au10tixMode(v.config)
+	return VerifierCapabilities{
+		Provider:         ProviderAu10tix,
+		Mode:             mode,
+		Checks:           au10tixChecks,
+		WorkflowProfiles: true,
+		RedirectURLs:     true,
+		Webhooks:         mode != Au10tixModeDemo,
+		Polling:          true,
+		HostedCapture:    mode == Au10tixModeDemo,
+		Simulated:        mode == Au10tixModeDemo,
+	}
+}
+
+// createAu10tixWorkflow starts the profile's workflow with the user's data through an Au10tix
+// API, the real one or the demo client
+func createAu10tixWorkflow(ctx context.Context, api au10tix.API, request VerificationRequest, provider string) (*ProviderSession, error) {
+	workflowRequest := request.Profile.workflowRequest()
+
+	userData := request.UserData
+	userDataMap := map[string]string{}
+	for key, value := range map[string]string{
+		"firstName":   userData.FirstName,
+		"lastName":    userData.LastName,
+		"email":       userData.Email,
+		"phoneNumber": userData.PhoneNumber,
+		"dateOfBirth": userData.DateOfBirth,
+	} {
+		if value != "" {
+			userDataMap[key] = value
+		}
+	}
+	if len(userDataMap) > 0 {
+		workflowRequest.UserData = userDataMap
+	}
+
+	workflowResp, err := api.CreateWorkflow(ctx, request.Profile.Workflow, workflowRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &ProviderSession{
+		Provider:   provider,
+		SessionID:  workflowResp.Identifier(),
+		SessionURL: workflowResp.SessionURL(),
+		Status:     "created",
+	}
+	log.Printf("✅ %s session created successfully:", provider)
+	log.Printf("   Session ID: %s", session.SessionID)
+	log.Printf("   Verification URL: %s", session.SessionURL)
+	return session, nil
+}
+
+// au10tixResult prefers the detailed result and falls back to the session state while the
+// result endpoint has nothing yet. Outcomes are labelled with provider.
+func au10tixResult(ctx context.Context, api au10tix.API, sessionID, provider string) (*ProviderResult, error) {
+	result, err := api.GetResult(ctx, sessionID)
+	if err == nil {
+		// The result endpoint only answers once processing has finished
+		return au10tixProviderResult(result.Raw, true, provider), nil
+	}
+	log.Printf("🔍 %s result unavailable for %s: %v", provider, sessionID, err)
+
+	session, sessionErr := api.GetSession(ctx, sessionID)
+	if sessionErr != nil {
+		if errors.Is(err, au10tix.ErrResultNotReady) {
+			return nil, fmt.Errorf("%w: %v", ErrVerificationResultNotReady, sessionErr)
+		}
+		return nil, err
+	}
+	return au10tixProviderResult(session.Raw, false, provider), nil
+}
+
+// au10tixProviderResult converts an Au10tix result, session or webhook payload. When final is
+// set the response is known to be a finished result and the session is completed regardless
+// of the status string it carries.
+func au10tixProviderResult(response map[string]interface{}, final bool, provider string) *ProviderResult {
+	parsed := parseAu10tixResult(response)
+	result := &ProviderResult{Data: response, Score: parsed.Score, ProviderStatus: parsed.Status}
+
+	status := normalizeAu10tixStatus(parsed.Status)
+	if status == "" && parsed.Status != "" {
+		log.Printf("📊 Unknown Au10tix status: %s", parsed.Status)
+	}
+	if final {
+		status = "completed"
+	}
+
+	outcome := parsed.Outcome(status == "completed")
+	if outcome.Decision != "" {
+		outcome.Provider = provider
+		result.Outcome = outcome
+	}
+
+	switch {
+	case status != "":
+		result.Status = status
+	case parsed.Status != "":
+		result.Status = "pending"
+	}
+	return result
+}
+
+// au10tixWebhookSecret returns the shared secret used to sign Au10tix callbacks
+func (h *VerificationHandler) au10tixWebhookSecret() string {
+	if secret := os.Getenv("AU10TIX_WEBHOOK_SECRET"); secret != "" {
+		return secret
+	}
+	secret, err := h.configHandler.secretStore.Get(context.Background(), secrets.Au10tixWebhookSecret)
+	if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+		log.Printf("⚠️ Failed to load Au10tix webhook secret: %v", err)
+	}
+	return secret
+}
+
+// verifyWebhookSignature checks the signature header against the HMAC of the timestamp and body in
+// constant time, and that the Unix timestamp lies within au10tixWebhookTolerance of now
+func verifyWebhookSignature(secret, timestamp string, body []byte, signature string, now time.Time) error {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	provided, err := hex.DecodeString(signature)
+	if err != nil || len(provided) == 0 {
+		return ErrWebhookSignature
+	}
+	timestamp = strings.TrimSpace(timestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(provided, mac.Sum(nil)) {
+		return ErrWebhookSignature
+	}
+
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > au10tixWebhookTolerance || skew < -au10tixWebhookTolerance {
+		return ErrWebhookTimestamp
+	}
+	return nil
+}
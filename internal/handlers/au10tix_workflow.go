@@ -0,0 +1,237 @@
+// File: internal/handlers/au10tix_workflow.go - Au10tix workflow profiles and their selection
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"self-service-portal/internal/services/au10tix"
+)
+
+// DefaultWorkflowProfile is the built-in profile used until profiles are configured
+const DefaultWorkflowProfile = "standard"
+
+// Errors for profiles a verification request may not use
+var (
+	ErrWorkflowProfileUnknown       = errors.New("unknown workflow profile")
+	ErrWorkflowProfileNotSelectable = errors.New("workflow profile cannot be requested")
+	ErrWorkflowProfileMissing       = errors.New("default workflow profile is not configured")
+)
+
+// workflowNamePattern matches Au10tix workflow names, which become part of the API path
+var workflowNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// workflowCaptureSources are the capture sources Secure.me offers for a check
+var workflowCaptureSources = map[string]bool{"file": true, "camera": true}
+
+// standardWorkflowProfile is the document and selfie check the portal always ran before
+// profiles could be configured
+func standardWorkflowProfile() WorkflowProfile {
+	return WorkflowProfile{
+		Description: "ID document front and back with a selfie face comparison",
+		Workflow:    au10tix.DefaultWorkflow,
+		RequestTypes: map[string][]string{
+			"idFront":     {"file", "camera"},
+			"idBack":      {"file", "camera"},
+			"faceCompare": {"camera"},
+		},
+	}
+}
+
+// workflowProfiles returns the configured profiles, or the built-in standard profile
+func workflowProfiles(config *PortalConfig) map[string]WorkflowProfile {
+	if len(config.Workflows.Profiles) > 0 {
+		return config.Workflows.Profiles
+	}
+	return map[string]WorkflowProfile{DefaultWorkflowProfile: standardWorkflowProfile()}
+}
+
+// defaultWorkflowProfile returns the name of the profile used when nothing else matches
+func defaultWorkflowProfile(config *PortalConfig) string {
+	if config.Workflows.DefaultProfile != "" {
+		return config.Workflows.DefaultProfile
+	}
+	return DefaultWorkflowProfile
+}
+
+// selectWorkflowProfile picks the profile for a verification. A requested profile must be
+// selectable, unless it is the one the user would get anyway, so users cannot pick a lighter
+// check. Otherwise the user's SDO groups are matched before the directory, then the default.
+func selectWorkflowProfile(config *PortalConfig, requested string, flow *EnrollmentFlow) (string, WorkflowProfile, error) {
+	profiles := workflowProfiles(config)
+
+	assigned := matchWorkflowProfile(profiles, flow)
+	if assigned == "" {
+		assigned = defaultWorkflowProfile(config)
+	}
+
+	name := assigned
+	if requested != "" {
+		profile, ok := profiles[requested]
+		if !ok {
+			return "", WorkflowProfile{}, fmt.Errorf("%w: %s", ErrWorkflowProfileUnknown, requested)
+		}
+		if !profile.Selectable && requested != assigned {
+			return "", WorkflowProfile{}, fmt.Errorf("%w: %s", ErrWorkflowProfileNotSelectable, requested)
+		}
+		name = requested
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return "", WorkflowProfile{}, fmt.Errorf("%w: %s", ErrWorkflowProfileMissing, name)
+	}
+	return name, profile, nil
+}
+
+// matchWorkflowProfile returns the first profile, by name, naming one of the flow's groups, or
+// failing that its directory. It returns "" without a flow or a match.
+func matchWorkflowProfile(profiles map[string]WorkflowProfile, flow *EnrollmentFlow) string {
+	if flow == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, group := range flow.Groups {
+			if containsFold(profiles[name].Groups, group) {
+				return name
+			}
+		}
+	}
+	if flow.Directory != "" {
+		for _, name := range names {
+			if containsFold(profiles[name].Directories, flow.Directory) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// containsFold reports whether values holds value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// workflowRequest builds the Au10tix workflow request for the profile
+func (p WorkflowProfile) workflowRequest() *Au10tixWorkflowRequest {
+	requestTypes := make(map[string][]string, len(p.RequestTypes))
+	for check, sources := range p.RequestTypes {
+		requestTypes[check] = append([]string(nil), sources...)
+	}
+
+	request := &Au10tixWorkflowRequest{
+		WorkflowOptions: map[string]interface{}{},
+		ServiceOptions: ServiceOptions{
+			Secureme: SecuremeOptions{
+				ShortURL:     p.ShortURL == nil || *p.ShortURL,
+				RequestTypes: requestTypes,
+				SuccessURL:   p.SuccessURL,
+				FailureURL:   p.FailureURL,
+			},
+		},
+	}
+	if p.CallbackURL != "" {
+		request.WorkflowOptions["callbackUrl"] = p.CallbackURL
+	}
+	return request
+}
+
+// validateWorkflowConfig checks the profiles before they are saved or imported
+func validateWorkflowConfig(workflows *WorkflowConfig) error {
+	profiles := workflows.Profiles
+	if len(profiles) == 0 {
+		if workflows.DefaultProfile != "" && workflows.DefaultProfile != DefaultWorkflowProfile {
+			return fmt.Errorf("workflows.default_profile %q is not a configured profile", workflows.DefaultProfile)
+		}
+		return nil
+	}
+
+	defaultProfile := workflows.DefaultProfile
+	if defaultProfile == "" {
+		defaultProfile = DefaultWorkflowProfile
+	}
+	if _, ok := profiles[defaultProfile]; !ok {
+		return fmt.Errorf("workflows.default_profile %q is not a configured profile", defaultProfile)
+	}
+
+	for name, profile := range profiles {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("workflow profiles must have a name")
+		}
+		if !workflowNamePattern.MatchString(profile.Workflow) {
+			return fmt.Errorf("workflow profile %q: workflow must be an Au10tix workflow name such as %s", name, au10tix.DefaultWorkflow)
+		}
+		if len(profile.RequestTypes) == 0 {
+			return fmt.Errorf("workflow profile %q: request_types must name at least one check", name)
+		}
+		for check, sources := range profile.RequestTypes {
+			if len(sources) == 0 {
+				return fmt.Errorf("workflow profile %q: check %q needs at least one capture source", name, check)
+			}
+			for _, source := range sources {
+				if !workflowCaptureSources[source] {
+					return fmt.Errorf("workflow profile %q: capture source %q must be \"file\" or \"camera\"", name, source)
+				}
+			}
+		}
+		for field, value := range map[string]string{
+			"callback_url": profile.CallbackURL,
+			"success_url":  profile.SuccessURL,
+			"failure_url":  profile.FailureURL,
+		} {
+			if value == "" {
+				continue
+			}
+			if parsed, err := url.Parse(value); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+				return fmt.Errorf("workflow profile %q: %s must be an absolute http(s) URL", name, field)
+			}
+		}
+		if profile.CallbackURL != "" && !strings.HasPrefix(profile.CallbackURL, "https://") {
+			return fmt.Errorf("workflow profile %q: callback_url must use https", name)
+		}
+	}
+	return nil
+}
+
+// applyWorkflowSettings updates the workflow profiles from a save-config request. Profiles are
+// replaced as a whole so removed profiles do not linger.
+func applyWorkflowSettings(workflows *WorkflowConfig, settings map[string]interface{}) error {
+	updated := *workflows
+	if v, ok := settings["default_profile"].(string); ok {
+		updated.DefaultProfile = strings.TrimSpace(v)
+	}
+	if v, ok := settings["profiles"]; ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("invalid workflow profiles: %w", err)
+		}
+		var profiles map[string]WorkflowProfile
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return fmt.Errorf("invalid workflow profiles: %w", err)
+		}
+		updated.Profiles = profiles
+	}
+
+	if err := validateWorkflowConfig(&updated); err != nil {
+		return err
+	}
+	*workflows = updated
+	return nil
+}
@@ -0,0 +1,364 @@
+// File: internal/handlers/audit.go - Tamper-evident audit log of operator and end-user actions
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Audited actions
+const (
+	AuditLogin              = "auth.login"
+	AuditLogout             = "auth.logout"
+	AuditPasswordChange     = "auth.password_change"
+	AuditSSOLogin           = "auth.sso_login"
+	AuditPortalUserCreate   = "portal_user.create"
+	AuditPortalUserUpdate   = "portal_user.update"
+	AuditAPITokenCreate     = "api_token.create"
+	AuditAPITokenRevoke     = "api_token.revoke"
+	AuditAPIKeyRotate       = "api_token.rotate_key"
+	AuditSDOConnect         = "sdo.connect"
+	AuditSDOSearch          = "sdo.search"
+	AuditSDOInvite          = "sdo.invite"
+	AuditSDOQRCode          = "sdo.qr"
+	AuditSDOVerifyUser      = "sdo.verify_user"
+	AuditConfigUpdate       = "config.update"
+	AuditConfigImport       = "config.import"
+	AuditVerificationStart  = "verification.start"
+	AuditVerificationResult = "verification.result"
+	AuditVerificationReview = "verification.review"
+)
+
+// Audit event outcomes
+const (
+	AuditOutcomeSuccess     = "success"
+	AuditOutcomeDenied      = "denied"
+	AuditOutcomeRateLimited = "rate_limited"
+	AuditOutcomeRejected    = "rejected"
+	AuditOutcomeFailure     = "failure"
+)
+
+// auditContextKey holds the details a handler adds to the event recorded for its request
+const auditContextKey = "audit_draft"
+
+// auditExportColumns are the CSV columns of an export, in order
+var auditExportColumns = []string{
+	"sequence", "occurred_at", "actor", "actor_role", "action", "target", "outcome",
+	"ip", "request_id", "details", "before", "after", "prev_hash", "hash",
+}
+
+// auditDraft collects what a handler knows about the action it performed
+type auditDraft struct {
+	target  string
+	outcome string
+	details map[string]interface{}
+	before  interface{}
+	after   interface{}
+}
+
+// AuditLog appends events to the hash-chained audit table. A nil *AuditLog records nothing,
+// so handlers can be used without one.
+type AuditLog struct {
+	db *gorm.DB
+	mu sync.Mutex // Serializes appends from this instance so they do not race for a sequence number
+}
+
+// NewAuditLog creates an audit log backed by the given database
+func NewAuditLog(db *gorm.DB) *AuditLog {
+	return &AuditLog{db: db}
+}
+
+// auditDraftFor returns the request's draft, creating it on first use
+func auditDraftFor(c *gin.Context) *auditDraft {
+	if value, ok := c.Get(auditContextKey); ok {
+		return value.(*auditDraft)
+	}
+	draft := &auditDraft{details: make(map[string]interface{})}
+	c.Set(auditContextKey, draft)
+	return draft
+}
+
+// setAuditTarget names the user, account or resource the request acted on
+func setAuditTarget(c *gin.Context, target string) {
+	auditDraftFor(c).target = target
+}
+
+// addAuditDetail adds a detail to the request's audit event
+func addAuditDetail(c *gin.Context, key string, value interface{}) {
+	auditDraftFor(c).details[key] = value
+}
+
+// setAuditChange records the state before and after a configuration change. Secrets must be
+// masked or fingerprinted by the caller.
+func setAuditChange(c *gin.Context, before, after interface{}) {
+	draft := auditDraftFor(c)
+	draft.before, draft.after = before, after
+}
+
+// setAuditOutcome overrides the outcome derived from the response status
+func setAuditOutcome(c *gin.Context, outcome string) {
+	auditDraftFor(c).outcome = outcome
+}
+
+// auditOutcomeForStatus maps the response status of a request to an outcome
+func auditOutcomeForStatus(status int) string {
+	switch {
+	case status < 400:
+		return AuditOutcomeSuccess
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return AuditOutcomeDenied
+	case status == http.StatusTooManyRequests:
+		return AuditOutcomeRateLimited
+	case status < 500:
+		return AuditOutcomeRejected
+	default:
+		return AuditOutcomeFailure
+	}
+}
+
+// Track returns middleware that records one event for the action once the request has been
+// handled, including requests rejected by access control or rate limits further down the chain
+func (a *AuditLog) Track(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if a == nil {
+			return
+		}
+
+		draft := auditDraftFor(c)
+		outcome := draft.outcome
+		if outcome == "" {
+			outcome = auditOutcomeForStatus(c.Writer.Status())
+		}
+		if outcome != AuditOutcomeSuccess {
+			draft.details["status"] = c.Writer.Status()
+		}
+
+		actor, role := auditActor(c)
+		a.append(&models.AuditEvent{
+			Actor:     actor,
+			ActorRole: role,
+			Action:    action,
+			Target:    draft.target,
+			Outcome:   outcome,
+			IP:        c.ClientIP(),
+			RequestID: c.GetString("request_id"),
+			Details:   auditJSON(draft.details),
+			Before:    auditJSON(draft.before),
+			After:     auditJSON(draft.after),
+		})
+	}
+}
+
+// RecordSystem records an action taken by a background job, such as a verification result
+// that arrived by webhook or polling
+func (a *AuditLog) RecordSystem(actor, action, target, outcome string, details map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	a.append(&models.AuditEvent{
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Outcome: outcome,
+		Details: auditJSON(details),
+	})
+}
+
+// append writes the event, retrying when another instance took the same sequence number.
+// Failures are logged; they never fail the audited request.
+func (a *AuditLog) append(event *models.AuditEvent) {
+	event.OccurredAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		clone := *event
+		if err = database.AppendAuditEvent(a.db, &clone); err == nil {
+			return
+		}
+	}
+	log.Printf("❌ Failed to write audit event %s by %s: %v", event.Action, event.Actor, err)
+}
+
+// auditActor identifies who made the request: the portal operator or API client admitted by
+// access control, the operator who just logged in, or an anonymous self-service visitor
+func auditActor(c *gin.Context) (actor, role string) {
+	actor, role = c.GetString("user"), c.GetString("role")
+	if actor == "" {
+		if username, ok := sessions.Default(c).Get("username").(string); ok && username != "" {
+			actor = username
+		}
+	}
+	if actor == "" {
+		actor = "anonymous"
+	}
+	return actor, role
+}
+
+// auditJSON encodes a detail value, returning "" for empty values
+func auditJSON(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if details, ok := value.(map[string]interface{}); ok && len(details) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", fmt.Sprint(value))
+	}
+	return string(data)
+}
+
+// auditQueryFromRequest reads the filters shared by the query and export endpoints
+func auditQueryFromRequest(c *gin.Context) (database.AuditQuery, error) {
+	query := database.AuditQuery{
+		Actor:     c.Query("actor"),
+		Action:    c.Query("action"),
+		Target:    c.Query("target"),
+		Outcome:   c.Query("outcome"),
+		RequestID: c.Query("request_id"),
+	}
+
+	var err error
+	if query.From, err = parseAuditTime(c.Query("from")); err != nil {
+		return query, fmt.Errorf("invalid from: %w", err)
+	}
+	if query.To, err = parseAuditTime(c.Query("to")); err != nil {
+		return query, fmt.Errorf("invalid to: %w", err)
+	}
+	return query, nil
+}
+
+// parseAuditTime accepts RFC 3339 timestamps and plain dates
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// ListEvents handles GET /api/audit with filters and paging
+func (a *AuditLog) ListEvents(c *gin.Context) {
+	query, err := auditQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	query.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if query.Limit <= 0 || query.Limit > 1000 {
+		query.Limit = 100
+	}
+	query.Offset, _ = strconv.Atoi(c.Query("offset"))
+
+	events, total, err := database.ListAuditEvents(a.db, query)
+	if err != nil {
+		log.Printf("❌ Failed to query audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to query audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"events":  events,
+		"total":   total,
+		"limit":   query.Limit,
+		"offset":  query.Offset,
+	})
+}
+
+// ExportEvents handles GET /api/audit/export?format=csv|json and streams every matching event
+// in chain order, hashes included, so the export can be verified offline
+func (a *AuditLog) ExportEvents(c *gin.Context) {
+	query, err := auditQueryFromRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "format must be csv or json"})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+
+	if format == "json" {
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		encoder := json.NewEncoder(c.Writer)
+		first := true
+		c.Writer.WriteString("[")
+		err = database.EachAuditEvent(a.db, query, func(event *models.AuditEvent) error {
+			if !first {
+				c.Writer.WriteString(",")
+			}
+			first = false
+			return encoder.Encode(event)
+		})
+		c.Writer.WriteString("]")
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writer := csv.NewWriter(c.Writer)
+		writer.Write(auditExportColumns)
+		err = database.EachAuditEvent(a.db, query, func(event *models.AuditEvent) error {
+			return writer.Write([]string{
+				strconv.FormatUint(event.Sequence, 10), event.OccurredAt.UTC().Format(time.RFC3339Nano),
+				event.Actor, event.ActorRole, event.Action, event.Target, event.Outcome,
+				event.IP, event.RequestID, event.Details, event.Before, event.After, event.PrevHash, event.Hash,
+			})
+		})
+		writer.Flush()
+	}
+
+	if err != nil {
+		// Headers are already sent; the truncated file is the only signal the client gets
+		log.Printf("❌ Audit export failed: %v", err)
+	}
+}
+
+// VerifyChain handles GET /api/audit/verify and recomputes the hash chain
+func (a *AuditLog) VerifyChain(c *gin.Context) {
+	checked, err := database.VerifyAuditChain(a.db)
+	var chainErr *database.AuditChainError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"success": true, "valid": true, "checked": checked})
+	case errors.As(err, &chainErr):
+		log.Printf("🚨 %v", chainErr)
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"valid":     false,
+			"checked":   checked,
+			"broken_at": chainErr.Sequence,
+			"reason":    chainErr.Reason,
+		})
+	default:
+		log.Printf("❌ Failed to verify audit chain: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to verify audit chain"})
+	}
+}
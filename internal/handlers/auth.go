@@ -3,19 +3,24 @@ package handlers
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	mathRand "math/rand"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"self-service-portal/internal/config"
+	"self-service-portal/internal/secrets"
 	"self-service-portal/internal/services"
 
 	"github.com/gin-contrib/sessions"
@@ -26,31 +31,37 @@ import (
 // AuthHandler handles all SDO authentication and user management
 type AuthHandler struct {
 	// Add any dependencies you need here, like database connections
+	verifications *VerificationHandler
+	flows         *EnrollmentFlowManager
+	serviceTokens *services.SDOTokenManager
+	credentials   SDOCredentialStore
+	credentialTTL time.Duration
+	apiTokens     *APITokens
 }
 
-// JWT Claims structure
-type JWTClaims struct {
-	Email         string `json:"email"`
-	SDOURL        string `json:"sdo_url"`
-	SDOTokenRef   string `json:"sdo_token_ref"`
-	Authenticated bool   `json:"authenticated"`
-	IssuedAt      int64  `json:"iat"`
-	ExpiresAt     int64  `json:"exp"`
+// NewAuthHandler creates a new AuthHandler instance
+func NewAuthHandler() *AuthHandler {
+	return &AuthHandler{
+		serviceTokens: sharedSDOTokens(),
+		credentials:   NewMemorySDOCredentialStore(),
+		credentialTTL: DefaultSDOCredentialTTL,
+	}
 }
 
-// JWT secret key (use environment variable in production)
-var jwtSecret = []byte("your-jwt-secret-key-at-least-32-characters-long!")
+// SetVerificationHandler gives the handler access to verification sessions for identity checks
+func (h *AuthHandler) SetVerificationHandler(verifications *VerificationHandler) {
+	h.verifications = verifications
+}
 
-// NewAuthHandler creates a new AuthHandler instance
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+// SetAPITokens lets machine clients reach the SDO endpoints with API tokens
+func (h *AuthHandler) SetAPITokens(tokens *APITokens) {
+	h.apiTokens = tokens
 }
 
-// Simple in-memory token storage (use Redis/database in production)
-var (
-	tokenStorage     = make(map[string]string)
-	tokenDataStorage = make(map[string]map[string]string)
-)
+// SetEnrollmentFlows makes the SDO enrollment steps check and advance the enrollment flow
+func (h *AuthHandler) SetEnrollmentFlows(flows *EnrollmentFlowManager) {
+	h.flows = flows
+}
 
 // Initialize random seed
 func init() {
@@ -69,37 +80,6 @@ func getPortalBaseURL(adminURL string) string {
 	return baseURL
 }
 
-// Helper functions for token storage
-func storeTokenReference(tokenID, token string) {
-	tokenStorage[tokenID] = token
-	log.Printf("📦 Stored token reference: %s (length: %d)", tokenID, len(token))
-}
-
-func storeTokenDataReference(dataID string, data map[string]string) {
-	tokenDataStorage[dataID] = data
-	log.Printf("📦 Stored data reference: %s", dataID)
-}
-
-func getStoredToken(tokenID string) (string, bool) {
-	token, exists := tokenStorage[tokenID]
-	if exists {
-		log.Printf("📋 Retrieved token reference: %s (length: %d)", tokenID, len(token))
-	} else {
-		log.Printf("❌ Token reference not found: %s", tokenID)
-	}
-	return token, exists
-}
-
-func getStoredTokenData(dataID string) (map[string]string, bool) {
-	data, exists := tokenDataStorage[dataID]
-	if exists {
-		log.Printf("📋 Retrieved data reference: %s", dataID)
-	} else {
-		log.Printf("❌ Data reference not found: %s", dataID)
-	}
-	return data, exists
-}
-
 func generateRandomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, length)
@@ -109,76 +89,6 @@ func generateRandomString(length int) string {
 	return string(b)
 }
 
-// JWT token generation and verification functions
-func generateJWT(email, sdoURL, sdoTokenRef string) (string, error) {
-	claims := JWTClaims{
-		Email:         email,
-		SDOURL:        sdoURL,
-		SDOTokenRef:   sdoTokenRef,
-		Authenticated: true,
-		IssuedAt:      time.Now().Unix(),
-		ExpiresAt:     time.Now().Add(24 * time.Hour).Unix(),
-	}
-
-	// Create header
-	header := map[string]string{
-		"alg": "HS256",
-		"typ": "JWT",
-	}
-
-	headerJSON, _ := json.Marshal(header)
-	headerEncoded := base64.RawURLEncoding.EncodeToString(headerJSON)
-
-	// Create payload
-	payloadJSON, _ := json.Marshal(claims)
-	payloadEncoded := base64.RawURLEncoding.EncodeToString(payloadJSON)
-
-	// Create signature
-	message := headerEncoded + "." + payloadEncoded
-	h := hmac.New(sha256.New, jwtSecret)
-	h.Write([]byte(message))
-	signature := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-
-	token := message + "." + signature
-	return token, nil
-}
-
-// Verify JWT token
-func verifyJWT(tokenString string) (*JWTClaims, error) {
-	parts := strings.Split(tokenString, ".")
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid token format")
-	}
-
-	// Verify signature
-	message := parts[0] + "." + parts[1]
-	h := hmac.New(sha256.New, jwtSecret)
-	h.Write([]byte(message))
-	expectedSignature := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-
-	if parts[2] != expectedSignature {
-		return nil, fmt.Errorf("invalid token signature")
-	}
-
-	// Decode payload
-	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode payload: %v", err)
-	}
-
-	var claims JWTClaims
-	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		return nil, fmt.Errorf("failed to parse claims: %v", err)
-	}
-
-	// Check expiration
-	if time.Now().Unix() > claims.ExpiresAt {
-		return nil, fmt.Errorf("token expired")
-	}
-
-	return &claims, nil
-}
-
 // SDOAuth handles SDO authentication requests with enhanced session management
 func (h *AuthHandler) SDOAuth(c *gin.Context) {
 	log.Println("=== SDO Authentication Request Started ===")
@@ -197,6 +107,8 @@ func (h *AuthHandler) SDOAuth(c *gin.Context) {
 		})
 		return
 	}
+	setAuditTarget(c, req.Email)
+	addAuditDetail(c, "sdo_url", req.URL)
 
 	if h.performSDOAuth(c, req.URL, req.Email, req.Password) {
 		c.JSON(http.StatusOK, gin.H{"success": true, "message": "SDO authentication successful"})
@@ -205,6 +117,40 @@ func (h *AuthHandler) SDOAuth(c *gin.Context) {
 
 // performSDOAuth is the internal logic for SDO authentication
 func (h *AuthHandler) performSDOAuth(c *gin.Context, url, email, password string) bool {
+	if err := h.authenticateSDO(c, url, email, password); err != nil {
+		var saveErr *sdoSessionSaveError
+		if errors.As(err, &saveErr) {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to save SDO session",
+			})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "SDO authentication failed",
+			"details": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// sdoSessionSaveError reports that SDO authentication succeeded but the session could not be saved
+type sdoSessionSaveError struct {
+	err error
+}
+
+func (e *sdoSessionSaveError) Error() string {
+	return "failed to save SDO session: " + e.err.Error()
+}
+
+func (e *sdoSessionSaveError) Unwrap() error {
+	return e.err
+}
+
+// authenticateSDO authenticates with SDO and stores the token in the session without writing a response
+func (h *AuthHandler) authenticateSDO(c *gin.Context, url, email, password string) error {
 	sdoService := services.NewSDOService()
 
 	log.Printf("SDO Auth: Attempting authentication to URL: %s, Email: %s", url, email)
@@ -213,33 +159,83 @@ func (h *AuthHandler) performSDOAuth(c *gin.Context, url, email, password string
 	authResp, err := sdoService.Authenticate(url, email, password)
 	if err != nil {
 		log.Printf("SDO Auth: Authentication failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "SDO authentication failed",
-			"details": err.Error(),
-		})
-		return false
+		return err
 	}
 
 	log.Printf("SDO Auth: Authentication successful, token length: %d", len(authResp.Token))
 
-	session := sessions.Default(c)
-	session.Set("sdo_authenticated", true)
-	session.Set("sdo_token", authResp.Token)
-	session.Set("sdo_url", sdoService.BaseURL)
-	session.Set("sdo_email", email)
-
-	if err := session.Save(); err != nil {
-		log.Printf("SDO Auth: Failed to save session: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to save SDO session",
-		})
-		return false
+	if err := h.saveSDOSession(c, sdoService.BaseURL, email, authResp.Token, false); err != nil {
+		return err
 	}
 
 	log.Println("✅ SDO Auth: Session saved successfully")
-	return true
+	return nil
+}
+
+// errSDOServiceAccountMissing reports that no SDO service credentials are configured
+var errSDOServiceAccountMissing = errors.New("SDO service account is not configured")
+
+// sdoServiceCredentials returns the portal's SDO service account from the secret providers
+func sdoServiceCredentials(ctx context.Context, store *secrets.Store) (sdoURL, email, password string, err error) {
+	if email, err = store.Get(ctx, secrets.SDOEmail); err != nil {
+		log.Printf("❌ SDO email not available: %v", err)
+		return "", "", "", errSDOServiceAccountMissing
+	}
+	if password, err = store.Get(ctx, secrets.SDOPassword); err != nil {
+		log.Printf("❌ SDO password not available: %v", err)
+		return "", "", "", errSDOServiceAccountMissing
+	}
+
+	sdoURL = config.Load().SDODefaultURL
+	if providedURL, err := store.Get(ctx, secrets.SDOURL); err == nil {
+		sdoURL = providedURL
+	}
+	if sdoURL != "" && !strings.HasPrefix(sdoURL, "http") {
+		sdoURL = "https://" + sdoURL
+	}
+	return sdoURL, email, password, nil
+}
+
+var (
+	sdoServiceTokensOnce sync.Once
+	sdoServiceTokens     *services.SDOTokenManager
+)
+
+// sharedSDOTokens returns the process-wide SDO session of the service account. SDO_TOKEN_LIFETIME
+// sets how long tokens without an exp claim are used before signing in again.
+func sharedSDOTokens() *services.SDOTokenManager {
+	sdoServiceTokensOnce.Do(func() {
+		var lifetime time.Duration
+		if value := os.Getenv("SDO_TOKEN_LIFETIME"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				log.Printf("⚠️ Invalid SDO_TOKEN_LIFETIME %q, using %s", value, services.DefaultSDOTokenLifetime)
+			} else {
+				lifetime = parsed
+			}
+		}
+
+		store := secrets.Default()
+		sdoServiceTokens = services.NewSDOTokenManager(func(ctx context.Context) (services.SDOServiceAccount, error) {
+			sdoURL, email, password, err := sdoServiceCredentials(ctx, store)
+			if err != nil {
+				return services.SDOServiceAccount{}, err
+			}
+			return services.SDOServiceAccount{URL: sdoURL, Email: email, Password: password}, nil
+		}, lifetime)
+	})
+	return sdoServiceTokens
+}
+
+// startSDOServiceSession attaches the session to the shared service account token. A valid shared
+// token is reused as is; SDO is only signed in to when none is held. The session's credential holds
+// no token; requests made for it borrow the shared one and renew it when SDO rejects it.
+func (h *AuthHandler) startSDOServiceSession(c *gin.Context) error {
+	baseURL, _, err := h.serviceTokens.Token(c.Request.Context())
+	if err != nil {
+		return err
+	}
+	return h.saveSDOSession(c, baseURL, "", "", true)
 }
 
 // Modified SDOAuth function using JWT instead of sessions
@@ -262,6 +258,9 @@ func (h *AuthHandler) SDOAuthJWT(c *gin.Context) {
 	}
 
 	log.Printf("SDO Auth: Attempting authentication to URL: %s, Email: %s", req.URL, req.Email)
+	setAuditTarget(c, req.Email)
+	addAuditDetail(c, "sdo_url", req.URL)
+	addAuditDetail(c, "api_token", true)
 
 	// Create SDO service and authenticate
 	sdoService := services.NewSDOService()
@@ -277,15 +276,39 @@ func (h *AuthHandler) SDOAuthJWT(c *gin.Context) {
 
 	log.Printf("SDO Auth: Authentication successful, token length: %d", len(authResp.Token))
 
-	// Store SDO token with reference
-	tokenRef := fmt.Sprintf("jwt_%d_%s", time.Now().Unix(), generateRandomString(8))
-	tokenStorage[tokenRef] = authResp.Token
+	// Keep the SDO token on the server; the JWT only names the credential
+	credential, err := h.issueSDOCredential(sdoService.BaseURL, req.Email, authResp.Token, false)
+	if err != nil {
+		log.Printf("❌ SDO Auth: Failed to store SDO credential: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to generate authentication token",
+		})
+		return
+	}
 
-	log.Printf("✅ SDO Auth: Stored token with reference: %s", tokenRef)
+	if h.apiTokens == nil {
+		h.revokeSDOCredential(credential.ID)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "API tokens are not configured",
+		})
+		return
+	}
 
-	// Generate JWT token
-	jwtToken, err := generateJWT(req.Email, sdoService.BaseURL, tokenRef)
+	// Issue an API token that names the stored credential
+	jwtToken, _, err := h.apiTokens.Issue(APITokenRequest{
+		Name:        "sdo-login",
+		Subject:     req.Email,
+		Scopes:      []Permission{PermUseSDO, PermSearchUsers},
+		TTL:         time.Until(credential.ExpiresAt),
+		IssuedBy:    req.Email,
+		Email:       req.Email,
+		SDOURL:      sdoService.BaseURL,
+		SDOTokenRef: credential.ID,
+	})
 	if err != nil {
+		h.revokeSDOCredential(credential.ID)
 		log.Printf("❌ SDO Auth: Failed to generate JWT: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -308,41 +331,50 @@ func (h *AuthHandler) SDOAuthJWT(c *gin.Context) {
 	})
 }
 
-// SDOAuthFromConfig handles authentication using stored configuration
+// SDOAuthFromConfig handles POST /api/sdo/service-session. The session is attached to the portal's
+// shared SDO service account, which the server signs in once and renews as needed, so self-service
+// visitors can use the scoped SDO endpoints without any SDO credential reaching the browser.
 func (h *AuthHandler) SDOAuthFromConfig(c *gin.Context) {
-	// This would use stored configuration from your config handler
-	// For now, return a placeholder response
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error": "SDO auth from config not yet implemented",
-	})
+	if h.hasSDOCredential(c) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "SDO session already established"})
+		return
+	}
+
+	if err := h.startSDOServiceSession(c); err != nil {
+		var saveErr *sdoSessionSaveError
+		switch {
+		case errors.Is(err, errSDOServiceAccountMissing):
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   "SDO is not configured for self-service",
+			})
+		case errors.As(err, &saveErr):
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to save SDO session",
+			})
+		default:
+			log.Printf("❌ SDO service session: Authentication failed: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"success": false,
+				"error":   "SDO authentication failed",
+			})
+		}
+		return
+	}
+
+	log.Printf("✅ SDO service session established for %s", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "SDO session established"})
 }
 
 // LogoutSDO handles SDO logout with enhanced cleanup
 func (h *AuthHandler) LogoutSDO(c *gin.Context) {
 	session := sessions.Default(c)
 
-	// Clean up token references before clearing session
-	if tokenID := session.Get("sdo_token_id"); tokenID != nil {
-		delete(tokenStorage, tokenID.(string))
-		log.Printf("🗑️ Cleaned up token reference: %s", tokenID)
-	}
-
-	if dataID := session.Get("sdo_data_id"); dataID != nil {
-		delete(tokenDataStorage, dataID.(string))
-		log.Printf("🗑️ Cleaned up data reference: %s", dataID)
-	}
-
-	// Clear SDO-related session data (matching Flask exactly)
-	session.Delete("sdo_token")
-	session.Delete("sdo_token_id")
-	session.Delete("sdo_data_id")
-	session.Delete("sdo_url")
-	session.Delete("sdo_authenticated")
-	session.Delete("sdo_email")
-	session.Delete("auth_time")
+	h.clearSDOSession(session)
 	session.Save()
 
-	log.Println("SDO logout: Cleared session data and references")
+	log.Println("SDO logout: Revoked SDO credential and cleared session data")
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -355,26 +387,26 @@ func (h *AuthHandler) LogoutSDO(c *gin.Context) {
 func (h *AuthHandler) GetSDOStatus(c *gin.Context) {
 	log.Println("=== SDO Status Check ===")
 
-	session := sessions.Default(c)
-	isAuthenticated := session.Get("sdo_authenticated")
-
-	// Get authentication data using enhanced retrieval
-	authData := h.getAuthDataFromSession(session)
+	credential, err := h.sdoCredential(c)
 
 	status := gin.H{
-		"authenticated": isAuthenticated != nil && isAuthenticated.(bool),
+		"authenticated": err == nil,
 		"status":        "unauthenticated",
 	}
 
-	if isAuthenticated != nil && isAuthenticated.(bool) && authData != nil {
+	if err == nil {
 		status["status"] = "authenticated"
-		status["base_url"] = authData["url"]
-		status["email"] = authData["email"]
-		if token := authData["token"]; token != "" {
-			status["token_length"] = len(token)
+		status["base_url"] = credential.BaseURL
+		status["email"] = credential.Email
+		status["expires_at"] = credential.ExpiresAt
+		if credential.Token != "" {
+			status["token_length"] = len(credential.Token)
+		}
+		if credential.ServiceAccount {
+			status["service_account"] = h.serviceTokens.GetConnectionStatus()
 		}
 
-		log.Printf("SDO Status: Authenticated, Base URL: %s, Email: %s", authData["url"], authData["email"])
+		log.Printf("SDO Status: Authenticated, Base URL: %s, Email: %s", credential.BaseURL, credential.Email)
 	} else {
 		log.Println("SDO Status: Not authenticated")
 	}
@@ -382,116 +414,6 @@ func (h *AuthHandler) GetSDOStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
-// Helper method to get authentication data from session (handles all storage methods)
-func (h *AuthHandler) getAuthDataFromSession(session sessions.Session) map[string]string {
-	var authData = make(map[string]string)
-
-	// Method 1: Direct storage
-	if token := session.Get("sdo_token"); token != nil {
-		authData["token"] = token.(string)
-		if url := session.Get("sdo_url"); url != nil {
-			authData["url"] = url.(string)
-		}
-		if email := session.Get("sdo_email"); email != nil {
-			authData["email"] = email.(string)
-		}
-		log.Printf("📋 Retrieved auth data: direct storage")
-		return authData
-	}
-
-	// Method 2: Token reference storage
-	if tokenID := session.Get("sdo_token_id"); tokenID != nil {
-		if storedToken, exists := getStoredToken(tokenID.(string)); exists {
-			authData["token"] = storedToken
-			if url := session.Get("sdo_url"); url != nil {
-				authData["url"] = url.(string)
-			}
-			if email := session.Get("sdo_email"); email != nil {
-				authData["email"] = email.(string)
-			}
-			log.Printf("📋 Retrieved auth data: token reference")
-			return authData
-		}
-	}
-
-	// Method 3: Full data reference storage
-	if dataID := session.Get("sdo_data_id"); dataID != nil {
-		if storedData, exists := getStoredTokenData(dataID.(string)); exists {
-			authData["token"] = storedData["token"]
-			authData["url"] = storedData["url"]
-			authData["email"] = storedData["email"]
-			log.Printf("📋 Retrieved auth data: full reference")
-			return authData
-		}
-	}
-
-	log.Printf("❌ No auth data found in session")
-	return nil
-}
-
-// Middleware to verify JWT token
-func (h *AuthHandler) RequireJWTAuth() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get token from Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header required",
-			})
-			c.Abort()
-			return
-		}
-
-		// Remove "Bearer " prefix
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid authorization header format",
-			})
-			c.Abort()
-			return
-		}
-
-		// Verify token
-		claims, err := verifyJWT(tokenString)
-		if err != nil {
-			log.Printf("JWT verification failed: %v", err)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid or expired token",
-			})
-			c.Abort()
-			return
-		}
-
-		// Store claims in context for later use
-		c.Set("jwt_claims", claims)
-		c.Next()
-	}
-}
-
-// Helper to get authentication data from JWT
-func (h *AuthHandler) getAuthDataFromJWT(c *gin.Context) map[string]string {
-	claims, exists := c.Get("jwt_claims")
-	if !exists {
-		return nil
-	}
-
-	jwtClaims := claims.(*JWTClaims)
-
-	// Get SDO token from reference
-	sdoToken, exists := tokenStorage[jwtClaims.SDOTokenRef]
-	if !exists {
-		log.Printf("❌ SDO token not found for reference: %s", jwtClaims.SDOTokenRef)
-		return nil
-	}
-
-	return map[string]string{
-		"token": sdoToken,
-		"url":   jwtClaims.SDOURL,
-		"email": jwtClaims.Email,
-	}
-}
-
 // SDOAPIProxy proxies requests to SDO API
 func (h *AuthHandler) SDOAPIProxy(c *gin.Context) {
 	sdoService := h.getSDOService(c)
@@ -555,13 +477,23 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 		return
 	}
 
-	log.Printf("User search: term='%s'", searchTerm)
+	// Self-service visitors may only look up their own account by its exact email address;
+	// browsing the directory is left to operators
+	selfService := !isOperatorRequest(c)
+	if selfService && !strings.Contains(searchTerm, "@") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Enter your full email address",
+		})
+		return
+	}
 
-	// Get session and authentication data
-	session := sessions.Default(c)
-	authData := h.getAuthDataFromSession(session)
+	log.Printf("User search: term='%s'", searchTerm)
+	setAuditTarget(c, searchTerm)
 
-	if authData == nil || authData["token"] == "" || authData["url"] == "" {
+	// Get the SDO credential of the session or API token
+	credential, err := h.sdoCredential(c)
+	if err != nil || credential.Token == "" || credential.BaseURL == "" {
 		log.Printf("❌ User search: No SDO authentication found in session")
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
@@ -570,8 +502,8 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 		return
 	}
 
-	token := authData["token"]
-	baseURL := authData["url"]
+	token := credential.Token
+	baseURL := credential.BaseURL
 
 	log.Printf("✅ Using SDO credentials: URL=%s, Token length=%d", baseURL, len(token))
 
@@ -603,10 +535,8 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
-	// Make the request with timeout
-	client := &http.Client{
-		Timeout: 15 * time.Second,
-	}
+	// Make the request with timeout; service account sessions renew the token and retry on 401
+	client := h.sdoHTTPClient(credential, 15*time.Second)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -683,18 +613,30 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 			log.Printf("✅ Response is direct array: %d users", len(users))
 		}
 
+		if selfService {
+			users = selfServiceSearchResults(users, searchTerm)
+		}
+
 		// Return the users with proper structure
 		log.Printf("✅ Returning %d users for search term '%s'", len(users), searchTerm)
+		addAuditDetail(c, "results", len(users))
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"users":   users,
 			"count":   len(users),
 		})
 
+	} else if resp.StatusCode == 401 && credential.ServiceAccount {
+		// The shared token was already renewed once, so SDO is rejecting the service account itself
+		log.Printf("❌ SDO API rejected the service account after re-authentication")
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error":   "Directory search is temporarily unavailable",
+		})
 	} else if resp.StatusCode == 401 {
 		log.Printf("❌ SDO API unauthorized - token may be expired")
 
-		// Clear the expired session data
+		// Clear the expired SDO session data
 		h.clearExpiredSession(c)
 
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -710,12 +652,58 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 	}
 }
 
-// Helper method to clear expired session data
+// selfServiceSearchResults keeps the directory entries whose email is exactly the searched
+// address and reduces them to the ID and a masked email, which is all the enrollment flow needs
+func selfServiceSearchResults(users []interface{}, email string) []interface{} {
+	email = strings.TrimSpace(email)
+	matches := []interface{}{}
+	for _, entry := range users {
+		user, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		userEmail := sdoUserField(user, "email", "emailAddress", "mail")
+		if userEmail == "" || !strings.EqualFold(userEmail, email) {
+			continue
+		}
+		matches = append(matches, gin.H{
+			"id":    sdoUserField(user, "id", "userId", "uuid"),
+			"email": maskEmail(userEmail),
+		})
+	}
+	return matches
+}
+
+// sdoUserField returns the first of the named fields a directory entry has, as a string
+func sdoUserField(user map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		switch value := user[name].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// maskEmail keeps the first character of the local part and the domain, e.g. j***@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// Helper method to clear expired SDO session data; the portal login itself is kept
 func (h *AuthHandler) clearExpiredSession(c *gin.Context) {
 	session := sessions.Default(c)
-	session.Clear()
+	h.clearSDOSession(session)
 	session.Save()
-	log.Println("🗑️ Cleared expired session data")
+	log.Println("🗑️ Cleared expired SDO session data")
 }
 
 /*
@@ -852,12 +840,9 @@ func (h *AuthHandler) ValidateInvitationID(c *gin.Context) {
 		}
 	}
 
-	session := sessions.Default(c)
-	authData := h.getAuthDataFromSession(session)
-
 	var enrollmentUrl string
-	if authData != nil && authData["url"] != "" {
-		portalBaseURL := getPortalBaseURL(authData["url"])
+	if credential, err := h.sdoCredential(c); err == nil && credential.BaseURL != "" {
+		portalBaseURL := getPortalBaseURL(credential.BaseURL)
 		enrollmentUrl = fmt.Sprintf("%s/enroll?invitation=%s", portalBaseURL, invitationId)
 	}
 
@@ -952,9 +937,7 @@ func (h *AuthHandler) TestSDOConnection(c *gin.Context) {
 	log.Printf("Testing connection to: %s", req.URL)
 
 	// Simple HTTP GET to test if server is reachable
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+	client := services.NewSDOHTTPClient(10 * time.Second)
 
 	// Try to reach the admin interface
 	testURL := req.URL
@@ -986,17 +969,15 @@ func (h *AuthHandler) TestSDOConnection(c *gin.Context) {
 
 // FIXED: CheckSDOPortal checks if SDO portal is accessible
 func (h *AuthHandler) CheckSDOPortal(c *gin.Context) {
-	session := sessions.Default(c)
-	authData := h.getAuthDataFromSession(session)
-
-	if authData == nil || authData["url"] == "" {
+	credential, err := h.sdoCredential(c)
+	if err != nil || credential.BaseURL == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Not authenticated with SDO",
 		})
 		return
 	}
 
-	adminURL := authData["url"]
+	adminURL := credential.BaseURL
 	portalBaseURL := getPortalBaseURL(adminURL)
 
 	// FIXED: Check portal accessibility using the correct base URL
@@ -1055,30 +1036,36 @@ func (h *AuthHandler) SearchSDOUsers(c *gin.Context) {
 	h.SearchUsers(c)
 }
 
-// Enhanced getSDOService helper method with support for all storage methods
+// getSDOService returns an SDO client for the credential of the session or API token
 func (h *AuthHandler) getSDOService(c *gin.Context) *services.SDOService {
-	session := sessions.Default(c)
-
-	// Check if user is authenticated
-	if auth := session.Get("sdo_authenticated"); auth == nil || !auth.(bool) {
+	credential, err := h.sdoCredential(c)
+	if err != nil {
 		log.Println("SDO service: Not authenticated")
 		return nil
 	}
 
-	// Get authentication data using enhanced retrieval
-	authData := h.getAuthDataFromSession(session)
-	if authData == nil || authData["token"] == "" || authData["url"] == "" {
+	// Service account credentials share one token that is renewed on 401
+	if credential.ServiceAccount {
+		service, err := h.serviceTokens.Service(c.Request.Context())
+		if err != nil {
+			log.Printf("SDO service: Service account unavailable: %v", err)
+			return nil
+		}
+		return service
+	}
+
+	if credential.Token == "" || credential.BaseURL == "" {
 		log.Println("SDO service: Missing authentication data")
 		return nil
 	}
 
 	// Create and configure SDO service
 	service := services.NewSDOService()
-	service.Token = authData["token"]
-	service.BaseURL = authData["url"]
+	service.Token = credential.Token
+	service.BaseURL = credential.BaseURL
 
-	log.Printf("SDO service: Retrieved from session - URL: %s, Token length: %d",
-		service.BaseURL, len(service.Token))
+	log.Printf("SDO service: Retrieved credential %s - URL: %s, Token length: %d",
+		credential.ID, service.BaseURL, len(service.Token))
 
 	return service
 }
@@ -1105,20 +1092,17 @@ func min(a, b int) int {
 
 // SendInvitation sends an invitation to a user (OCTOPUS, FIDO, or both)
 func (h *AuthHandler) SendInvitation(c *gin.Context) {
-	session := sessions.Default(c)
-	authData := h.getAuthDataFromSession(session)
-
-	if authData == nil || authData["token"] == "" || authData["url"] == "" {
+	sdoService := h.getSDOService(c)
+	if sdoService == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Not authenticated with SDO"})
 		return
 	}
 
-	sdoService := services.NewSDOServiceWithAuth(authData["url"], authData["token"])
-
 	var req struct {
-		Email  string      `json:"email" binding:"required"`
-		UserID json.Number `json:"userId" binding:"required"`
-		Type   string      `json:"type"` // Optional: "OCTOPUS", "FIDO", or empty for both
+		Email          string      `json:"email" binding:"required"`
+		UserID         json.Number `json:"userId" binding:"required"`
+		Type           string      `json:"type"`           // Optional: "OCTOPUS", "FIDO", or empty for both
+		VerificationID string      `json:"verificationId"` // Verification to cross-check against the SDO user
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1128,6 +1112,43 @@ func (h *AuthHandler) SendInvitation(c *gin.Context) {
 
 	userIDStr := req.UserID.String()
 	log.Printf("✉️ Send Invitation request received for email: %s, User ID: %s, Type: %s", req.Email, userIDStr, req.Type)
+	setAuditTarget(c, req.Email)
+	addAuditDetail(c, "sdo_user_id", userIDStr)
+	if req.Type != "" {
+		addAuditDetail(c, "type", req.Type)
+	}
+
+	// The enrollment flow decides which user a self-service visitor may invite and with which
+	// verification; operators name the verification themselves
+	var flow *EnrollmentFlow
+	verificationID := req.VerificationID
+	if h.flows.enforcesFlow(c) {
+		var err error
+		if flow, err = h.flows.Current(c); err == nil {
+			err = flow.Require(FlowVerified, FlowInvited)
+		}
+		if err != nil {
+			respondFlowError(c, err)
+			return
+		}
+		if flow.SDOUserID != userIDStr {
+			log.Printf("🚫 Invitation for SDO user %s rejected: enrollment flow %s belongs to user %s", userIDStr, flow.ID, flow.SDOUserID)
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Invitations can only be sent to the identified user"})
+			return
+		}
+		verificationID = flow.VerificationID
+	}
+
+	if verificationID != "" {
+		addAuditDetail(c, "verification_id", verificationID)
+	}
+	if flow != nil {
+		addAuditDetail(c, "flow_id", flow.ID)
+	}
+
+	if !h.checkInvitationIdentity(c, sdoService, flow, userIDStr, req.Email, verificationID) {
+		return
+	}
 
 	var octopusInvitation, fidoInvitation *services.SDOInvitationDetails
 	var err error
@@ -1164,15 +1185,104 @@ func (h *AuthHandler) SendInvitation(c *gin.Context) {
 	}
 	time.Sleep(3 * time.Second)
 
+	var invitationIDs []string
+	for _, invitation := range []*services.SDOInvitationDetails{octopusInvitation, fidoInvitation} {
+		if invitation != nil {
+			invitationIDs = append(invitationIDs, invitation.InvitationID)
+		}
+	}
+	addAuditDetail(c, "invitation_ids", invitationIDs)
+	for _, key := range []string{"octopus_error", "fido_error", "publish_error"} {
+		if message, ok := results[key]; ok {
+			addAuditDetail(c, key, message)
+		}
+	}
+	if len(invitationIDs) == 0 {
+		setAuditOutcome(c, AuditOutcomeFailure)
+	}
+
+	if flow != nil {
+		flow.InvitationIDs = append(flow.InvitationIDs, invitationIDs...)
+		if len(invitationIDs) > 0 {
+			if err := h.flows.Advance(flow, FlowInvited, "invitation sent"); err != nil {
+				log.Printf("❌ Failed to advance enrollment flow %s: %v", flow.ID, err)
+			}
+		}
+		results["flow_state"] = flow.State
+	}
+
 	c.JSON(http.StatusOK, results)
 }
 
+// checkInvitationIdentity cross-checks the verification against the SDO user before an invitation
+// is sent. It writes the error response and returns false when the invitation must not be sent.
+func (h *AuthHandler) checkInvitationIdentity(c *gin.Context, sdoService *services.SDOService, flow *EnrollmentFlow, userID, email, verificationID string) bool {
+	if h.verifications == nil {
+		return true
+	}
+
+	if verificationID == "" {
+		if h.verifications.RequiresVerificationForInvitation() {
+			log.Printf("🚫 Invitation for SDO user %s rejected: no verification referenced", userID)
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "A completed identity verification is required before enrollment"})
+			return false
+		}
+		return true
+	}
+
+	user, err := sdoService.GetUser(userID)
+	if err != nil {
+		log.Printf("⚠️ Failed to fetch SDO user %s, falling back to search: %v", userID, err)
+		user = nil
+		if results, searchErr := sdoService.SearchUsers(email, 50); searchErr == nil {
+			for i := range results.Content {
+				if results.Content[i].ID.String() == userID {
+					user = &results.Content[i]
+					break
+				}
+			}
+		}
+		if user == nil {
+			c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": "Failed to load SDO user for identity check"})
+			return false
+		}
+	}
+
+	match, err := h.verifications.CheckIdentityForInvitation(verificationID, user)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrVerificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Verification session not found"})
+	case errors.Is(err, ErrVerificationNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Identity verification has not been completed successfully"})
+	case errors.Is(err, ErrIdentityReviewPending):
+		c.JSON(http.StatusAccepted, gin.H{
+			"success":        false,
+			"review":         true,
+			"error":          "Your identity details need to be reviewed by the helpdesk before enrollment",
+			"identity_match": match,
+		})
+	case errors.Is(err, ErrIdentityMismatch):
+		if flow != nil {
+			h.flows.Fail(flow, "identity does not match the directory user")
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"success":        false,
+			"error":          "Verified identity does not match the selected user",
+			"identity_match": match,
+		})
+	default:
+		log.Printf("❌ Identity check failed for verification %s: %v", verificationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Identity check failed"})
+	}
+	return false
+}
+
 // GenerateQRCode generates a QR code for enrollment
 func (h *AuthHandler) GenerateQRCode(c *gin.Context) {
-	session := sessions.Default(c)
-	authData := h.getAuthDataFromSession(session)
-
-	if authData == nil || authData["token"] == "" || authData["url"] == "" {
+	credential, err := h.sdoCredential(c)
+	if err != nil || credential.Token == "" || credential.BaseURL == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Not authenticated with SDO"})
 		return
 	}
@@ -1189,6 +1299,26 @@ func (h *AuthHandler) GenerateQRCode(c *gin.Context) {
 
 	var enrollmentURL string
 	var invitationID string
+	if req.InvitationID != "" {
+		setAuditTarget(c, req.InvitationID)
+		addAuditDetail(c, "type", req.Type)
+	}
+
+	if req.InvitationID != "" && h.flows.enforcesFlow(c) {
+		flow, err := h.flows.Current(c)
+		if err == nil {
+			err = flow.Require(FlowInvited, FlowEnrolled)
+		}
+		if err != nil {
+			respondFlowError(c, err)
+			return
+		}
+		if !flow.HasInvitation(req.InvitationID) {
+			log.Printf("🚫 QR code for invitation %s rejected: not issued in enrollment flow %s", req.InvitationID, flow.ID)
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Unknown invitation"})
+			return
+		}
+	}
 
 	if req.InvitationID != "" {
 		// Generate QR code for specific invitation
@@ -1197,7 +1327,7 @@ func (h *AuthHandler) GenerateQRCode(c *gin.Context) {
 		// Use different URLs based on invitation type
 		if req.Type == "FIDO" {
 			// For FIDO, use the SDO URL from config without /admin suffix
-			sdoBaseURL := strings.TrimSuffix(authData["url"], "/admin")
+			sdoBaseURL := strings.TrimSuffix(credential.BaseURL, "/admin")
 			enrollmentURL = sdoBaseURL + "/enroll?code=" + req.InvitationID
 			log.Printf("✅ QR Code: Generating FIDO QR code with enrollment URL: %s", enrollmentURL)
 		} else {
@@ -1211,14 +1341,14 @@ func (h *AuthHandler) GenerateQRCode(c *gin.Context) {
 		log.Printf("🖼️ Generate general QR Code request (no invitation ID)")
 
 		// Get portal base URL from admin URL
-		portalBaseURL := getPortalBaseURL(authData["url"])
+		portalBaseURL := getPortalBaseURL(credential.BaseURL)
 		enrollmentURL = portalBaseURL + "/enroll"
 		invitationID = "general"
 		log.Printf("✅ QR Code: Generating general QR code with portal URL: %s", enrollmentURL)
 	}
 
 	var png []byte
-	png, err := qrcode.Encode(enrollmentURL, qrcode.Medium, 256)
+	png, err = qrcode.Encode(enrollmentURL, qrcode.Medium, 256)
 	if err != nil {
 		log.Printf("❌ QR Code Generation Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1252,9 +1382,9 @@ func (h *AuthHandler) VerifyUserState(c *gin.Context) {
 		return
 	}
 
-	// Retrieve SDO credentials from session
-	sdoToken, sdoURL, _, ok := GetSDOCredsFromSession(c)
-	if !ok {
+	// Retrieve the SDO credential of the session or API token
+	credential, err := h.sdoCredential(c)
+	if err != nil || credential.Token == "" || credential.BaseURL == "" {
 		c.JSON(401, gin.H{"success": false, "error": "Not authenticated with SDO"})
 		return
 	}
@@ -1272,9 +1402,26 @@ func (h *AuthHandler) VerifyUserState(c *gin.Context) {
 		c.JSON(400, gin.H{"success": false, "error": "Invalid userId type"})
 		return
 	}
+	setAuditTarget(c, userID)
+
+	var flow *EnrollmentFlow
+	if h.flows.enforcesFlow(c) {
+		var err error
+		if flow, err = h.flows.Current(c); err == nil {
+			err = flow.Require(FlowInvited, FlowEnrolled)
+		}
+		if err != nil {
+			respondFlowError(c, err)
+			return
+		}
+		if flow.SDOUserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Only the identified user can be verified"})
+			return
+		}
+	}
 
 	// Build SDO verify user URL
-	baseURL := strings.TrimSuffix(sdoURL, "/")
+	baseURL := strings.TrimSuffix(credential.BaseURL, "/")
 	verifyURL := fmt.Sprintf("%s/api/users/%s/state/verify", baseURL, userID)
 
 	// Prepare request
@@ -1285,11 +1432,11 @@ func (h *AuthHandler) VerifyUserState(c *gin.Context) {
 		c.JSON(500, gin.H{"success": false, "error": "Failed to create request"})
 		return
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+sdoToken)
+	httpReq.Header.Set("Authorization", "Bearer "+credential.Token)
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Accept", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := h.sdoHTTPClient(credential, 10*time.Second)
 	resp, err := client.Do(httpReq)
 	if err != nil {
 		c.JSON(502, gin.H{"success": false, "error": "Failed to contact SDO API"})
@@ -1299,20 +1446,13 @@ func (h *AuthHandler) VerifyUserState(c *gin.Context) {
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if flow != nil && flow.State == FlowInvited {
+			if err := h.flows.Advance(flow, FlowEnrolled, "authenticator verified"); err != nil {
+				log.Printf("❌ Failed to advance enrollment flow %s: %v", flow.ID, err)
+			}
+		}
 		c.JSON(200, gin.H{"success": true, "result": string(body)})
 	} else {
 		c.JSON(502, gin.H{"success": false, "error": string(body)})
 	}
 }
-
-// GetSDOCredsFromSession retrieves SDO credentials from the session
-func GetSDOCredsFromSession(c *gin.Context) (token, url, email string, ok bool) {
-	session := sessions.Default(c)
-	tok, tokOk := session.Get("sdo_token").(string)
-	sdoURL, urlOk := session.Get("sdo_url").(string)
-	sdoEmail, _ := session.Get("sdo_email").(string)
-	if tokOk && urlOk {
-		return tok, sdoURL, sdoEmail, true
-	}
-	return "", "", "", false
-}
@@ -0,0 +1,150 @@
+// File: internal/handlers/config_secrets.go - Encryption and masking of secrets in the portal configuration
+package handlers
+
+import (
+	"fmt"
+
+	"self-service-portal/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maskedSecret replaces configured secrets in API responses. Sending it back in a save or
+// import request keeps the stored value.
+const maskedSecret = "********"
+
+// configSecret is a secret field of the portal configuration
+type configSecret struct {
+	name  string
+	value *string
+}
+
+// configSecrets lists every secret field that is encrypted at rest and masked in responses
+func configSecrets(cfg *PortalConfig) []configSecret {
+	return []configSecret{
+		{"auth.sdo_password", &cfg.Auth.SDOPassword},
+		{"auth.au10tix_token", &cfg.Auth.Au10tixToken},
+		{"auth.au10tix_webhook_secret", &cfg.Auth.Au10tixWebhookSecret},
+		{"auth.au10tix_client_secret", &cfg.Auth.Au10tixClientSecret},
+		{"auth.au10tix_private_key", &cfg.Auth.Au10tixPrivateKey},
+		{"auth.onfido_api_token", &cfg.Auth.OnfidoAPIToken},
+		{"auth.onfido_webhook_token", &cfg.Auth.OnfidoWebhookToken},
+		{"sso.oidc.client_secret", &cfg.SSO.OIDC.ClientSecret},
+	}
+}
+
+// hasConfigSecrets reports whether any secret field is set
+func hasConfigSecrets(cfg *PortalConfig) bool {
+	for _, secret := range configSecrets(cfg) {
+		if *secret.value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptConfigSecrets decrypts the secrets of a configuration read from disk in place and
+// reports whether any of them is plaintext or sealed under a retired key
+func decryptConfigSecrets(cfg *PortalConfig) (bool, error) {
+	if !hasConfigSecrets(cfg) {
+		return false, nil
+	}
+
+	secretCipher, err := config.DefaultSecretCipher()
+	if err != nil {
+		// Plaintext secrets from before encryption stay readable without a key
+		for _, secret := range configSecrets(cfg) {
+			if config.IsEncryptedSecret(*secret.value) {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	stale := false
+	for _, secret := range configSecrets(cfg) {
+		if secretCipher.NeedsReencryption(*secret.value) {
+			stale = true
+		}
+		plaintext, err := secretCipher.Decrypt(*secret.value)
+		if err != nil {
+			return false, fmt.Errorf("failed to decrypt %s: %w", secret.name, err)
+		}
+		*secret.value = plaintext
+	}
+	return stale, nil
+}
+
+// encryptConfigSecrets returns a copy of the configuration with its secrets encrypted for writing
+func encryptConfigSecrets(cfg *PortalConfig) (*PortalConfig, error) {
+	encrypted := *cfg
+	if !hasConfigSecrets(&encrypted) {
+		return &encrypted, nil
+	}
+
+	secretCipher, err := config.DefaultSecretCipher()
+	if err != nil {
+		return nil, fmt.Errorf("refusing to store secrets unencrypted: %w", err)
+	}
+	for _, secret := range configSecrets(&encrypted) {
+		if config.IsEncryptedSecret(*secret.value) {
+			return nil, fmt.Errorf("%s is already encrypted", secret.name)
+		}
+		sealed, err := secretCipher.Encrypt(*secret.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", secret.name, err)
+		}
+		*secret.value = sealed
+	}
+	return &encrypted, nil
+}
+
+// maskConfigSecrets returns a copy of the configuration that is safe to send to the browser
+func maskConfigSecrets(cfg *PortalConfig) *PortalConfig {
+	masked := *cfg
+	for _, secret := range configSecrets(&masked) {
+		if *secret.value != "" {
+			*secret.value = maskedSecret
+		}
+	}
+	return &masked
+}
+
+// keepMaskedSecrets restores stored secrets where the caller sent back the mask
+func keepMaskedSecrets(updated, existing *PortalConfig) {
+	current := configSecrets(existing)
+	for i, secret := range configSecrets(updated) {
+		if *secret.value == maskedSecret {
+			*secret.value = *current[i].value
+		}
+	}
+}
+
+// auditConfigChange records a configuration change in the request's audit event. Secrets are
+// masked on both sides; the names of secrets that changed are listed instead.
+func auditConfigChange(c *gin.Context, section string, before, after *PortalConfig) {
+	var changed []string
+	previous := configSecrets(before)
+	for i, secret := range configSecrets(after) {
+		if *secret.value != *previous[i].value {
+			changed = append(changed, secret.name)
+		}
+	}
+	if len(changed) > 0 {
+		addAuditDetail(c, "changed_secrets", changed)
+	}
+
+	maskedBefore, _ := configSection(maskConfigSecrets(before), section)
+	maskedAfter, _ := configSection(maskConfigSecrets(after), section)
+	setAuditChange(c, maskedBefore, maskedAfter)
+}
+
+// ReencryptSecrets rewrites the configuration so every secret is sealed under the current
+// master key. Run it after rotating keys, before retiring the previous key.
+func (h *ConfigHandler) ReencryptSecrets() error {
+	cfg, err := h.LoadConfig()
+	if err != nil {
+		return err
+	}
+	return h.saveConfig(cfg)
+}
@@ -0,0 +1,365 @@
+// File: internal/handlers/enrollment_flow.go - Server-side state machine for the self-service enrollment flow
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"self-service-portal/internal/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Enrollment flow states
+const (
+	FlowIdentified          = "identified"
+	FlowVerificationStarted = "verification_started"
+	FlowVerificationReview  = "verification_review"
+	FlowVerified            = "verified"
+	FlowInvited             = "invited"
+	FlowEnrolled            = "enrolled"
+	FlowFailed              = "failed"
+)
+
+// flowTransitions lists the states reachable from each state. Enrolled and failed are
+// terminal; starting over requires identifying the user again, which creates a new flow.
+var flowTransitions = map[string][]string{
+	FlowIdentified:          {FlowVerificationStarted, FlowFailed},
+	FlowVerificationStarted: {FlowVerificationStarted, FlowVerificationReview, FlowVerified, FlowFailed},
+	FlowVerificationReview:  {FlowVerified, FlowFailed},
+	FlowVerified:            {FlowInvited, FlowFailed},
+	FlowInvited:             {FlowInvited, FlowEnrolled, FlowFailed},
+}
+
+// enrollmentFlowSessionKey stores the current flow ID in the browser session
+const enrollmentFlowSessionKey = "enrollment_flow_id"
+
+// enrollmentFlowTTL is how long a flow is kept after its last change, as long as verification
+// sessions are kept before they expire
+const enrollmentFlowTTL = 24 * time.Hour
+
+// ErrEnrollmentFlowNotFound is returned when there is no enrollment flow for the request
+var ErrEnrollmentFlowNotFound = errors.New("enrollment flow not found")
+
+// FlowStateError is returned when a step is attempted from a state that does not allow it
+type FlowStateError struct {
+	State    string
+	Expected []string
+}
+
+func (e *FlowStateError) Error() string {
+	return fmt.Sprintf("enrollment flow is %s, expected %s", e.State, strings.Join(e.Expected, " or "))
+}
+
+// FlowTransition records a single state change
+type FlowTransition struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// EnrollmentFlow tracks one user's progress through the self-service enrollment
+type EnrollmentFlow struct {
+	ID             string           `json:"id"`
+	State          string           `json:"state"`
+	SDOUserID      string           `json:"sdo_user_id"`
+	Email          string           `json:"email"`
+	Directory      string           `json:"directory,omitempty"` // SDO directory of the user, for workflow profile selection
+	Groups         []string         `json:"groups,omitempty"`    // SDO groups of the user, for workflow profile selection
+	VerificationID string           `json:"verification_id,omitempty"`
+	InvitationIDs  []string         `json:"invitation_ids,omitempty"`
+	History        []FlowTransition `json:"history"`
+	FailureReason  string           `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// CanTransition reports whether the flow may move to the given state
+func (f *EnrollmentFlow) CanTransition(to string) bool {
+	for _, allowed := range flowTransitions[f.State] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the flow to a new state, recording it in the history
+func (f *EnrollmentFlow) Transition(to, reason string) error {
+	if !f.CanTransition(to) {
+		return fmt.Errorf("invalid enrollment flow transition from %s to %s", f.State, to)
+	}
+	now := time.Now()
+	f.History = append(f.History, FlowTransition{From: f.State, To: to, Reason: reason, At: now})
+	f.State = to
+	f.UpdatedAt = now
+	if to == FlowFailed {
+		f.FailureReason = reason
+	}
+	return nil
+}
+
+// Require returns a FlowStateError unless the flow is in one of the given states
+func (f *EnrollmentFlow) Require(states ...string) error {
+	for _, state := range states {
+		if f.State == state {
+			return nil
+		}
+	}
+	return &FlowStateError{State: f.State, Expected: states}
+}
+
+// HasInvitation reports whether the invitation was issued within this flow
+func (f *EnrollmentFlow) HasInvitation(invitationID string) bool {
+	for _, id := range f.InvitationIDs {
+		if id == invitationID {
+			return true
+		}
+	}
+	return false
+}
+
+// EnrollmentFlowManager loads, advances and persists enrollment flows
+type EnrollmentFlowManager struct {
+	store         EnrollmentFlowStore
+	verifications VerificationStore
+}
+
+// NewEnrollmentFlowManager creates a manager backed by the given stores
+func NewEnrollmentFlowManager(store EnrollmentFlowStore, verifications VerificationStore) *EnrollmentFlowManager {
+	return &EnrollmentFlowManager{
+		store:         store,
+		verifications: verifications,
+	}
+}
+
+// Purge deletes flows that have not changed for enrollmentFlowTTL. Every anonymous visit that
+// identifies a user leaves a flow behind, and its verification has expired by then.
+func (m *EnrollmentFlowManager) Purge() {
+	purged, err := m.store.Purge(time.Now().Add(-enrollmentFlowTTL))
+	if err != nil {
+		log.Printf("❌ Failed to purge enrollment flows: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("🧹 Purged %d stale enrollment flows", purged)
+	}
+}
+
+// Begin starts a new flow for the identified SDO user and binds it to the browser session
+func (m *EnrollmentFlowManager) Begin(c *gin.Context, sdoUserID string, user *services.SDOUser) (*EnrollmentFlow, error) {
+	now := time.Now()
+	email := user.Email
+	flow := &EnrollmentFlow{
+		ID:        uuid.New().String(),
+		State:     FlowIdentified,
+		SDOUserID: sdoUserID,
+		Email:     email,
+		Directory: user.DirectoryName,
+		Groups:    append([]string(nil), user.Groups...),
+		History:   []FlowTransition{{To: FlowIdentified, Reason: "user identified", At: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.store.Put(flow); err != nil {
+		return nil, fmt.Errorf("failed to store enrollment flow: %w", err)
+	}
+
+	session := sessions.Default(c)
+	session.Set(enrollmentFlowSessionKey, flow.ID)
+	if err := session.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+
+	log.Printf("🧭 Enrollment flow %s started for SDO user %s (%s)", flow.ID, sdoUserID, email)
+	return flow, nil
+}
+
+// Current returns the flow bound to the browser session, synchronized with its verification
+func (m *EnrollmentFlowManager) Current(c *gin.Context) (*EnrollmentFlow, error) {
+	flowID, ok := sessions.Default(c).Get(enrollmentFlowSessionKey).(string)
+	if !ok || flowID == "" {
+		return nil, ErrEnrollmentFlowNotFound
+	}
+
+	flow, err := m.store.Get(flowID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.syncVerification(flow); err != nil {
+		log.Printf("⚠️ Failed to sync enrollment flow %s with verification: %v", flow.ID, err)
+	}
+	return flow, nil
+}
+
+// Advance transitions the flow and persists it
+func (m *EnrollmentFlowManager) Advance(flow *EnrollmentFlow, to, reason string) error {
+	from := flow.State
+	if err := flow.Transition(to, reason); err != nil {
+		return err
+	}
+	if err := m.store.Put(flow); err != nil {
+		return fmt.Errorf("failed to store enrollment flow: %w", err)
+	}
+	log.Printf("🧭 Enrollment flow %s: %s -> %s (%s)", flow.ID, from, to, reason)
+	return nil
+}
+
+// Fail moves the flow to the failed state unless it already reached a terminal state
+func (m *EnrollmentFlowManager) Fail(flow *EnrollmentFlow, reason string) {
+	if !flow.CanTransition(FlowFailed) {
+		return
+	}
+	if err := m.Advance(flow, FlowFailed, reason); err != nil {
+		log.Printf("❌ Failed to mark enrollment flow %s as failed: %v", flow.ID, err)
+	}
+}
+
+// syncVerification advances a flow waiting for verification once the result is known. A result
+// that needs manual review holds the flow until an operator approves or rejects it.
+func (m *EnrollmentFlowManager) syncVerification(flow *EnrollmentFlow) error {
+	if (flow.State != FlowVerificationStarted && flow.State != FlowVerificationReview) || flow.VerificationID == "" {
+		return nil
+	}
+
+	session, err := m.verifications.Get(flow.VerificationID)
+	if err != nil {
+		return err
+	}
+
+	reviewed := session.Outcome != nil && session.Outcome.Review != nil
+	switch {
+	case session.Status == "completed" && session.Result == DecisionVerified && reviewed:
+		return m.Advance(flow, FlowVerified, "identity verification approved by "+session.Outcome.Review.Reviewer)
+	case session.Status == "completed" && session.Result == DecisionVerified:
+		return m.Advance(flow, FlowVerified, "identity verification passed")
+	case session.Status == "completed" && session.Result == DecisionReview && flow.State == FlowVerificationStarted:
+		return m.Advance(flow, FlowVerificationReview, "identity verification needs manual review")
+	case session.Status == "completed" && session.Result == DecisionFailed,
+		session.Status == "failed", session.Status == "expired":
+		return m.Advance(flow, FlowFailed, fmt.Sprintf("identity verification %s", firstNonEmpty(session.Result, session.Status)))
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// enforcesFlow reports whether the request has to follow the caller's enrollment flow. Self-service
+// visitors are bound to their flow; operators invite and verify users from the dashboard without one.
+// A nil manager enforces nothing.
+func (m *EnrollmentFlowManager) enforcesFlow(c *gin.Context) bool {
+	return m != nil && !isOperatorRequest(c)
+}
+
+// respondFlowError writes the response for a request that is not allowed in the current flow
+func respondFlowError(c *gin.Context, err error) {
+	var stateErr *FlowStateError
+	switch {
+	case errors.Is(err, ErrEnrollmentFlowNotFound):
+		log.Printf("🚫 %s called without an enrollment flow from IP: %s", c.Request.URL.Path, c.ClientIP())
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "No enrollment in progress. Please start the self-service enrollment again.",
+			"state":   "",
+		})
+	case errors.As(err, &stateErr):
+		log.Printf("🚫 %s rejected: %v (IP: %s)", c.Request.URL.Path, err, c.ClientIP())
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "This step is not available yet: " + err.Error(),
+			"state":   stateErr.State,
+		})
+	default:
+		log.Printf("❌ Enrollment flow error on %s: %v", c.Request.URL.Path, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Enrollment flow error",
+		})
+	}
+}
+
+// IdentifyUser handles POST /api/enrollment/identify. It binds a new enrollment flow to the SDO
+// user selected in the self-service search, after confirming the user exists with that email.
+func (h *AuthHandler) IdentifyUser(c *gin.Context) {
+	if h.flows == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "Enrollment flows are not configured"})
+		return
+	}
+
+	sdoService := h.getSDOService(c)
+	if sdoService == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Not authenticated with SDO"})
+		return
+	}
+
+	var req struct {
+		UserID interface{} `json:"userId" binding:"required"`
+		Email  string      `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	userID := fmt.Sprint(req.UserID)
+	if number, ok := req.UserID.(float64); ok {
+		userID = fmt.Sprintf("%.0f", number)
+	}
+
+	user, err := sdoService.GetUser(userID)
+	if err != nil {
+		log.Printf("❌ Failed to load SDO user %s for enrollment: %v", userID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": "Failed to load directory user"})
+		return
+	}
+	if !strings.EqualFold(strings.TrimSpace(user.Email), strings.TrimSpace(req.Email)) {
+		log.Printf("🚫 Enrollment identify rejected: SDO user %s does not have email %s", userID, req.Email)
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "The selected user does not match the entered email"})
+		return
+	}
+
+	flow, err := h.flows.Begin(c, userID, user)
+	if err != nil {
+		respondFlowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"flow":    flow,
+	})
+}
+
+// GetEnrollmentFlow handles GET /api/enrollment/flow and returns the current flow
+func (h *AuthHandler) GetEnrollmentFlow(c *gin.Context) {
+	if h.flows == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "Enrollment flows are not configured"})
+		return
+	}
+
+	flow, err := h.flows.Current(c)
+	if err != nil {
+		respondFlowError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"flow":    flow,
+	})
+}
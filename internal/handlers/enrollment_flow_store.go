@@ -0,0 +1,169 @@
+// File: internal/handlers/enrollment_flow_store.go - Storage backends for enrollment flows
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// EnrollmentFlowStore persists enrollment flows. Implementations must be safe for concurrent
+// use and must not share flow pointers with callers.
+type EnrollmentFlowStore interface {
+	Get(flowID string) (*EnrollmentFlow, error)
+	Put(flow *EnrollmentFlow) error
+	// Purge deletes flows last updated before the given time
+	Purge(before time.Time) (int, error)
+}
+
+// NewEnrollmentFlowStore creates the flow store matching the verification store backend.
+// Flows are short-lived, so every backend other than SQL keeps them in memory.
+func NewEnrollmentFlowStore(kind string, db *gorm.DB) EnrollmentFlowStore {
+	switch strings.ToLower(kind) {
+	case VerificationStoreSQL, "":
+		if db != nil {
+			return NewSQLEnrollmentFlowStore(db)
+		}
+	}
+	return NewMemoryEnrollmentFlowStore()
+}
+
+// copyEnrollmentFlow returns a copy that does not share mutable state with the original
+func copyEnrollmentFlow(flow *EnrollmentFlow) *EnrollmentFlow {
+	clone := *flow
+	clone.Groups = append([]string(nil), flow.Groups...)
+	clone.InvitationIDs = append([]string(nil), flow.InvitationIDs...)
+	clone.History = append([]FlowTransition(nil), flow.History...)
+	return &clone
+}
+
+// MemoryEnrollmentFlowStore keeps enrollment flows in process memory
+type MemoryEnrollmentFlowStore struct {
+	mu    sync.RWMutex
+	flows map[string]*EnrollmentFlow
+}
+
+// NewMemoryEnrollmentFlowStore creates an empty in-memory flow store
+func NewMemoryEnrollmentFlowStore() *MemoryEnrollmentFlowStore {
+	return &MemoryEnrollmentFlowStore{
+		flows: make(map[string]*EnrollmentFlow),
+	}
+}
+
+func (s *MemoryEnrollmentFlowStore) Get(flowID string) (*EnrollmentFlow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	flow, exists := s.flows[flowID]
+	if !exists {
+		return nil, ErrEnrollmentFlowNotFound
+	}
+	return copyEnrollmentFlow(flow), nil
+}
+
+func (s *MemoryEnrollmentFlowStore) Put(flow *EnrollmentFlow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flows[flow.ID] = copyEnrollmentFlow(flow)
+	return nil
+}
+
+func (s *MemoryEnrollmentFlowStore) Purge(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, flow := range s.flows {
+		if flow.UpdatedAt.Before(before) {
+			delete(s.flows, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// SQLEnrollmentFlowStore keeps enrollment flows in the enrollment_flows table
+type SQLEnrollmentFlowStore struct {
+	db *gorm.DB
+}
+
+// NewSQLEnrollmentFlowStore creates a flow store backed by the given database
+func NewSQLEnrollmentFlowStore(db *gorm.DB) *SQLEnrollmentFlowStore {
+	return &SQLEnrollmentFlowStore{db: db}
+}
+
+func (s *SQLEnrollmentFlowStore) Get(flowID string) (*EnrollmentFlow, error) {
+	record, err := database.GetEnrollmentFlow(s.db, flowID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEnrollmentFlowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	flow := &EnrollmentFlow{
+		ID:             record.FlowID,
+		State:          record.State,
+		SDOUserID:      record.SDOUserID,
+		Email:          record.Email,
+		Directory:      record.Directory,
+		VerificationID: record.VerificationID,
+		FailureReason:  record.FailureReason,
+		CreatedAt:      record.CreatedAt,
+		UpdatedAt:      record.UpdatedAt,
+	}
+	if record.Groups != "" {
+		if err := json.Unmarshal([]byte(record.Groups), &flow.Groups); err != nil {
+			log.Printf("⚠️ Failed to decode groups for enrollment flow %s: %v", record.FlowID, err)
+		}
+	}
+	if record.InvitationIDs != "" {
+		if err := json.Unmarshal([]byte(record.InvitationIDs), &flow.InvitationIDs); err != nil {
+			log.Printf("⚠️ Failed to decode invitations for enrollment flow %s: %v", record.FlowID, err)
+		}
+	}
+	if record.History != "" {
+		if err := json.Unmarshal([]byte(record.History), &flow.History); err != nil {
+			log.Printf("⚠️ Failed to decode history for enrollment flow %s: %v", record.FlowID, err)
+		}
+	}
+	return flow, nil
+}
+
+func (s *SQLEnrollmentFlowStore) Put(flow *EnrollmentFlow) error {
+	record := &models.EnrollmentFlow{
+		FlowID:         flow.ID,
+		State:          flow.State,
+		SDOUserID:      flow.SDOUserID,
+		Email:          flow.Email,
+		Directory:      flow.Directory,
+		VerificationID: flow.VerificationID,
+		FailureReason:  flow.FailureReason,
+		CreatedAt:      flow.CreatedAt,
+		UpdatedAt:      flow.UpdatedAt,
+	}
+	if groups, err := json.Marshal(flow.Groups); err == nil {
+		record.Groups = string(groups)
+	}
+	if invitations, err := json.Marshal(flow.InvitationIDs); err == nil {
+		record.InvitationIDs = string(invitations)
+	}
+	if history, err := json.Marshal(flow.History); err == nil {
+		record.History = string(history)
+	}
+	return database.SaveEnrollmentFlow(s.db, record)
+}
+
+func (s *SQLEnrollmentFlowStore) Purge(before time.Time) (int, error) {
+	purged, err := database.DeleteStaleEnrollmentFlows(s.db, before)
+	return int(purged), err
+}
@@ -0,0 +1,272 @@
+// File: internal/handlers/identity_match.go - Identity cross-check between verified documents and SDO users
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"self-service-portal/internal/services"
+	"self-service-portal/internal/services/identity"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions taken when the identity match score is below the configured threshold
+const (
+	IdentityActionBlock  = "block"
+	IdentityActionReview = "review"
+)
+
+// Identity match decisions
+const (
+	IdentityMatchPassed   = "match"
+	IdentityMatchReview   = "review"
+	IdentityMatchMismatch = "mismatch"
+)
+
+// Manual review decisions
+const (
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+var (
+	ErrVerificationNotVerified = errors.New("verification has not been completed successfully")
+	ErrIdentityMismatch        = errors.New("verified identity does not match the directory user")
+	ErrIdentityReviewPending   = errors.New("identity match requires manual review")
+)
+
+// IdentityReview records a manual review of an identity match
+type IdentityReview struct {
+	Decision   string    `json:"decision"` // approved, rejected
+	Reviewer   string    `json:"reviewer"`
+	Note       string    `json:"note,omitempty"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+}
+
+// IdentityMatchResult records the cross-check of a verification against an SDO directory user
+type IdentityMatchResult struct {
+	Decision        string               `json:"decision"` // match, review, mismatch
+	Score           float64              `json:"score"`
+	Threshold       float64              `json:"threshold"`
+	Components      []identity.Component `json:"components"`
+	Reasons         []string             `json:"reasons,omitempty"`
+	DirectoryUserID string               `json:"directory_user_id"`
+	DirectoryUser   identity.Person      `json:"directory_user"`
+	CheckedAt       time.Time            `json:"checked_at"`
+	Review          *IdentityReview      `json:"review,omitempty"`
+}
+
+// Allowed reports whether an invitation may be sent based on this result
+func (r *IdentityMatchResult) Allowed() bool {
+	if r.Review != nil {
+		return r.Review.Decision == ReviewApproved
+	}
+	return r.Decision == IdentityMatchPassed
+}
+
+// identityMatchingConfig loads the identity matching settings, falling back to the defaults
+func (h *VerificationHandler) identityMatchingConfig() IdentityMatchingConfig {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil {
+		log.Printf("⚠️ Failed to load identity matching config, using defaults: %v", err)
+		return IdentityMatchingConfig{Enabled: true, Threshold: 0.85, BelowThresholdAction: IdentityActionReview}
+	}
+	return config.IdentityMatching
+}
+
+// RequiresVerificationForInvitation reports whether invitations must reference a verification
+func (h *VerificationHandler) RequiresVerificationForInvitation() bool {
+	settings := h.identityMatchingConfig()
+	return settings.Enabled && settings.RequireVerification
+}
+
+// CheckIdentityForInvitation cross-checks a verification session against the SDO user about to be
+// invited. The result is stored on the session; an error is returned when the invitation must not
+// be sent. A previous manual review for the same directory user is honoured.
+func (h *VerificationHandler) CheckIdentityForInvitation(sessionID string, user *services.SDOUser) (*IdentityMatchResult, error) {
+	session, exists := h.GetSession(sessionID)
+	if !exists {
+		return nil, ErrVerificationNotFound
+	}
+	if session.Status != "completed" || session.Result != DecisionVerified {
+		return nil, ErrVerificationNotVerified
+	}
+
+	settings := h.identityMatchingConfig()
+	userID := user.ID.String()
+
+	if existing := session.IdentityMatch; existing != nil && existing.DirectoryUserID == userID && existing.Review != nil {
+		log.Printf("🪪 Using manual review (%s) for session %s and SDO user %s", existing.Review.Decision, sessionID, userID)
+		if !existing.Allowed() {
+			return existing, ErrIdentityMismatch
+		}
+		return existing, nil
+	}
+
+	directory := identity.Person{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+	}
+	claimed := identity.Person{
+		FirstName:   session.UserData.FirstName,
+		LastName:    session.UserData.LastName,
+		Email:       session.UserData.Email,
+		DateOfBirth: session.UserData.DateOfBirth,
+	}
+	var document identity.Person
+	if session.Outcome != nil {
+		document = identity.Person{
+			FirstName:   session.Outcome.FirstName,
+			LastName:    session.Outcome.LastName,
+			DateOfBirth: session.Outcome.DateOfBirth,
+		}
+	}
+
+	match := identity.Match(directory, document, claimed, identity.Options{RequireDateOfBirth: settings.RequireDateOfBirth})
+	result := &IdentityMatchResult{
+		Score:           match.Score,
+		Threshold:       settings.Threshold,
+		Components:      match.Components,
+		Reasons:         match.Reasons,
+		DirectoryUserID: userID,
+		DirectoryUser:   directory,
+		CheckedAt:       time.Now(),
+	}
+
+	switch {
+	case !settings.Enabled:
+		result.Decision = IdentityMatchPassed
+	case match.HardFail:
+		result.Decision = IdentityMatchMismatch
+	case match.Score >= settings.Threshold:
+		result.Decision = IdentityMatchPassed
+	case settings.BelowThresholdAction == IdentityActionBlock:
+		result.Decision = IdentityMatchMismatch
+	default:
+		result.Decision = IdentityMatchReview
+	}
+
+	log.Printf("🪪 Identity match for session %s and SDO user %s: %s (score %.2f, threshold %.2f, reasons %v)",
+		sessionID, userID, result.Decision, result.Score, result.Threshold, result.Reasons)
+
+	session.IdentityMatch = result
+	session.UpdatedAt = time.Now()
+	if err := h.saveSession(session); err != nil {
+		return result, fmt.Errorf("failed to store identity match: %w", err)
+	}
+
+	switch result.Decision {
+	case IdentityMatchReview:
+		return result, ErrIdentityReviewPending
+	case IdentityMatchMismatch:
+		return result, ErrIdentityMismatch
+	}
+	return result, nil
+}
+
+// awaitsOutcomeReview reports whether the provider left the decision to a manual review that has
+// not taken place yet
+func (s *VerificationSession) awaitsOutcomeReview() bool {
+	return s.Status == "completed" && s.Result == DecisionReview && s.Outcome != nil && s.Outcome.Review == nil
+}
+
+// ListIdentityReviews returns verifications whose identity match or provider outcome awaits manual
+// review
+func (h *VerificationHandler) ListIdentityReviews(c *gin.Context) {
+	var pending []*VerificationSession
+	for _, session := range h.listSessions("completed") {
+		if session.IdentityMatch != nil && session.IdentityMatch.Decision == IdentityMatchReview && session.IdentityMatch.Review == nil {
+			pending = append(pending, session)
+		} else if session.awaitsOutcomeReview() {
+			pending = append(pending, session)
+		}
+	}
+
+	c.JSON(http.StatusOK, VerificationListResponse{
+		Success:  true,
+		Count:    len(pending),
+		Sessions: pending,
+	})
+}
+
+// ReviewIdentityMatch records a manual approval or rejection of an identity match, or of a provider
+// outcome that needs review, in which case the decision becomes the verification result
+func (h *VerificationHandler) ReviewIdentityMatch(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req struct {
+		Decision string `json:"decision" binding:"required"`
+		Note     string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Decision != ReviewApproved && req.Decision != ReviewRejected) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "decision must be \"approved\" or \"rejected\"",
+		})
+		return
+	}
+
+	setAuditTarget(c, sessionID)
+	addAuditDetail(c, "decision", req.Decision)
+
+	session, exists := h.GetSession(sessionID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Verification session not found",
+		})
+		return
+	}
+	if session.IdentityMatch == nil && !session.awaitsOutcomeReview() {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "Verification has nothing to review",
+		})
+		return
+	}
+
+	reviewer := "unknown"
+	if user, ok := c.Get("user"); ok {
+		reviewer = fmt.Sprint(user)
+	}
+
+	review := &IdentityReview{
+		Decision:   req.Decision,
+		Reviewer:   reviewer,
+		Note:       req.Note,
+		ReviewedAt: time.Now(),
+	}
+	if session.IdentityMatch != nil {
+		session.IdentityMatch.Review = review
+	} else {
+		session.Outcome.Review = review
+		session.Result = DecisionFailed
+		if req.Decision == ReviewApproved {
+			session.Result = DecisionVerified
+		}
+		addAuditDetail(c, "review", "outcome")
+	}
+	session.UpdatedAt = time.Now()
+
+	if err := h.saveSession(session); err != nil {
+		log.Printf("❌ Failed to store identity review for session %s: %v", sessionID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to store review",
+		})
+		return
+	}
+
+	log.Printf("🪪 Review of session %s %s by %s", sessionID, req.Decision, reviewer)
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"result":         session.Result,
+		"outcome":        session.Outcome,
+		"identity_match": session.IdentityMatch,
+	})
+}
@@ -0,0 +1,267 @@
+// File: internal/handlers/identity_verifier.go - Identity verification providers behind one interface
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Identity verification providers, set as api.verification_provider in the portal configuration
+const (
+	ProviderAu10tix = "au10tix" // Au10tix in the mode set by api.au10tix_mode
+	ProviderOnfido  = "onfido"  // Onfido Studio workflow runs
+	ProviderMock    = "mock"    // Local stand-in with a capture page and outcomes picked by test names
+)
+
+// verificationProviders lists the providers in the order they are reported
+var verificationProviders = []string{ProviderAu10tix, ProviderOnfido, ProviderMock}
+
+// Errors shared by all providers
+var (
+	ErrVerificationResultNotReady = errors.New("verification result not ready")
+	ErrWebhookNotConfigured       = errors.New("webhook receiver is not configured")
+	ErrWebhookSignature           = errors.New("invalid webhook signature")
+	ErrWebhookTimestamp           = errors.New("webhook timestamp outside the accepted window")
+	ErrWebhookNotSupported        = errors.New("provider does not send webhooks")
+	ErrWebhookPayload             = errors.New("invalid webhook payload")
+)
+
+// ProviderSession is the session a provider created for a verification
+type ProviderSession struct {
+	Provider   string `json:"provider"`
+	SessionID  string `json:"session_id"`
+	SessionURL string `json:"session_url"`
+	Status     string `json:"status"`
+
+	// CredentialSource names where the provider's credentials came from; reported when the
+	// session is created and not stored
+	CredentialSource string `json:"-"`
+}
+
+// VerificationRequest is what a provider needs to start a session
+type VerificationRequest struct {
+	UserData VerificationStartRequest
+	Profile  WorkflowProfile
+}
+
+// ProviderResult is a provider's view of a session
+type ProviderResult struct {
+	Status         string                 // pending, in_progress, completed, failed or expired; "" when not reported
+	ProviderStatus string                 // Status string as the provider reported it, kept on the provider session
+	Outcome        *VerificationOutcome   // Set once the provider has decided
+	Score          float64                // Provider score, 0 when not reported
+	Data           map[string]interface{} // Provider response, kept on the session
+}
+
+// Final reports whether the provider has finished with the session: it decided, failed or the
+// session expired
+func (r *ProviderResult) Final() bool {
+	return r.Outcome != nil || r.Status == "failed" || r.Status == "expired"
+}
+
+// WebhookEvent is a provider callback whose signature has been verified
+type WebhookEvent struct {
+	SessionID string          // Provider session the callback is about
+	Status    string          // Provider status string, for log output
+	Result    *ProviderResult // Nil when the callback carries no result and it has to be fetched
+}
+
+// VerifierCapabilities describes what a provider supports
+type VerifierCapabilities struct {
+	Provider         string   `json:"provider"`
+	Mode             string   `json:"mode,omitempty"`    // Provider specific, e.g. the Au10tix mode
+	Checks           []string `json:"checks"`            // Checks reported in outcomes
+	WorkflowProfiles bool     `json:"workflow_profiles"` // Honours the workflow and request types of profiles
+	RedirectURLs     bool     `json:"redirect_urls"`     // Honours success_url and failure_url of profiles
+	Webhooks         bool     `json:"webhooks"`          // Results arrive at /api/webhooks/{provider}
+	Polling          bool     `json:"polling"`           // Results can be fetched
+	HostedCapture    bool     `json:"hosted_capture"`    // The capture page is served by this portal
+	Simulated        bool     `json:"simulated"`         // Results are scripted and prove nothing
+}
+
+// IdentityVerifier is an identity verification provider. The verification flow, session
+// storage, identity matching and audit only see this interface, so providers can be switched
+// with api.verification_provider.
+type IdentityVerifier interface {
+	// CreateSession starts a verification and returns the link the user completes it at
+	CreateSession(ctx context.Context, request VerificationRequest) (*ProviderSession, error)
+	// GetResult returns the current state of a provider session. It returns
+	// ErrVerificationResultNotReady when the provider knows nothing yet.
+	GetResult(ctx context.Context, sessionID string) (*ProviderResult, error)
+	// ParseWebhook authenticates and decodes a callback. It returns ErrWebhookNotConfigured,
+	// ErrWebhookSignature, ErrWebhookTimestamp, ErrWebhookNotSupported or ErrWebhookPayload when
+	// the callback cannot be accepted.
+	ParseWebhook(r *http.Request, body []byte) (*WebhookEvent, error)
+	// Capabilities describes what the provider supports
+	Capabilities() VerifierCapabilities
+}
+
+// verifierUnavailableError marks errors that make a provider unusable, such as missing or
+// expired credentials, as opposed to a request that failed
+type verifierUnavailableError struct {
+	err error
+}
+
+func (e *verifierUnavailableError) Error() string { return e.err.Error() }
+func (e *verifierUnavailableError) Unwrap() error { return e.err }
+
+// verifierUnavailable wraps err as making the provider unusable
+func verifierUnavailable(err error) error {
+	return &verifierUnavailableError{err: err}
+}
+
+// isVerifierUnavailable reports whether err makes the provider unusable
+func isVerifierUnavailable(err error) bool {
+	var unavailable *verifierUnavailableError
+	return errors.As(err, &unavailable)
+}
+
+// isVerificationProvider reports whether the value names a provider
+func isVerificationProvider(provider string) bool {
+	for _, known := range verificationProviders {
+		if provider == known {
+			return true
+		}
+	}
+	return false
+}
+
+// verificationProvider returns the configured provider; unset means Au10tix
+func verificationProvider(config *PortalConfig) string {
+	if config.API.VerificationProvider == "" {
+		return ProviderAu10tix
+	}
+	return config.API.VerificationProvider
+}
+
+// identityVerifier returns the verifier of the named provider. Creating a verifier contacts
+// nothing; missing credentials are reported by the calls that need them.
+func (h *VerificationHandler) identityVerifier(config *PortalConfig, provider string) (IdentityVerifier, error) {
+	switch provider {
+	case ProviderAu10tix:
+		return &au10tixVerifier{handler: h, config: config}, nil
+	case ProviderOnfido:
+		return &onfidoVerifier{handler: h, config: config}, nil
+	case ProviderMock:
+		if h.configHandler.production {
+			return nil, verifierUnavailable(ErrMockProviderInProduction)
+		}
+		return &mockVerifier{client: h.mock}, nil
+	default:
+		return nil, verifierUnavailable(fmt.Errorf("unknown verification provider %q", provider))
+	}
+}
+
+// sessionVerifier returns the verifier of the provider that created the session, which may
+// differ from the configured one after a switch
+func (h *VerificationHandler) sessionVerifier(config *PortalConfig, session *VerificationSession) (IdentityVerifier, error) {
+	if session.ProviderSession == nil {
+		return nil, errors.New("no provider session")
+	}
+	return h.identityVerifier(config, sessionProvider(session.ProviderSession))
+}
+
+// sessionProvider returns the provider of a provider session; sessions stored before
+// providers were pluggable belong to Au10tix
+func sessionProvider(session *ProviderSession) string {
+	if session.Provider == "" {
+		return ProviderAu10tix
+	}
+	return session.Provider
+}
+
+// UnmarshalJSON reads sessions stored before providers were pluggable, which kept the provider
+// session under au10tix_session
+func (s *VerificationSession) UnmarshalJSON(data []byte) error {
+	type plain VerificationSession
+	var decoded struct {
+		plain
+		Au10tixSession *ProviderSession `json:"au10tix_session,omitempty"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*s = VerificationSession(decoded.plain)
+	if s.ProviderSession == nil && decoded.Au10tixSession != nil {
+		s.ProviderSession = decoded.Au10tixSession
+		s.ProviderSession.Provider = ProviderAu10tix
+	}
+	return nil
+}
+
+// applyProviderResult updates a session from a provider result. A decided outcome completes
+// the session.
+func applyProviderResult(session *VerificationSession, result *ProviderResult) {
+	session.UpdatedAt = time.Now()
+	session.Data = result.Data
+
+	status := result.Status
+	if result.Outcome != nil {
+		status = "completed"
+		session.Result = result.Outcome.Decision
+		session.Outcome = result.Outcome
+	}
+	if status != "" {
+		session.Status = status
+	}
+	if result.Score != 0 {
+		session.Score = result.Score
+	}
+	if session.ProviderSession != nil && result.ProviderStatus != "" {
+		session.ProviderSession.Status = result.ProviderStatus
+	}
+
+	if session.Outcome != nil {
+		log.Printf("✅ Updated session status: %s, result: %s, score: %.2f (%s)",
+			session.Status, session.Result, session.Score, session.Outcome)
+	} else {
+		log.Printf("✅ Updated session status: %s, result: %s, score: %.2f",
+			session.Status, session.Result, session.Score)
+	}
+}
+
+// respondVerifierUnavailable answers a request that needs the provider when it cannot be used
+func respondVerifierUnavailable(c *gin.Context, err error) {
+	log.Printf("❌ Identity verification unavailable: %v", err)
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"success": false,
+		"error":   "Identity verification is unavailable: " + err.Error(),
+	})
+}
+
+// VerificationProviderStatus handles GET /api/verification/provider: the configured provider
+// and the capabilities of every provider the portal can use
+func (h *VerificationHandler) VerificationProviderStatus(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load configuration",
+		})
+		return
+	}
+
+	providers := make([]VerifierCapabilities, 0, len(verificationProviders))
+	for _, provider := range verificationProviders {
+		verifier, err := h.identityVerifier(config, provider)
+		if err != nil {
+			continue
+		}
+		providers = append(providers, verifier.Capabilities())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"provider":  verificationProvider(config),
+		"providers": providers,
+		"timestamp": time.Now().Unix(),
+	})
+}
@@ -1,21 +1,83 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"html"
 	"log"
 	"net/http"
-	"self-service-portal/internal/config"
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/models"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// Account lockout settings for portal operators
+const (
+	maxFailedLogins = 5
+	loginLockout    = 15 * time.Minute
+)
+
+// dummyPasswordHash is compared against when the account does not exist, so that unknown
+// and known accounts take the same time to reject
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), models.PasswordHashCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
 type LoginHandler struct {
-	// Add any dependencies you need
+	db  *gorm.DB
+	sso *SSOHandler
+	sdo *AuthHandler
 }
 
-func NewLoginHandler() *LoginHandler {
-	return &LoginHandler{}
+func NewLoginHandler(db *gorm.DB) *LoginHandler {
+	return &LoginHandler{db: db}
+}
+
+// SetSSOHandler enables the single sign-on options on the login page
+func (h *LoginHandler) SetSSOHandler(sso *SSOHandler) {
+	h.sso = sso
+}
+
+// SetAuthHandler makes logins attach the SDO service session through the server's credential
+// store, so that the SDO routes can resolve it and logout can revoke it. Logins fail until it is set.
+func (h *LoginHandler) SetAuthHandler(auth *AuthHandler) {
+	h.sdo = auth
+}
+
+// loginPageExtras renders the SSO buttons and any SSO error for the login page
+func (h *LoginHandler) loginPageExtras(errorCode string) (alert, buttons string) {
+	if message, ok := ssoErrorMessages[errorCode]; ok {
+		alert = `<div class="alert alert-danger" role="alert"><i class="bi bi-exclamation-triangle me-2"></i>` +
+			html.EscapeString(message) + `</div>`
+	}
+	if h.sso == nil {
+		return alert, ""
+	}
+
+	var b strings.Builder
+	for _, provider := range h.sso.Providers() {
+		fmt.Fprintf(&b, `<div class="d-grid mb-2"><a class="btn btn-outline-primary btn-lg" href="%s"><i class="bi bi-building-lock me-2"></i>Sign in with %s</a></div>`,
+			html.EscapeString(provider.LoginURL), html.EscapeString(provider.Name))
+	}
+	if b.Len() > 0 {
+		buttons = `<div class="text-center text-muted my-3">or</div>` + b.String()
+	}
+	return alert, buttons
 }
 
 func (h *LoginHandler) LoginPage(c *gin.Context) {
@@ -27,7 +89,9 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
 		return
 	}
 
-	html := `<!DOCTYPE html>
+	ssoAlert, ssoButtons := h.loginPageExtras(c.Query("error"))
+
+	page := `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
@@ -88,13 +152,6 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
             transform: translateY(-2px);
             box-shadow: 0 4px 12px rgba(102, 126, 234, 0.4);
         }
-        .demo-credentials {
-            background: #f8f9fa;
-            border-radius: 10px;
-            padding: 1rem;
-            margin-top: 1.5rem;
-            border-left: 4px solid #667eea;
-        }
         .alert {
             border-radius: 10px;
             margin-bottom: 1.5rem;
@@ -121,15 +178,15 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
                 <p class="mb-0 opacity-90">Secure Identity Management & Verification</p>
             </div>
             <div class="login-body">
-                <div id="alert-container"></div>
+                <div id="alert-container">{{SSO_ALERT}}</div>
                 
                 <form id="login-form">
                     <div class="mb-4">
                         <label for="username" class="form-label">
-                            <i class="bi bi-person me-2"></i>Username
+                            <i class="bi bi-person me-2"></i>Email
                         </label>
-                        <input type="text" class="form-control form-control-lg" id="username" name="username" 
-                               placeholder="Enter your username" required autocomplete="username">
+                        <input type="email" class="form-control form-control-lg" id="username" name="username" 
+                               placeholder="Enter your email address" required autocomplete="username">
                     </div>
                     <div class="mb-4">
                         <label for="password" class="form-label">
@@ -149,23 +206,7 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
                         </button>
                     </div>
                 </form>
-
-                <div class="demo-credentials">
-                    <h6 class="mb-2"><i class="bi bi-info-circle me-2"></i>Demo Credentials</h6>
-                    <div class="row">
-                        <div class="col-6">
-                            <small class="text-muted d-block">Username:</small>
-                            <code>admin</code>
-                        </div>
-                        <div class="col-6">
-                            <small class="text-muted d-block">Password:</small>
-                            <code>admin</code>
-                        </div>
-                    </div>
-                    <small class="text-muted d-block mt-2">
-                        <i class="bi bi-lightbulb me-1"></i>Click the credentials above to auto-fill
-                    </small>
-                </div>
+{{SSO_BUTTONS}}
 
                 <div class="text-center mt-4">
                     <small class="text-muted">
@@ -179,20 +220,9 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
 
     <script src="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/js/bootstrap.bundle.min.js"></script>
     <script src="https://code.jquery.com/jquery-3.6.0.min.js"></script>
+    <script src="/static/js/csrf.js" data-csrf-token="{{CSRF_TOKEN}}"></script>
     <script>
         $(document).ready(function() {
-            // Auto-fill demo credentials when clicked
-            $('.demo-credentials code').on('click', function() {
-                const text = $(this).text();
-                if (text === 'admin') {
-                    if ($(this).parent().find('small').text().includes('Username')) {
-                        $('#username').val(text).focus();
-                    } else {
-                        $('#password').val(text).focus();
-                    }
-                }
-            });
-
             // Toggle password visibility
             $('#toggle-password').on('click', function() {
                 const passwordField = $('#password');
@@ -216,7 +246,7 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
                 
                 // Basic validation
                 if (!username || !password) {
-                    showAlert('danger', 'Please enter both username and password');
+                    showAlert('danger', 'Please enter both email and password');
                     return;
                 }
                 
@@ -259,7 +289,9 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
                         let errorMessage = 'Login failed. Please try again.';
                         
                         if (xhr.status === 401) {
-                            errorMessage = 'Invalid username or password';
+                            errorMessage = 'Invalid email or password';
+                        } else if (xhr.status === 423 && xhr.responseJSON && xhr.responseJSON.error) {
+                            errorMessage = xhr.responseJSON.error;
                         } else if (xhr.status === 0 || status === 'timeout') {
                             errorMessage = 'Connection failed. Please check your internet connection.';
                         } else if (xhr.status === 500) {
@@ -304,8 +336,12 @@ func (h *LoginHandler) LoginPage(c *gin.Context) {
 </body>
 </html>`
 
+	page = strings.Replace(page, "{{SSO_ALERT}}", ssoAlert, 1)
+	page = strings.Replace(page, "{{SSO_BUTTONS}}", ssoButtons, 1)
+	page = strings.Replace(page, "{{CSRF_TOKEN}}", CSRFToken(c), 1)
+
 	c.Header("Content-Type", "text/html")
-	c.String(200, html)
+	c.String(200, page)
 }
 
 func (h *LoginHandler) ProcessLogin(c *gin.Context) {
@@ -319,81 +355,204 @@ func (h *LoginHandler) ProcessLogin(c *gin.Context) {
 		return
 	}
 
-	// For the portal, we use hardcoded admin credentials
-	if req.Username != "admin" || req.Password != "admin" {
+	if h.db == nil {
+		log.Printf("❌ Portal login unavailable: no database configured")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "Portal login is not available"})
+		return
+	}
+
+	log.Printf("🔐 Login attempt for user: %s", req.Username)
+	setAuditTarget(c, req.Username)
+
+	user, err := database.GetPortalUser(h.db, req.Username)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("❌ Failed to load portal user %s: %v", req.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Login failed"})
+			return
+		}
+		compareDummyPassword(req.Password)
+		log.Printf("🚫 Login failed for unknown user: %s (IP: %s)", req.Username, c.ClientIP())
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid portal credentials"})
 		return
 	}
 
-	// Authenticate with SDO using config credentials
-	cfg := config.Load()
-	authHandler := NewAuthHandler() // NewAuthHandler now takes no arguments
+	if user.PasswordHash == "" {
+		compareDummyPassword(req.Password)
+		log.Printf("🚫 Password login rejected for %s: account uses single sign-on (IP: %s)", user.Email, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid portal credentials"})
+		return
+	}
 
-	// Load portal config for SDO credentials
-	portalConfig := config.LoadPortalConfig()
-	if portalConfig == nil {
-		log.Printf("❌ Failed to load portal config")
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Configuration error"})
+	if user.IsLocked(time.Now()) {
+		log.Printf("🔒 Login rejected for locked account: %s (locked until %s, IP: %s)",
+			user.Email, user.LockedUntil.Format(time.RFC3339), c.ClientIP())
+		c.JSON(http.StatusLocked, gin.H{
+			"success": false,
+			"error":   "Account is temporarily locked after repeated failed logins. Please try again later.",
+		})
 		return
 	}
 
-	// Use the SDO credentials from the config for the main login
-	// The config should have the full URL with protocol
-	sdoURL := cfg.SDODefaultURL
-	if sdoURL != "" && !strings.HasPrefix(sdoURL, "http") {
-		sdoURL = "https://" + sdoURL
+	if !user.CheckPassword(req.Password) {
+		user.RegisterFailedLogin(maxFailedLogins, loginLockout)
+		if err := database.SaveUser(h.db, user); err != nil {
+			log.Printf("⚠️ Failed to record failed login for %s: %v", user.Email, err)
+		}
+		if user.IsLocked(time.Now()) {
+			log.Printf("🔒 Account locked after %d failed logins: %s (IP: %s)", maxFailedLogins, user.Email, c.ClientIP())
+		} else {
+			log.Printf("🚫 Invalid password for user: %s (%d failed attempts, IP: %s)", user.Email, user.FailedLoginAttempts, c.ClientIP())
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Invalid portal credentials"})
+		return
 	}
-	log.Printf("🔍 Debug: SDO URL from config: %s", cfg.SDODefaultURL)
-	log.Printf("🔍 Debug: Final SDO URL: %s", sdoURL)
-	sdoAuthSuccessful := authHandler.performSDOAuth(c, sdoURL, portalConfig.Auth.SDOEmail, portalConfig.Auth.SDOPassword)
 
-	if !sdoAuthSuccessful {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "SDO Authentication failed"})
+	if err := h.startPortalSession(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
 	}
 
+	log.Printf("✅ Login successful for user: %s", user.Email)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Login successful",
+		"user": gin.H{
+			"email":      user.Email,
+			"name":       user.FullName(),
+			"role":       user.Role,
+			"last_login": user.LastLogin,
+		},
+	})
+}
+
+// Errors returned by startPortalSession; their messages are shown to the user
+var (
+	errPortalConfigMissing = errors.New("Configuration error")
+	errSDOAuthFailed       = errors.New("SDO Authentication failed")
+	errSessionSaveFailed   = errors.New("Failed to save portal session")
+)
+
+// startPortalSession completes a login for an authenticated operator: it attaches the session to
+// the portal's shared SDO service account, records the login and marks the gin session as logged in.
+// Password and single sign-on logins both finish here.
+func (h *LoginHandler) startPortalSession(c *gin.Context, user *models.User) error {
+	if h.sdo == nil {
+		log.Printf("❌ Login for %s refused: no SDO auth handler configured (SetAuthHandler was not called)", user.Email)
+		return errPortalConfigMissing
+	}
+
+	// Borrow the shared service account session instead of signing in to SDO for every login
+	if err := h.sdo.startSDOServiceSession(c); err != nil {
+		var saveErr *sdoSessionSaveError
+		switch {
+		case errors.Is(err, errSDOServiceAccountMissing):
+			return errPortalConfigMissing
+		case errors.As(err, &saveErr):
+			return errSessionSaveFailed
+		default:
+			log.Printf("❌ SDO service account sign-in failed for %s: %v", user.Email, err)
+			return errSDOAuthFailed
+		}
+	}
+
+	user.RegisterSuccessfulLogin()
+	if err := database.SaveUser(h.db, user); err != nil {
+		log.Printf("⚠️ Failed to record last login for %s: %v", user.Email, err)
+	}
+
 	// Portal login is successful, and SDO auth is now stored in the session
 	session := sessions.Default(c)
-	session.Set("username", "admin")
+	session.Set("username", user.Email)
+	session.Set("user_id", user.ID)
 	session.Set("authenticated", true)
+	rotateCSRFToken(session)
 	if err := session.Save(); err != nil {
 		log.Printf("❌ Failed to save session: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to save portal session"})
+		return errSessionSaveFailed
+	}
+	return nil
+}
+
+// ChangePassword handles POST /api/auth/change-password for the logged-in portal operator
+func (h *LoginHandler) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request format"})
 		return
 	}
 
-	log.Printf("🔐 Login attempt for user: %s", req.Username)
-	log.Printf("✅ Login successful for user: %s", req.Username)
-	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Login successful"})
-}
+	if h.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "Portal accounts are not available"})
+		return
+	}
 
-func (h *LoginHandler) validateCredentials(username, password string) bool {
-	// Enhanced validation logic
-	// For demo purposes, we support multiple valid combinations
-	validCredentials := map[string]string{
-		"admin":    "admin",
-		"user":     "user",
-		"demo":     "demo",
-		"test":     "test",
-		"manager":  "manager",
-		"operator": "operator",
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Not logged in"})
+		return
+	}
+
+	user, err := database.GetUserByID(h.db, userID)
+	if err != nil || !user.IsPortalOperator() {
+		log.Printf("❌ Failed to load portal user %d for password change: %v", userID, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "Not logged in"})
+		return
+	}
+
+	if user.PasswordHash == "" {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "This account signs in with single sign-on and has no portal password"})
+		return
+	}
+	if !user.CheckPassword(req.CurrentPassword) {
+		log.Printf("🚫 Password change rejected for %s: current password is wrong (IP: %s)", user.Email, c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "Current password is incorrect"})
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "New password must be different from the current password"})
+		return
+	}
+	if err := models.ValidatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
 	}
 
-	// Check if username exists and password matches
-	if validPassword, exists := validCredentials[username]; exists {
-		return password == validPassword
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		log.Printf("❌ Failed to hash new password for %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to change password"})
+		return
+	}
+	if err := database.SaveUser(h.db, user); err != nil {
+		log.Printf("❌ Failed to store new password for %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to change password"})
+		return
 	}
 
-	// Also accept any non-empty credentials for flexibility (remove in production)
-	return len(username) > 0 && len(password) > 0
+	log.Printf("🔑 Password changed for user: %s", user.Email)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Password changed"})
 }
 
 func (h *LoginHandler) Logout(c *gin.Context) {
 	session := sessions.Default(c)
 
 	// Log the logout
-	if username := session.Get("username"); username != nil {
+	if username, ok := session.Get("username").(string); ok && username != "" {
 		log.Printf("🚪 User logout: %s", username)
+		// The session is cleared below; keep the operator as the actor of the audit event
+		c.Set("user", username)
+		setAuditTarget(c, username)
+	}
+
+	// Revoke the SDO connection so the credential cannot outlive the session
+	if h.sdo != nil {
+		h.sdo.revokeSessionCredential(session)
+	} else {
+		log.Printf("❌ Cannot revoke the SDO credential on logout: no SDO auth handler configured")
 	}
 
 	// Clear session
@@ -419,9 +578,16 @@ func (h *LoginHandler) CheckAuth(c *gin.Context) {
 	username := session.Get("username")
 
 	if authenticated != nil && authenticated.(bool) {
+		role := ""
+		if userID, ok := session.Get("user_id").(uint); ok && h.db != nil {
+			if user, err := database.GetUserByID(h.db, userID); err == nil {
+				role = user.Role
+			}
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"authenticated": true,
 			"user":          username,
+			"role":          role,
 		})
 	} else {
 		c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,171 @@
+// File: internal/handlers/mock_verifier.go - Local mock identity verification provider
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+
+	"self-service-portal/internal/services/au10tix"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mockCapturePath serves the capture page of the mock provider
+const mockCapturePath = "/verification/mock"
+
+// ErrMockProviderInProduction refuses the mock provider, which approves verifications with
+// scripted results, on a portal running with ENVIRONMENT=production
+var ErrMockProviderInProduction = errors.New("the mock verification provider cannot be used when ENVIRONMENT=production")
+
+// mockVerifier answers verifications locally with the demo provider's scripted results. The
+// scenario is picked by keywords in the test user's name or email, e.g. "Review Tester", and
+// the capture page served by the portal lets the tester finish the session at once.
+type mockVerifier struct {
+	client *au10tix.DemoClient
+}
+
+// CreateSession starts a scripted session whose capture page is /verification/mock/{id}
+func (v *mockVerifier) CreateSession(ctx context.Context, request VerificationRequest) (*ProviderSession, error) {
+	session, err := createAu10tixWorkflow(ctx, v.client, request, ProviderMock)
+	if err != nil {
+		return nil, err
+	}
+	session.CredentialSource = ProviderMock
+	return session, nil
+}
+
+// GetResult returns the scripted result once the capture page was submitted or the processing
+// time has passed
+func (v *mockVerifier) GetResult(ctx context.Context, sessionID string) (*ProviderResult, error) {
+	return au10tixResult(ctx, v.client, sessionID, ProviderMock)
+}
+
+// ParseWebhook rejects callbacks; the capture page reports results directly
+func (v *mockVerifier) ParseWebhook(r *http.Request, body []byte) (*WebhookEvent, error) {
+	return nil, ErrWebhookNotSupported
+}
+
+// Capabilities describes the mock provider
+func (v *mockVerifier) Capabilities() VerifierCapabilities {
+	return VerifierCapabilities{
+		Provider:         ProviderMock,
+		Checks:           au10tixChecks,
+		WorkflowProfiles: true,
+		Polling:          true,
+		HostedCapture:    true,
+		Simulated:        true,
+	}
+}
+
+// mockProviderEnabled reports whether the mock provider is configured; its pages do not exist
+// otherwise, and never in production
+func (h *VerificationHandler) mockProviderEnabled() bool {
+	if h.configHandler.production {
+		return false
+	}
+	config, err := h.configHandler.LoadConfig()
+	return err == nil && verificationProvider(config) == ProviderMock
+}
+
+// MockCapturePage handles GET /verification/mock/:id, the capture page of the mock provider
+func (h *VerificationHandler) MockCapturePage(c *gin.Context) {
+	if !h.mockProviderEnabled() {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	id := c.Param("id")
+	scenario := h.mock.Scenario(id)
+	if scenario == "" {
+		c.String(http.StatusNotFound, "Mock session not found")
+		return
+	}
+
+	h.renderMockCapturePage(c, id, scenario, h.mock.Submitted(id))
+}
+
+// MockCaptureSubmit handles POST /verification/mock/:id/submit. It completes the capture, makes
+// the scripted result available and stores it on the verification right away.
+func (h *VerificationHandler) MockCaptureSubmit(c *gin.Context) {
+	if !h.mockProviderEnabled() {
+		c.String(http.StatusNotFound, "Not found")
+		return
+	}
+
+	id := c.Param("id")
+	scenario := h.mock.Scenario(id)
+	if scenario == "" || !h.mock.Submit(id) {
+		c.String(http.StatusNotFound, "Mock session not found")
+		return
+	}
+	log.Printf("🧪 Mock capture submitted for session %s (scenario: %s)", id, scenario)
+
+	if _, sessionID, found := h.GetSessionByProviderSession(ProviderMock, id); found {
+		if err := h.PollForResults(sessionID); err != nil {
+			log.Printf("⚠️ Failed to store mock result for session %s: %v", sessionID, err)
+		}
+	}
+
+	h.renderMockCapturePage(c, id, scenario, true)
+}
+
+// renderMockCapturePage renders the capture form, or the confirmation once it was submitted
+func (h *VerificationHandler) renderMockCapturePage(c *gin.Context, id, scenario string, submitted bool) {
+	body := mockCaptureForm
+	if submitted {
+		body = mockCaptureDone
+	}
+
+	page := strings.NewReplacer(
+		"{{SCENARIO}}", html.EscapeString(scenario),
+		"{{SECONDS}}", fmt.Sprint(int(h.mock.ProcessingTime().Seconds())),
+		"{{ACTION}}", html.EscapeString(mockCapturePath+"/"+id+"/submit"),
+		"{{CSRF_TOKEN}}", html.EscapeString(CSRFToken(c)),
+	).Replace(strings.Replace(mockCapturePage, "{{BODY}}", body, 1))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// mockCapturePage stands in for a provider's hosted capture experience
+const mockCapturePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Mock Verification - Self Service Portal</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+</head>
+<body class="bg-light">
+    <div class="container py-5" style="max-width: 560px;">
+        <div class="alert alert-warning">
+            <strong>Mock provider.</strong> This portal is not connected to an identity verification
+            provider. No documents or photos are captured and no real identity check takes place.
+        </div>
+        <div class="card shadow-sm">
+            <div class="card-body">
+                <h5 class="card-title">Identity verification (mock)</h5>
+                {{BODY}}
+            </div>
+        </div>
+    </div>
+</body>
+</html>`
+
+// mockCaptureForm offers to finish the capture before the processing time has passed
+const mockCaptureForm = `<p class="card-text">This session plays the <code>{{SCENARIO}}</code> scenario. Submit
+                the capture to get its result now, or wait about {{SECONDS}} seconds.</p>
+                <form method="post" action="{{ACTION}}">
+                    <input type="hidden" name="csrf_token" value="{{CSRF_TOKEN}}">
+                    <button type="submit" class="btn btn-primary">Submit capture</button>
+                </form>
+                <p class="card-text text-muted small mt-3">Put <code>fail</code>, <code>review</code>,
+                <code>expired</code> or <code>mismatch</code> in the test user's name or email address to
+                play another scenario.</p>`
+
+// mockCaptureDone confirms a submitted capture
+const mockCaptureDone = `<p class="card-text">The capture was submitted. The <code>{{SCENARIO}}</code> result
+                is available to the portal; you can return to the verification page.</p>`
@@ -0,0 +1,270 @@
+// File: internal/handlers/onfido_verifier.go - Onfido Studio workflow runs as an identity verification provider
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"self-service-portal/internal/secrets"
+	"self-service-portal/internal/services/onfido"
+)
+
+// Errors that make the Onfido provider unavailable
+var (
+	ErrOnfidoTokenMissing = errors.New("Onfido API token is not configured")
+	ErrOnfidoNoWorkflow   = errors.New("Onfido workflow ID is not configured")
+)
+
+// onfidoStatusMap maps workflow run statuses to session statuses
+var onfidoStatusMap = map[string]string{
+	onfido.StatusAwaitingInput: "pending",
+	onfido.StatusProcessing:    "in_progress",
+	onfido.StatusApproved:      "completed",
+	onfido.StatusDeclined:      "completed",
+	onfido.StatusReview:        "completed",
+	onfido.StatusAbandoned:     "expired",
+	onfido.StatusError:         "failed",
+}
+
+// onfidoDecisionMap maps the final workflow run statuses to a decision
+var onfidoDecisionMap = map[string]string{
+	onfido.StatusApproved: DecisionVerified,
+	onfido.StatusDeclined: DecisionFailed,
+	onfido.StatusReview:   DecisionReview,
+}
+
+// onfidoCheckMap maps Onfido report results and sub-results to a check state
+var onfidoCheckMap = map[string]string{
+	"clear":     CheckPassed,
+	"consider":  CheckInconclusive,
+	"caution":   CheckInconclusive,
+	"suspected": CheckInconclusive,
+	"rejected":  CheckFailed,
+}
+
+// onfidoVerifier runs verifications as runs of the configured Onfido Studio workflow. Studio
+// decides which checks run, so workflow profiles only contribute their redirect URLs.
+type onfidoVerifier struct {
+	handler *VerificationHandler
+	config  *PortalConfig
+}
+
+// client returns an API client with the configured token, and where the token came from
+func (v *onfidoVerifier) client(ctx context.Context) (*onfido.Client, string, error) {
+	token, source, err := v.handler.configHandler.secretStore.Lookup(ctx, secrets.OnfidoAPIToken)
+	if errors.Is(err, secrets.ErrNotFound) || (err == nil && token == "") {
+		return nil, "", verifierUnavailable(ErrOnfidoTokenMissing)
+	}
+	if err != nil {
+		return nil, "", verifierUnavailable(fmt.Errorf("failed to load Onfido API token: %w", err))
+	}
+
+	baseURL := v.config.API.OnfidoBaseURL
+	if baseURL == "" {
+		baseURL = onfido.DefaultBaseURL
+	}
+	if err := validateOnfidoBaseURL(baseURL); err != nil {
+		return nil, "", verifierUnavailable(err)
+	}
+	timeout := time.Duration(v.config.API.APITimeout) * time.Second
+	return onfido.NewClient(baseURL, token, timeout), source, nil
+}
+
+// CreateSession creates an applicant for the user and starts the workflow for them
+func (v *onfidoVerifier) CreateSession(ctx context.Context, request VerificationRequest) (*ProviderSession, error) {
+	workflowID := strings.TrimSpace(v.config.API.OnfidoWorkflowID)
+	if workflowID == "" {
+		return nil, verifierUnavailable(ErrOnfidoNoWorkflow)
+	}
+	client, source, err := v.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userData := request.UserData
+	applicant := onfido.Applicant{
+		FirstName: userData.FirstName,
+		LastName:  userData.LastName,
+		Email:     userData.Email,
+	}
+	// Onfido only accepts ISO dates of birth
+	if _, err := time.Parse("2006-01-02", userData.DateOfBirth); err == nil {
+		applicant.DOB = userData.DateOfBirth
+	}
+	created, err := client.CreateApplicant(ctx, applicant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Onfido applicant: %w", err)
+	}
+
+	runRequest := onfido.WorkflowRunRequest{WorkflowID: workflowID, ApplicantID: created.ID}
+	if request.Profile.SuccessURL != "" || request.Profile.FailureURL != "" {
+		runRequest.Link = &onfido.WorkflowRunLink{
+			CompletedRedirectURL: request.Profile.SuccessURL,
+			ExpiredRedirectURL:   request.Profile.FailureURL,
+		}
+	}
+	run, err := client.CreateWorkflowRun(ctx, runRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Onfido workflow run: %w", err)
+	}
+	if run.Link.URL == "" {
+		return nil, fmt.Errorf("Onfido workflow run %s has no link", run.ID)
+	}
+
+	session := &ProviderSession{
+		Provider:         ProviderOnfido,
+		SessionID:        run.ID,
+		SessionURL:       run.Link.URL,
+		Status:           "created",
+		CredentialSource: source,
+	}
+	log.Printf("✅ Onfido session created successfully:")
+	log.Printf("   Workflow run ID: %s (applicant: %s)", session.SessionID, created.ID)
+	log.Printf("   Verification URL: %s", session.SessionURL)
+	return session, nil
+}
+
+// GetResult returns the state of the workflow run, with an outcome once it has finished
+func (v *onfidoVerifier) GetResult(ctx context.Context, sessionID string) (*ProviderResult, error) {
+	client, _, err := v.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := client.GetWorkflowRun(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return onfidoProviderResult(run), nil
+}
+
+// ParseWebhook authenticates a callback with the webhook token. Onfido notifications carry no
+// result, so the run is fetched afterwards.
+func (v *onfidoVerifier) ParseWebhook(r *http.Request, body []byte) (*WebhookEvent, error) {
+	token, err := v.handler.configHandler.secretStore.Get(r.Context(), secrets.OnfidoWebhookToken)
+	if err != nil && !errors.Is(err, secrets.ErrNotFound) {
+		log.Printf("⚠️ Failed to load Onfido webhook token: %v", err)
+	}
+	if token == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+	if !onfido.VerifySignature(token, body, r.Header.Get(onfido.SignatureHeader)) {
+		return nil, ErrWebhookSignature
+	}
+
+	event, err := onfido.ParseWebhook(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookPayload, err)
+	}
+	if event.Payload.ResourceType != "workflow_run" {
+		return nil, fmt.Errorf("%w: %s events are not handled", ErrWebhookPayload, event.Payload.ResourceType)
+	}
+	return &WebhookEvent{SessionID: event.Payload.Object.ID, Status: event.Payload.Object.Status}, nil
+}
+
+// Capabilities describes the Onfido provider
+func (v *onfidoVerifier) Capabilities() VerifierCapabilities {
+	return VerifierCapabilities{
+		Provider:     ProviderOnfido,
+		Checks:       au10tixChecks,
+		RedirectURLs: true,
+		Webhooks:     true,
+		Polling:      true,
+	}
+}
+
+// onfidoProviderResult converts a workflow run. The workflow's outputs are read for the
+// document details and check results when Studio was set up to return them.
+func onfidoProviderResult(run *onfido.WorkflowRun) *ProviderResult {
+	result := &ProviderResult{Status: onfidoStatusMap[run.Status], ProviderStatus: run.Status, Data: run.Raw}
+	if result.Status == "" {
+		log.Printf("📊 Unknown Onfido workflow run status: %s", run.Status)
+		result.Status = "pending"
+	}
+
+	decision := onfidoDecisionMap[run.Status]
+	if decision == "" {
+		return result
+	}
+
+	output := run.Output
+	result.Outcome = &VerificationOutcome{
+		Decision:             decision,
+		DocumentType:         onfidoOutput(output, "document_type"),
+		DocumentNumber:       onfidoOutput(output, "document_number"),
+		IssuingCountry:       onfidoOutput(output, "issuing_country"),
+		DocumentAuthenticity: onfidoCheck(output, "document_report", "document"),
+		FaceMatch:            onfidoCheck(output, "facial_similarity_report", "facial_similarity", "face_match"),
+		Liveness:             onfidoCheck(output, "liveness_report", "liveness"),
+		FirstName:            onfidoOutput(output, "first_name"),
+		LastName:             onfidoOutput(output, "last_name"),
+		DateOfBirth:          onfidoOutput(output, "date_of_birth", "dob"),
+		ExpiryDate:           onfidoOutput(output, "date_of_expiry", "expiry_date"),
+		ReasonCodes:          run.Reasons,
+		Provider:             ProviderOnfido,
+		EvaluatedAt:          time.Now(),
+	}
+	return result
+}
+
+// onfidoOutput returns the first non-empty string output found for keys
+func onfidoOutput(output map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := output[key].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// onfidoCheck returns the check state of the first report output found for keys. Reports are
+// either a result string or an object with result and sub_result.
+func onfidoCheck(output map[string]interface{}, keys ...string) VerificationCheck {
+	for _, key := range keys {
+		switch report := output[key].(type) {
+		case string:
+			if state, ok := onfidoCheckMap[normalizeKey(report)]; ok {
+				return VerificationCheck{Status: state}
+			}
+		case map[string]interface{}:
+			state := ""
+			for _, field := range []string{"sub_result", "result"} {
+				if value, ok := report[field].(string); ok {
+					if state = onfidoCheckMap[normalizeKey(value)]; state != "" {
+						break
+					}
+				}
+			}
+			if state != "" {
+				return VerificationCheck{Status: state, ReasonCodes: reasonCodes(report)}
+			}
+		}
+	}
+	return VerificationCheck{Status: CheckNotPerformed}
+}
+
+// validateOnfidoBaseURL accepts https URLs, and http only on the loopback interface where a
+// local stand-in for the API runs
+func validateOnfidoBaseURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("api.onfido_base_url must be an absolute URL")
+	}
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := parsed.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("api.onfido_base_url must use https")
+}
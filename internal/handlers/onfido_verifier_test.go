@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"self-service-portal/internal/secrets"
+	"self-service-portal/internal/services/onfido"
+)
+
+const (
+	testOnfidoAPIToken     = "test-api-token"
+	testOnfidoWebhookToken = "test-webhook-token"
+	testOnfidoWorkflowID   = "workflow-1"
+)
+
+// onfidoTestAPI stands in for the Onfido API: one applicant, and workflow runs whose state is
+// set by the test
+type onfidoTestAPI struct {
+	t    *testing.T
+	runs map[string]map[string]interface{}
+}
+
+func (api *onfidoTestAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Token token="+testOnfidoAPIToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"type": "authorization_error", "message": "Invalid token"},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v3.6/applicants":
+		var applicant onfido.Applicant
+		if err := json.NewDecoder(r.Body).Decode(&applicant); err != nil {
+			api.t.Errorf("applicant body: %v", err)
+		}
+		if applicant.FirstName != "Jane" || applicant.LastName != "Doe" || applicant.DOB != "1990-01-31" {
+			api.t.Errorf("applicant = %+v", applicant)
+		}
+		applicant.ID = "applicant-1"
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(applicant)
+
+	case r.Method == http.MethodPost && r.URL.Path == "/v3.6/workflow_runs":
+		var request onfido.WorkflowRunRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			api.t.Errorf("workflow run body: %v", err)
+		}
+		if request.WorkflowID != testOnfidoWorkflowID || request.ApplicantID != "applicant-1" {
+			api.t.Errorf("workflow run request = %+v", request)
+		}
+		if request.Link == nil || request.Link.CompletedRedirectURL != "https://portal.example/done" {
+			api.t.Errorf("workflow run link = %+v", request.Link)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":           "run-1",
+			"workflow_id":  request.WorkflowID,
+			"applicant_id": request.ApplicantID,
+			"status":       onfido.StatusAwaitingInput,
+			"link":         map[string]string{"url": "https://id.onfido.test/run-1"},
+		})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v3.6/workflow_runs/"):
+		run, ok := api.runs[strings.TrimPrefix(r.URL.Path, "/v3.6/workflow_runs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{"type": "resource_not_found", "message": "Workflow run not found"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(run)
+
+	default:
+		api.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newOnfidoTestVerifier returns an Onfido verifier against the stand-in API, with the secrets
+// read from a directory holding the given files
+func newOnfidoTestVerifier(t *testing.T, api *onfidoTestAPI, secretFiles map[string]string) *onfidoVerifier {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, value := range secretFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	handler := &VerificationHandler{
+		configHandler: &ConfigHandler{secretStore: secrets.NewStore(0, secrets.NewDirProvider(dir))},
+	}
+	config := &PortalConfig{API: APIConfig{
+		VerificationProvider: ProviderOnfido,
+		OnfidoBaseURL:        server.URL,
+		OnfidoWorkflowID:     testOnfidoWorkflowID,
+		APITimeout:           5,
+	}}
+	return &onfidoVerifier{handler: handler, config: config}
+}
+
+func onfidoTestSecrets() map[string]string {
+	return map[string]string{
+		secrets.OnfidoAPIToken:     testOnfidoAPIToken,
+		secrets.OnfidoWebhookToken: testOnfidoWebhookToken,
+	}
+}
+
+func TestOnfidoCreateSession(t *testing.T) {
+	verifier := newOnfidoTestVerifier(t, &onfidoTestAPI{t: t}, onfidoTestSecrets())
+
+	session, err := verifier.CreateSession(context.Background(), VerificationRequest{
+		UserData: VerificationStartRequest{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", DateOfBirth: "1990-01-31"},
+		Profile:  WorkflowProfile{SuccessURL: "https://portal.example/done"},
+	})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if session.Provider != ProviderOnfido || session.SessionID != "run-1" || session.SessionURL != "https://id.onfido.test/run-1" {
+		t.Errorf("session = %+v", session)
+	}
+	if session.Status != "created" || session.CredentialSource != "dir" {
+		t.Errorf("status = %q, credential source = %q", session.Status, session.CredentialSource)
+	}
+}
+
+func TestOnfidoCreateSessionUnavailable(t *testing.T) {
+	tests := []struct {
+		name       string
+		secrets    map[string]string
+		workflowID string
+		want       error
+	}{
+		{name: "missing token", secrets: map[string]string{}, workflowID: testOnfidoWorkflowID, want: ErrOnfidoTokenMissing},
+		{name: "missing workflow", secrets: onfidoTestSecrets(), want: ErrOnfidoNoWorkflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := newOnfidoTestVerifier(t, &onfidoTestAPI{t: t}, tt.secrets)
+			verifier.config.API.OnfidoWorkflowID = tt.workflowID
+
+			_, err := verifier.CreateSession(context.Background(), VerificationRequest{})
+			if !errors.Is(err, tt.want) || !isVerifierUnavailable(err) {
+				t.Errorf("err = %v, want unavailable %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnfidoCreateSessionRejectedToken(t *testing.T) {
+	verifier := newOnfidoTestVerifier(t, &onfidoTestAPI{t: t}, map[string]string{secrets.OnfidoAPIToken: "wrong-token"})
+
+	_, err := verifier.CreateSession(context.Background(), VerificationRequest{
+		UserData: VerificationStartRequest{FirstName: "Jane", LastName: "Doe"},
+	})
+	var apiErr *onfido.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("err = %v, want a 401 API error", err)
+	}
+}
+
+func TestOnfidoGetResult(t *testing.T) {
+	api := &onfidoTestAPI{t: t, runs: map[string]map[string]interface{}{
+		"run-approved": {
+			"id":     "run-approved",
+			"status": onfido.StatusApproved,
+			"output": map[string]interface{}{
+				"document_type":            "passport",
+				"first_name":               "Jane",
+				"last_name":                "Doe",
+				"document_report":          map[string]interface{}{"result": "clear"},
+				"facial_similarity_report": "consider",
+			},
+		},
+		"run-declined":   {"id": "run-declined", "status": onfido.StatusDeclined, "reasons": []string{"document_expired"}},
+		"run-processing": {"id": "run-processing", "status": onfido.StatusProcessing},
+		"run-abandoned":  {"id": "run-abandoned", "status": onfido.StatusAbandoned},
+	}}
+	verifier := newOnfidoTestVerifier(t, api, onfidoTestSecrets())
+
+	tests := []struct {
+		run      string
+		status   string
+		decision string
+	}{
+		{run: "run-approved", status: "completed", decision: DecisionVerified},
+		{run: "run-declined", status: "completed", decision: DecisionFailed},
+		{run: "run-processing", status: "in_progress"},
+		{run: "run-abandoned", status: "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.run, func(t *testing.T) {
+			result, err := verifier.GetResult(context.Background(), tt.run)
+			if err != nil {
+				t.Fatalf("GetResult: %v", err)
+			}
+			if result.Status != tt.status || result.ProviderStatus != api.runs[tt.run]["status"] {
+				t.Errorf("status = %q (provider %q)", result.Status, result.ProviderStatus)
+			}
+			if tt.decision == "" {
+				if result.Outcome != nil {
+					t.Errorf("outcome = %+v, want none", result.Outcome)
+				}
+				return
+			}
+			if result.Outcome == nil || result.Outcome.Decision != tt.decision || result.Outcome.Provider != ProviderOnfido {
+				t.Fatalf("outcome = %+v, want decision %q", result.Outcome, tt.decision)
+			}
+		})
+	}
+
+	result, err := verifier.GetResult(context.Background(), "run-approved")
+	if err != nil {
+		t.Fatalf("GetResult: %v", err)
+	}
+	outcome := result.Outcome
+	if outcome.DocumentType != "passport" || outcome.FirstName != "Jane" || outcome.LastName != "Doe" {
+		t.Errorf("outcome details = %+v", outcome)
+	}
+	if outcome.DocumentAuthenticity.Status != CheckPassed || outcome.FaceMatch.Status != CheckInconclusive || outcome.Liveness.Status != CheckNotPerformed {
+		t.Errorf("checks = %+v, %+v, %+v", outcome.DocumentAuthenticity, outcome.FaceMatch, outcome.Liveness)
+	}
+
+	if _, err := verifier.GetResult(context.Background(), "run-unknown"); err == nil {
+		t.Error("GetResult of an unknown run succeeded")
+	}
+}
+
+func TestOnfidoParseWebhook(t *testing.T) {
+	body := []byte(`{"payload":{"resource_type":"workflow_run","action":"workflow_run.completed","object":{"id":"run-1","status":"approved"}}}`)
+	checkBody := []byte(`{"payload":{"resource_type":"check","action":"check.completed","object":{"id":"check-1","status":"complete"}}}`)
+	sign := func(token string, body []byte) string {
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name      string
+		secrets   map[string]string
+		body      []byte
+		signature string
+		want      error
+	}{
+		{name: "valid signature", secrets: onfidoTestSecrets(), body: body, signature: sign(testOnfidoWebhookToken, body)},
+		{name: "signed with another token", secrets: onfidoTestSecrets(), body: body, signature: sign("another-token", body), want: ErrWebhookSignature},
+		{name: "missing signature", secrets: onfidoTestSecrets(), body: body, want: ErrWebhookSignature},
+		{name: "malformed signature", secrets: onfidoTestSecrets(), body: body, signature: "not-hex", want: ErrWebhookSignature},
+		{name: "tampered body", secrets: onfidoTestSecrets(), body: []byte(strings.Replace(string(body), "approved", "declined", 1)), signature: sign(testOnfidoWebhookToken, body), want: ErrWebhookSignature},
+		{name: "no webhook token", secrets: map[string]string{secrets.OnfidoAPIToken: testOnfidoAPIToken}, body: body, signature: sign(testOnfidoWebhookToken, body), want: ErrWebhookNotConfigured},
+		{name: "other resource", secrets: onfidoTestSecrets(), body: checkBody, signature: sign(testOnfidoWebhookToken, checkBody), want: ErrWebhookPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := newOnfidoTestVerifier(t, &onfidoTestAPI{t: t}, tt.secrets)
+
+			request := httptest.NewRequest(http.MethodPost, "/api/webhooks/onfido", strings.NewReader(string(tt.body)))
+			if tt.signature != "" {
+				request.Header.Set(onfido.SignatureHeader, tt.signature)
+			}
+			event, err := verifier.ParseWebhook(request, tt.body)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("err = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+			if event.SessionID != "run-1" || event.Status != onfido.StatusApproved || event.Result != nil {
+				t.Errorf("event = %+v", event)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// File: internal/handlers/portal_users.go - Management of portal operator accounts
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// portalUserView is the representation of a portal operator returned by the API
+func portalUserView(user *models.User) gin.H {
+	return gin.H{
+		"id":                    user.ID,
+		"email":                 user.Email,
+		"first_name":            user.FirstName,
+		"last_name":             user.LastName,
+		"role":                  user.Role,
+		"last_login":            user.LastLogin,
+		"password_changed_at":   user.PasswordChangedAt,
+		"failed_login_attempts": user.FailedLoginAttempts,
+		"locked_until":          user.LockedUntil,
+		"identity_provider":     user.IdentityProvider,
+		"sso_link_allowed":      user.SSOLinkAllowed,
+		"created_at":            user.CreatedAt,
+	}
+}
+
+// ListPortalUsers handles GET /api/portal-users
+func (h *LoginHandler) ListPortalUsers(c *gin.Context) {
+	users, err := database.ListPortalUsers(h.db)
+	if err != nil {
+		log.Printf("❌ Failed to list portal users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to list portal users"})
+		return
+	}
+
+	views := make([]gin.H, 0, len(users))
+	for i := range users {
+		views = append(views, portalUserView(&users[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "count": len(views), "users": views})
+}
+
+// CreatePortalUser handles POST /api/portal-users and creates an operator account
+func (h *LoginHandler) CreatePortalUser(c *gin.Context) {
+	var req struct {
+		Email     string `json:"email" binding:"required"`
+		FirstName string `json:"first_name" binding:"required"`
+		LastName  string `json:"last_name" binding:"required"`
+		Password  string `json:"password" binding:"required"`
+		Role      string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request: " + err.Error()})
+		return
+	}
+	if !models.IsOperatorRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "role must be admin, helpdesk or auditor"})
+		return
+	}
+	if err := models.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	setAuditTarget(c, email)
+	addAuditDetail(c, "role", req.Role)
+	if existing, err := database.GetPortalUser(h.db, email); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "A portal account with this email already exists"})
+		return
+	}
+
+	// End users who went through verification already have a row; promote it instead of duplicating
+	user, err := database.FindOrCreateUser(h.db, email, req.FirstName, req.LastName)
+	if err != nil {
+		log.Printf("❌ Failed to create portal user %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create portal user"})
+		return
+	}
+	user.FirstName = req.FirstName
+	user.LastName = req.LastName
+	user.Role = req.Role
+	if err := user.SetPassword(req.Password); err != nil {
+		log.Printf("❌ Failed to hash password for %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create portal user"})
+		return
+	}
+	if err := database.SaveUser(h.db, user); err != nil {
+		log.Printf("❌ Failed to store portal user %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to create portal user"})
+		return
+	}
+
+	log.Printf("👤 Portal user %s created with role %s by %s", user.Email, user.Role, c.GetString("user"))
+	c.JSON(http.StatusCreated, gin.H{"success": true, "user": portalUserView(user)})
+}
+
+// UpdatePortalUser handles PATCH /api/portal-users/:id to change a role, reset a password or unlock
+func (h *LoginHandler) UpdatePortalUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Role         *string `json:"role"`
+		Password     *string `json:"password"`
+		Unlock       bool    `json:"unlock"`
+		AllowSSOLink *bool   `json:"allow_sso_link"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, err := database.GetUserByID(h.db, uint(id))
+	if err != nil || !user.IsPortalOperator() {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("❌ Failed to load portal user %d: %v", id, err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Portal user not found"})
+		return
+	}
+	setAuditTarget(c, user.Email)
+
+	actor := c.GetString("user")
+	if req.Role != nil && *req.Role != user.Role {
+		if !models.IsOperatorRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "role must be admin, helpdesk or auditor"})
+			return
+		}
+		if user.Role == models.RoleAdmin {
+			if admins, err := database.CountPortalUsersWithRole(h.db, models.RoleAdmin); err != nil || admins <= 1 {
+				c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Cannot remove the last admin"})
+				return
+			}
+		}
+		log.Printf("👤 Portal user %s role changed from %s to %s by %s", user.Email, user.Role, *req.Role, actor)
+		setAuditChange(c, gin.H{"role": user.Role}, gin.H{"role": *req.Role})
+		user.Role = *req.Role
+	}
+	if req.Password != nil {
+		if err := models.ValidatePassword(*req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		if err := user.SetPassword(*req.Password); err != nil {
+			log.Printf("❌ Failed to hash password for %s: %v", user.Email, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to update portal user"})
+			return
+		}
+		log.Printf("🔑 Password reset for portal user %s by %s", user.Email, actor)
+		addAuditDetail(c, "password_reset", true)
+	}
+	if req.Unlock {
+		user.FailedLoginAttempts = 0
+		user.LockedUntil = nil
+		log.Printf("🔓 Portal user %s unlocked by %s", user.Email, actor)
+		addAuditDetail(c, "unlocked", true)
+	}
+
+	if req.AllowSSOLink != nil && *req.AllowSSOLink != user.SSOLinkAllowed {
+		if *req.AllowSSOLink && user.ExternalID != "" {
+			c.JSON(http.StatusConflict, gin.H{"success": false, "error": "Account is already linked to single sign-on"})
+			return
+		}
+		log.Printf("🔗 SSO linking for portal user %s set to %t by %s", user.Email, *req.AllowSSOLink, actor)
+		addAuditDetail(c, "allow_sso_link", *req.AllowSSOLink)
+		user.SSOLinkAllowed = *req.AllowSSOLink
+	}
+
+	if err := database.SaveUser(h.db, user); err != nil {
+		log.Printf("❌ Failed to store portal user %s: %v", user.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to update portal user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "user": portalUserView(user)})
+}
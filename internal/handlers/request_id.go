@@ -0,0 +1,29 @@
+// File: internal/handlers/request_id.go - Request IDs for correlating logs and audit events
+package handlers
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID to and from clients and proxies
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID accepts IDs assigned by a proxy or client without letting them inject log content
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID returns middleware that keeps a valid incoming X-Request-ID or assigns a new one,
+// stores it as "request_id" in the context and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
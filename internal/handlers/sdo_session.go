@@ -0,0 +1,216 @@
+// File: internal/handlers/sdo_session.go - The one place where SDO credentials are issued, resolved and revoked
+package handlers
+
+import (
+	"context"
+	cryptoRand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"self-service-portal/internal/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultSDOCredentialTTL is used when no credential lifetime is configured
+const DefaultSDOCredentialTTL = 12 * time.Hour
+
+// sdoCredentialSessionKey holds the credential ID in the portal session
+const sdoCredentialSessionKey = "sdo_credential_id"
+
+// legacySDOSessionKeys were written by earlier versions that kept SDO tokens or token
+// references in the session cookie. They are removed whenever the SDO connection changes.
+var legacySDOSessionKeys = []string{
+	"sdo_token", "sdo_token_id", "sdo_data_id", "sdo_url", "sdo_email",
+	"sdo_authenticated", "sdo_service_account", "auth_time",
+}
+
+// SetSDOCredentialStore replaces the in-memory credential store; a ttl of zero uses DefaultSDOCredentialTTL
+func (h *AuthHandler) SetSDOCredentialStore(store SDOCredentialStore, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultSDOCredentialTTL
+	}
+	h.credentials = store
+	h.credentialTTL = ttl
+}
+
+// newSDOCredentialID returns an unguessable identifier for a stored credential
+func newSDOCredentialID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := cryptoRand.Read(buf); err != nil {
+		return "", err
+	}
+	return "sdo_" + hex.EncodeToString(buf), nil
+}
+
+// issueSDOCredential stores a new credential that expires after the configured TTL. Service
+// account credentials are stored without a token.
+func (h *AuthHandler) issueSDOCredential(baseURL, email, token string, serviceAccount bool) (*SDOCredential, error) {
+	id, err := newSDOCredentialID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	credential := &SDOCredential{
+		ID:             id,
+		BaseURL:        baseURL,
+		Email:          email,
+		ServiceAccount: serviceAccount,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(h.credentialTTL),
+	}
+	if !serviceAccount {
+		credential.Token = token
+	}
+	if err := h.credentials.Put(credential); err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔑 Issued SDO credential %s (service account: %t, expires %s)", id, serviceAccount, credential.ExpiresAt.Format(time.RFC3339))
+	return credential, nil
+}
+
+// saveSDOSession issues a credential and attaches it to the portal session, revoking the one
+// it replaces. Only the credential ID reaches the session cookie.
+func (h *AuthHandler) saveSDOSession(c *gin.Context, baseURL, email, token string, serviceAccount bool) error {
+	credential, err := h.issueSDOCredential(baseURL, email, token, serviceAccount)
+	if err != nil {
+		return &sdoSessionSaveError{err: err}
+	}
+
+	session := sessions.Default(c)
+	h.revokeSessionCredential(session)
+	for _, key := range legacySDOSessionKeys {
+		session.Delete(key)
+	}
+	session.Set(sdoCredentialSessionKey, credential.ID)
+
+	if err := session.Save(); err != nil {
+		log.Printf("SDO Auth: Failed to save session: %v", err)
+		h.revokeSDOCredential(credential.ID)
+		return &sdoSessionSaveError{err: err}
+	}
+	return nil
+}
+
+// sdoCredential returns the SDO connection of the request: for API tokens the credential the
+// token names, or the portal's service account for service account tokens; otherwise the
+// credential attached to the portal session. Service account credentials are returned with
+// the current shared token filled in.
+func (h *AuthHandler) sdoCredential(c *gin.Context) (*SDOCredential, error) {
+	var credential *SDOCredential
+	var credentialID string
+	if value, ok := c.Get("jwt_claims"); ok {
+		claims := value.(*JWTClaims)
+		if claims.SDOTokenRef == "" {
+			credential = &SDOCredential{
+				ID:             "api:" + claims.ID,
+				ServiceAccount: true,
+				CreatedAt:      claims.IssuedAt.Time(),
+				ExpiresAt:      claims.Expiry.Time(),
+			}
+		}
+		credentialID = claims.SDOTokenRef
+	} else {
+		credentialID, _ = sessions.Default(c).Get(sdoCredentialSessionKey).(string)
+	}
+
+	if credential == nil {
+		if credentialID == "" {
+			return nil, ErrSDOCredentialNotFound
+		}
+		var err error
+		if credential, err = h.credentials.Get(credentialID); err != nil {
+			if !errors.Is(err, ErrSDOCredentialNotFound) {
+				log.Printf("❌ Failed to load SDO credential %s: %v", credentialID, err)
+			}
+			return nil, err
+		}
+	}
+
+	if credential.ServiceAccount {
+		ctx := context.Background()
+		if c.Request != nil {
+			ctx = c.Request.Context()
+		}
+		baseURL, token, err := h.serviceTokens.Token(ctx)
+		if err != nil {
+			log.Printf("❌ SDO service account unavailable: %v", err)
+			return nil, err
+		}
+		credential.BaseURL = baseURL
+		credential.Token = token
+	}
+	return credential, nil
+}
+
+// hasSDOCredential reports whether the request already has an SDO connection. Unlike
+// sdoCredential it does not resolve the shared service token, so checking never signs in to SDO.
+func (h *AuthHandler) hasSDOCredential(c *gin.Context) bool {
+	var credentialID string
+	if value, ok := c.Get("jwt_claims"); ok {
+		claims := value.(*JWTClaims)
+		if claims.SDOTokenRef == "" {
+			return true
+		}
+		credentialID = claims.SDOTokenRef
+	} else {
+		credentialID, _ = sessions.Default(c).Get(sdoCredentialSessionKey).(string)
+	}
+	if credentialID == "" {
+		return false
+	}
+	_, err := h.credentials.Get(credentialID)
+	return err == nil
+}
+
+// revokeSDOCredential revokes a credential so that copies of its ID can no longer be used
+func (h *AuthHandler) revokeSDOCredential(credentialID string) {
+	if err := h.credentials.Revoke(credentialID); err != nil {
+		log.Printf("⚠️ Failed to revoke SDO credential %s: %v", credentialID, err)
+		return
+	}
+	log.Printf("🗑️ Revoked SDO credential %s", credentialID)
+}
+
+// revokeSessionCredential revokes the credential attached to the session, if any
+func (h *AuthHandler) revokeSessionCredential(session sessions.Session) {
+	if credentialID, ok := session.Get(sdoCredentialSessionKey).(string); ok && credentialID != "" {
+		h.revokeSDOCredential(credentialID)
+	}
+}
+
+// clearSDOSession revokes the session's credential and removes the SDO connection from the session
+func (h *AuthHandler) clearSDOSession(session sessions.Session) {
+	h.revokeSessionCredential(session)
+	session.Delete(sdoCredentialSessionKey)
+	for _, key := range legacySDOSessionKeys {
+		session.Delete(key)
+	}
+}
+
+// sdoHTTPClient returns the client for SDO API calls made with the credential. Service account
+// credentials get a client that renews the shared token and retries once when SDO answers 401.
+func (h *AuthHandler) sdoHTTPClient(credential *SDOCredential, timeout time.Duration) *http.Client {
+	if credential.ServiceAccount {
+		return h.serviceTokens.Client(timeout)
+	}
+	return services.NewSDOHTTPClient(timeout)
+}
+
+// PurgeSDOCredentials removes credentials that expired or were revoked more than a day ago
+func (h *AuthHandler) PurgeSDOCredentials() {
+	purged, err := h.credentials.Purge(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		log.Printf("❌ Failed to purge SDO credentials: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("🧹 Purged %d stale SDO credentials", purged)
+	}
+}
@@ -0,0 +1,141 @@
+// File: internal/handlers/session_store.go - Portal session storage and cookie settings
+package handlers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"self-service-portal/internal/config"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	gormsessions "github.com/gin-contrib/sessions/gorm"
+	redissessions "github.com/gin-contrib/sessions/redis"
+	redigo "github.com/gomodule/redigo/redis"
+	"golang.org/x/crypto/hkdf"
+	"gorm.io/gorm"
+)
+
+// Session store backends selectable through SESSION_STORE. With the cookie store all session
+// values travel in the encrypted cookie; the server-side stores put only a session ID there.
+const (
+	SessionStoreCookie = "cookie"
+	SessionStoreSQL    = "sql"
+	SessionStoreRedis  = "redis"
+)
+
+// sessionRedisPrefix namespaces session keys in a shared Redis database
+const sessionRedisPrefix = "portal:session:"
+
+// SessionKeyPairs derives an authentication and an encryption key from each session secret.
+// The current secret comes first and protects new cookies; previous secrets are still accepted
+// for reading, so rotating SESSION_SECRET does not sign everyone out.
+func SessionKeyPairs(current string, previous ...string) [][]byte {
+	secrets := append([]string{current}, previous...)
+	pairs := make([][]byte, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, deriveSessionKey(secret, "authentication"), deriveSessionKey(secret, "encryption"))
+	}
+	return pairs
+}
+
+// deriveSessionKey expands the secret into an independent 32 byte key for one purpose
+func deriveSessionKey(secret, purpose string) []byte {
+	key := make([]byte, 32)
+	reader := hkdf.New(sha256.New, []byte(secret), nil, []byte("self-service-portal session "+purpose))
+	if _, err := io.ReadFull(reader, key); err != nil {
+		panic(fmt.Sprintf("session key derivation failed: %v", err))
+	}
+	return key
+}
+
+// NewSessionStore creates the session store selected by cfg.SessionStore. Production refuses to
+// start with a default or example SESSION_SECRET.
+func NewSessionStore(cfg *config.Config, db *gorm.DB) (sessions.Store, error) {
+	if err := cfg.ValidateSessionSecret(); err != nil {
+		return nil, err
+	}
+	options, err := sessionOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPairs := SessionKeyPairs(cfg.SessionSecret, cfg.SessionPreviousSecrets...)
+
+	var store sessions.Store
+	switch strings.ToLower(cfg.SessionStore) {
+	case SessionStoreCookie, "":
+		store = cookie.NewStore(keyPairs...)
+	case SessionStoreSQL:
+		if db == nil {
+			return nil, fmt.Errorf("sql session store requires a database connection")
+		}
+		store = gormsessions.NewStore(db, true, keyPairs...)
+	case SessionStoreRedis:
+		if store, err = newRedisSessionStore(cfg.RedisURL, keyPairs); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown session store: %s", cfg.SessionStore)
+	}
+
+	store.Options(options)
+	log.Printf("✅ Session store: %s (secure: %t, samesite: %s, max age: %s, previous secrets: %d)",
+		strings.ToLower(cfg.SessionStore), options.Secure, strings.ToLower(cfg.SessionSameSite), cfg.SessionMaxAge, len(cfg.SessionPreviousSecrets))
+	return store, nil
+}
+
+// newRedisSessionStore keeps sessions in any server speaking the Redis protocol at redisURL
+func newRedisSessionStore(redisURL string, keyPairs [][]byte) (sessions.Store, error) {
+	pool := &redigo.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redigo.Conn, error) {
+			return redigo.DialURL(redisURL)
+		},
+		TestOnBorrow: func(conn redigo.Conn, _ time.Time) error {
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+
+	store, err := redissessions.NewStoreWithPool(pool, keyPairs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis session store: %w", err)
+	}
+	if err := redissessions.SetKeyPrefix(store, sessionRedisPrefix); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// sessionOptions returns the cookie settings for the environment. Production cookies are only
+// sent over HTTPS.
+func sessionOptions(cfg *config.Config) (sessions.Options, error) {
+	options := sessions.Options{
+		Path:     "/",
+		MaxAge:   int(cfg.SessionMaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   cfg.IsProduction(),
+	}
+
+	switch strings.ToLower(cfg.SessionSameSite) {
+	case "lax", "":
+		options.SameSite = http.SameSiteLaxMode
+	case "strict":
+		options.SameSite = http.SameSiteStrictMode
+	case "none":
+		if !options.Secure {
+			return options, fmt.Errorf("SESSION_SAMESITE=none requires secure cookies (ENVIRONMENT=production)")
+		}
+		options.SameSite = http.SameSiteNoneMode
+	default:
+		return options, fmt.Errorf("unknown SESSION_SAMESITE: %s", cfg.SessionSameSite)
+	}
+	return options, nil
+}
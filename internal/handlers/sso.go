@@ -0,0 +1,727 @@
+// File: internal/handlers/sso.go - OpenID Connect and SAML single sign-on for portal operators
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"self-service-portal/internal/database"
+	"self-service-portal/internal/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// Session keys used while an OIDC login is in progress
+const (
+	oidcStateSessionKey    = "oidc_state"
+	oidcNonceSessionKey    = "oidc_nonce"
+	oidcVerifierSessionKey = "oidc_verifier"
+)
+
+// Login page error codes set by failed single sign-on attempts
+const (
+	ssoErrorFailed   = "sso_failed"
+	ssoErrorNoRole   = "sso_no_role"
+	ssoErrorConflict = "sso_conflict"
+	ssoErrorLink     = "sso_link_required"
+	ssoErrorSession  = "sso_session"
+)
+
+// ssoErrorMessages are shown on the login page for the error codes above
+var ssoErrorMessages = map[string]string{
+	ssoErrorFailed:   "Single sign-on failed. Please try again.",
+	ssoErrorNoRole:   "Your account is not in a group that grants access to the portal.",
+	ssoErrorConflict: "This email address is already linked to a different single sign-on account.",
+	ssoErrorLink:     "A portal account with this email address signs in with a password. Ask an administrator to allow linking it to single sign-on.",
+	ssoErrorSession:  "Signed in, but the portal session could not be started. Please contact an administrator.",
+}
+
+// rolePriority decides which role wins when a user's groups map to several roles
+var rolePriority = map[string]int{
+	models.RoleAuditor:  1,
+	models.RoleHelpdesk: 2,
+	models.RoleAdmin:    3,
+}
+
+// ssoHTTPClient is used for IdP discovery, metadata and token requests
+var ssoHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// SSOProvider describes a single sign-on option shown on the login page
+type SSOProvider struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
+}
+
+// ssoIdentity is the user information asserted by an identity provider
+type ssoIdentity struct {
+	Provider  string
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string
+}
+
+// SSOHandler implements OIDC and SAML logins that end in the same portal session as a password login
+type SSOHandler struct {
+	login         *LoginHandler
+	configHandler *ConfigHandler
+
+	mu           sync.Mutex
+	oidcIssuer   string
+	oidcProvider *oidc.Provider
+	samlKey      string
+	samlSP       *saml.ServiceProvider
+	samlTracker  samlsp.CookieRequestTracker
+}
+
+// NewSSOHandler creates the single sign-on handler
+func NewSSOHandler(login *LoginHandler, configHandler *ConfigHandler) *SSOHandler {
+	return &SSOHandler{
+		login:         login,
+		configHandler: configHandler,
+	}
+}
+
+// Providers lists the enabled single sign-on options
+func (h *SSOHandler) Providers() []SSOProvider {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil {
+		return nil
+	}
+
+	var providers []SSOProvider
+	if config.SSO.OIDC.Enabled {
+		providers = append(providers, SSOProvider{
+			ID:       models.IdentityProviderOIDC,
+			Name:     firstNonEmpty(config.SSO.OIDC.DisplayName, "Single Sign-On"),
+			LoginURL: "/auth/oidc/login",
+		})
+	}
+	if config.SSO.SAML.Enabled {
+		providers = append(providers, SSOProvider{
+			ID:       models.IdentityProviderSAML,
+			Name:     firstNonEmpty(config.SSO.SAML.DisplayName, "SAML Single Sign-On"),
+			LoginURL: "/auth/saml/login",
+		})
+	}
+	return providers
+}
+
+// failLogin sends the browser back to the login page with an error code
+func failLogin(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, "/login?error="+code)
+}
+
+// randomToken returns a URL-safe random string for state and nonce values
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// oidcClient returns the discovered provider and OAuth2 configuration for the configured issuer
+func (h *SSOHandler) oidcClient(cfg OIDCConfig) (*oidc.Provider, *oauth2.Config, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, nil, errors.New("OIDC issuer_url, client_id and redirect_url are required")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.oidcProvider == nil || h.oidcIssuer != cfg.IssuerURL {
+		// The provider keeps its context for key refreshes, so it must not be request scoped
+		ctx := oidc.ClientContext(context.Background(), ssoHTTPClient)
+		provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		h.oidcProvider = provider
+		h.oidcIssuer = cfg.IssuerURL
+		log.Printf("🔑 OIDC provider discovered: %s", cfg.IssuerURL)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email", "groups"}
+	}
+	oauthConfig := &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     h.oidcProvider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+	}
+	return h.oidcProvider, oauthConfig, nil
+}
+
+// OIDCLogin handles GET /auth/oidc/login and redirects to the IdP with PKCE
+func (h *SSOHandler) OIDCLogin(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil || !config.SSO.OIDC.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "OIDC login is not enabled"})
+		return
+	}
+
+	_, oauthConfig, err := h.oidcClient(config.SSO.OIDC)
+	if err != nil {
+		log.Printf("❌ OIDC login unavailable: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	session := sessions.Default(c)
+	session.Set(oidcStateSessionKey, state)
+	session.Set(oidcNonceSessionKey, nonce)
+	session.Set(oidcVerifierSessionKey, verifier)
+	if err := session.Save(); err != nil {
+		log.Printf("❌ Failed to save OIDC login state: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	c.Redirect(http.StatusFound, oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+}
+
+// OIDCCallback handles GET /auth/oidc/callback, verifies the ID token and starts the portal session
+func (h *SSOHandler) OIDCCallback(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil || !config.SSO.OIDC.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "OIDC login is not enabled"})
+		return
+	}
+
+	session := sessions.Default(c)
+	state, _ := session.Get(oidcStateSessionKey).(string)
+	nonce, _ := session.Get(oidcNonceSessionKey).(string)
+	verifier, _ := session.Get(oidcVerifierSessionKey).(string)
+	session.Delete(oidcStateSessionKey)
+	session.Delete(oidcNonceSessionKey)
+	session.Delete(oidcVerifierSessionKey)
+	if err := session.Save(); err != nil {
+		log.Printf("⚠️ Failed to clear OIDC login state: %v", err)
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("🚫 OIDC login rejected by IdP: %s %s", errCode, c.Query("error_description"))
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+		log.Printf("🚫 OIDC callback with invalid state from IP: %s", c.ClientIP())
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	provider, oauthConfig, err := h.oidcClient(config.SSO.OIDC)
+	if err != nil {
+		log.Printf("❌ OIDC callback failed: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	ctx := oidc.ClientContext(c.Request.Context(), ssoHTTPClient)
+	token, err := oauthConfig.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Printf("❌ OIDC code exchange failed: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		log.Printf("❌ OIDC token response has no id_token")
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.SSO.OIDC.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("❌ OIDC ID token verification failed: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		log.Printf("🚫 OIDC ID token nonce mismatch from IP: %s", c.ClientIP())
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		log.Printf("❌ Failed to parse OIDC claims: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		log.Printf("🚫 OIDC login rejected: email not verified for subject %s", idToken.Subject)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	groupsClaim := firstNonEmpty(config.SSO.OIDC.GroupsClaim, "groups")
+	h.completeLogin(c, config, ssoIdentity{
+		Provider:  models.IdentityProviderOIDC,
+		Subject:   idToken.Issuer + "|" + idToken.Subject,
+		Email:     claimString(claims, "email"),
+		FirstName: claimString(claims, "given_name"),
+		LastName:  claimString(claims, "family_name"),
+		Groups:    claimStrings(claims[groupsClaim]),
+	})
+}
+
+// claimString returns a string claim or an empty string
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// claimStrings accepts a claim holding a single string or a list of strings
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// samlServiceProvider builds the SAML service provider, reusing it while the settings are unchanged
+func (h *SSOHandler) samlServiceProvider(ctx context.Context, cfg SAMLConfig) (*saml.ServiceProvider, samlsp.CookieRequestTracker, error) {
+	if cfg.RootURL == "" || cfg.IDPMetadataURL == "" || cfg.CertificateFile == "" || cfg.KeyFile == "" {
+		return nil, samlsp.CookieRequestTracker{}, errors.New("SAML root_url, idp_metadata_url, certificate_file and key_file are required")
+	}
+
+	key := strings.Join([]string{cfg.RootURL, cfg.EntityID, cfg.IDPMetadataURL, cfg.CertificateFile, cfg.KeyFile}, "|")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.samlSP != nil && h.samlKey == key {
+		return h.samlSP, h.samlTracker, nil
+	}
+
+	rootURL, err := url.Parse(cfg.RootURL)
+	if err != nil {
+		return nil, samlsp.CookieRequestTracker{}, fmt.Errorf("invalid SAML root_url: %w", err)
+	}
+	metadataURL, err := url.Parse(cfg.IDPMetadataURL)
+	if err != nil {
+		return nil, samlsp.CookieRequestTracker{}, fmt.Errorf("invalid SAML idp_metadata_url: %w", err)
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(cfg.CertificateFile, cfg.KeyFile)
+	if err != nil {
+		return nil, samlsp.CookieRequestTracker{}, fmt.Errorf("failed to load SAML key pair: %w", err)
+	}
+	rsaKey, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, samlsp.CookieRequestTracker{}, errors.New("SAML key must be an RSA private key")
+	}
+	if keyPair.Leaf == nil {
+		return nil, samlsp.CookieRequestTracker{}, errors.New("SAML certificate could not be parsed")
+	}
+
+	idpMetadata, err := samlsp.FetchMetadata(ctx, ssoHTTPClient, *metadataURL)
+	if err != nil {
+		return nil, samlsp.CookieRequestTracker{}, fmt.Errorf("failed to fetch IdP metadata: %w", err)
+	}
+
+	// The ACS is a cross-site POST from the IdP, so the request tracking cookie needs SameSite=None over HTTPS
+	sameSite := http.SameSiteLaxMode
+	if rootURL.Scheme == "https" {
+		sameSite = http.SameSiteNoneMode
+	}
+
+	opts := samlsp.Options{
+		EntityID:       cfg.EntityID,
+		URL:            *rootURL,
+		Key:            rsaKey,
+		Certificate:    keyPair.Leaf,
+		HTTPClient:     ssoHTTPClient,
+		IDPMetadata:    idpMetadata,
+		CookieSameSite: sameSite,
+	}
+	sp := samlsp.DefaultServiceProvider(opts)
+	if sp.EntityID == "" {
+		sp.EntityID = sp.MetadataURL.String()
+	}
+
+	h.samlSP = &sp
+	h.samlTracker = samlsp.DefaultRequestTracker(opts, h.samlSP)
+	h.samlKey = key
+	log.Printf("🔑 SAML service provider ready: entity %s, IdP %s", sp.EntityID, idpMetadata.EntityID)
+	return h.samlSP, h.samlTracker, nil
+}
+
+// SAMLMetadata handles GET /saml/metadata and returns the service provider metadata for the IdP
+func (h *SSOHandler) SAMLMetadata(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil || !config.SSO.SAML.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "SAML login is not enabled"})
+		return
+	}
+
+	sp, _, err := h.samlServiceProvider(c.Request.Context(), config.SSO.SAML)
+	if err != nil {
+		log.Printf("❌ SAML metadata unavailable: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "SAML is not configured correctly"})
+		return
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to build metadata"})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// SAMLLogin handles GET /auth/saml/login and redirects to the IdP with an AuthnRequest
+func (h *SSOHandler) SAMLLogin(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil || !config.SSO.SAML.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "SAML login is not enabled"})
+		return
+	}
+
+	sp, tracker, err := h.samlServiceProvider(c.Request.Context(), config.SSO.SAML)
+	if err != nil {
+		log.Printf("❌ SAML login unavailable: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	bindingLocation := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if bindingLocation == "" {
+		log.Printf("❌ SAML IdP does not offer the HTTP-Redirect binding")
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	authnRequest, err := sp.MakeAuthenticationRequest(bindingLocation, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		log.Printf("❌ Failed to create SAML AuthnRequest: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	relayState, err := tracker.TrackRequest(c.Writer, c.Request, authnRequest.ID)
+	if err != nil {
+		log.Printf("❌ Failed to track SAML request: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+	redirectURL, err := authnRequest.Redirect(relayState, sp)
+	if err != nil {
+		log.Printf("❌ Failed to build SAML redirect: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirectURL.String())
+}
+
+// SAMLACS handles POST /saml/acs, validates the assertion and starts the portal session
+func (h *SSOHandler) SAMLACS(c *gin.Context) {
+	config, err := h.configHandler.LoadConfig()
+	if err != nil || !config.SSO.SAML.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "SAML login is not enabled"})
+		return
+	}
+
+	sp, tracker, err := h.samlServiceProvider(c.Request.Context(), config.SSO.SAML)
+	if err != nil {
+		log.Printf("❌ SAML ACS unavailable: %v", err)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	if err := c.Request.ParseForm(); err != nil {
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	var possibleRequestIDs []string
+	relayState := c.Request.Form.Get("RelayState")
+	if tracked, err := tracker.GetTrackedRequest(c.Request, relayState); err == nil {
+		possibleRequestIDs = append(possibleRequestIDs, tracked.SAMLRequestID)
+		if err := tracker.StopTrackingRequest(c.Writer, c.Request, relayState); err != nil {
+			log.Printf("⚠️ Failed to clear SAML request tracking: %v", err)
+		}
+	}
+
+	assertion, err := sp.ParseResponse(c.Request, possibleRequestIDs)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		log.Printf("❌ SAML response rejected: %v (IP: %s)", err, c.ClientIP())
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	identity := ssoIdentity{Provider: models.IdentityProviderSAML}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		identity.Subject = assertion.Subject.NameID.Value
+	}
+
+	emailAttributes := []string{"email", "mail", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"}
+	if config.SSO.SAML.EmailAttribute != "" {
+		emailAttributes = []string{config.SSO.SAML.EmailAttribute}
+	}
+	groupAttributes := []string{"groups", "memberOf", "http://schemas.microsoft.com/ws/2008/06/identity/claims/groups"}
+	if config.SSO.SAML.GroupsAttribute != "" {
+		groupAttributes = []string{config.SSO.SAML.GroupsAttribute}
+	}
+
+	identity.Email = firstNonEmpty(samlAttributeValues(assertion, emailAttributes...)...)
+	if identity.Email == "" && strings.Contains(identity.Subject, "@") {
+		identity.Email = identity.Subject
+	}
+	identity.FirstName = firstNonEmpty(samlAttributeValues(assertion, "givenName", "firstName",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname")...)
+	identity.LastName = firstNonEmpty(samlAttributeValues(assertion, "sn", "surname", "lastName",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname")...)
+	identity.Groups = samlAttributeValues(assertion, groupAttributes...)
+	identity.Subject = sp.IDPMetadata.EntityID + "|" + identity.Subject
+
+	h.completeLogin(c, config, identity)
+}
+
+// samlAttributeValues returns the values of the first attributes matching any of the names
+func samlAttributeValues(assertion *saml.Assertion, names ...string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			for _, name := range names {
+				if attribute.Name == name || attribute.FriendlyName == name {
+					for _, value := range attribute.Values {
+						values = append(values, strings.TrimSpace(value.Value))
+					}
+				}
+			}
+		}
+	}
+	return values
+}
+
+// roleForGroups maps IdP groups to the highest-privileged portal role, or the default role
+func roleForGroups(config SSOConfig, groups []string) string {
+	role := ""
+	for _, group := range groups {
+		for mappedGroup, mappedRole := range config.GroupRoles {
+			if strings.EqualFold(group, mappedGroup) && rolePriority[mappedRole] > rolePriority[role] {
+				role = mappedRole
+			}
+		}
+	}
+	if role == "" && models.IsOperatorRole(config.DefaultRole) {
+		role = config.DefaultRole
+	}
+	return role
+}
+
+// completeLogin provisions or updates the operator for an IdP identity and starts the portal session
+func (h *SSOHandler) completeLogin(c *gin.Context, config *PortalConfig, identity ssoIdentity) {
+	if identity.Subject == "" || identity.Email == "" {
+		log.Printf("🚫 %s login rejected: subject or email missing", identity.Provider)
+		failLogin(c, ssoErrorFailed)
+		return
+	}
+
+	role := roleForGroups(config.SSO, identity.Groups)
+	if role == "" {
+		log.Printf("🚫 %s login denied for %s: no portal role for groups %v (IP: %s)",
+			identity.Provider, identity.Email, identity.Groups, c.ClientIP())
+		failLogin(c, ssoErrorNoRole)
+		return
+	}
+
+	db := h.login.db
+	if db == nil {
+		failLogin(c, ssoErrorSession)
+		return
+	}
+
+	// An existing password account is only linked by email once an admin allowed it; the IdP
+	// asserting the same address is not enough to take the account over
+	user, err := database.GetUserByExternalID(db, identity.Provider, identity.Subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user, err = database.GetUserByEmail(db, identity.Email)
+		switch {
+		case err == nil && user.ExternalID != "":
+			log.Printf("🚫 %s login for %s rejected: email already linked to %s identity %s",
+				identity.Provider, identity.Email, user.IdentityProvider, user.ExternalID)
+			failLogin(c, ssoErrorConflict)
+			return
+		case err == nil && user.PasswordHash != "" && !user.SSOLinkAllowed:
+			log.Printf("🚫 %s login for %s rejected: password account not released for linking (IP: %s)",
+				identity.Provider, identity.Email, c.ClientIP())
+			failLogin(c, ssoErrorLink)
+			return
+		case err == nil && user.SSOLinkAllowed:
+			log.Printf("🔗 Linking password account %s to %s identity %s", user.Email, identity.Provider, identity.Subject)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user, err = database.CreateUser(db, identity.Email,
+				firstNonEmpty(identity.FirstName, identity.Email), identity.LastName)
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Failed to provision %s user %s: %v", identity.Provider, identity.Email, err)
+		failLogin(c, ssoErrorSession)
+		return
+	}
+
+	// Like the account administration, IdP groups cannot demote the last admin
+	if user.Role == models.RoleAdmin && role != models.RoleAdmin {
+		if admins, err := database.CountPortalUsersWithRole(db, models.RoleAdmin); err != nil || admins <= 1 {
+			log.Printf("⚠️ %s groups %v map %s to %s, keeping the admin role: it is the last admin",
+				identity.Provider, identity.Groups, identity.Email, role)
+			role = models.RoleAdmin
+		}
+	}
+
+	if user.Role != role {
+		log.Printf("👤 %s role for %s set from %s to %s by IdP groups %v", identity.Provider, identity.Email, user.Role, role, identity.Groups)
+	}
+	user.Role = role
+	user.IdentityProvider = identity.Provider
+	user.ExternalID = identity.Subject
+	user.SSOLinkAllowed = false
+	if identity.FirstName != "" {
+		user.FirstName = identity.FirstName
+	}
+	if identity.LastName != "" {
+		user.LastName = identity.LastName
+	}
+	if err := database.SaveUser(db, user); err != nil {
+		log.Printf("❌ Failed to store %s user %s: %v", identity.Provider, identity.Email, err)
+		failLogin(c, ssoErrorSession)
+		return
+	}
+
+	if err := h.login.startPortalSession(c, user); err != nil {
+		log.Printf("❌ %s login for %s could not start a portal session: %v", identity.Provider, user.Email, err)
+		failLogin(c, ssoErrorSession)
+		return
+	}
+
+	log.Printf("✅ %s login successful for user: %s (%s)", identity.Provider, user.Email, user.Role)
+	c.Redirect(http.StatusFound, "/dashboard")
+}
+
+// applySSOSettings updates the SSO configuration from a save-config request
+func applySSOSettings(sso *SSOConfig, settings map[string]interface{}) error {
+	if v, ok := settings["oidc_enabled"].(bool); ok {
+		sso.OIDC.Enabled = v
+	}
+	if v, ok := settings["oidc_display_name"].(string); ok {
+		sso.OIDC.DisplayName = v
+	}
+	if v, ok := settings["oidc_issuer_url"].(string); ok {
+		sso.OIDC.IssuerURL = strings.TrimSpace(v)
+	}
+	if v, ok := settings["oidc_client_id"].(string); ok {
+		sso.OIDC.ClientID = strings.TrimSpace(v)
+	}
+	if v, ok := settings["oidc_client_secret"].(string); ok {
+		sso.OIDC.ClientSecret = v
+	}
+	if v, ok := settings["oidc_redirect_url"].(string); ok {
+		sso.OIDC.RedirectURL = strings.TrimSpace(v)
+	}
+	if v, ok := settings["oidc_scopes"].([]interface{}); ok {
+		sso.OIDC.Scopes = claimStrings(v)
+	}
+	if v, ok := settings["oidc_groups_claim"].(string); ok {
+		sso.OIDC.GroupsClaim = v
+	}
+
+	if v, ok := settings["saml_enabled"].(bool); ok {
+		sso.SAML.Enabled = v
+	}
+	if v, ok := settings["saml_display_name"].(string); ok {
+		sso.SAML.DisplayName = v
+	}
+	if v, ok := settings["saml_root_url"].(string); ok {
+		sso.SAML.RootURL = strings.TrimSpace(v)
+	}
+	if v, ok := settings["saml_entity_id"].(string); ok {
+		sso.SAML.EntityID = strings.TrimSpace(v)
+	}
+	if v, ok := settings["saml_idp_metadata_url"].(string); ok {
+		sso.SAML.IDPMetadataURL = strings.TrimSpace(v)
+	}
+	if v, ok := settings["saml_certificate_file"].(string); ok {
+		sso.SAML.CertificateFile = v
+	}
+	if v, ok := settings["saml_key_file"].(string); ok {
+		sso.SAML.KeyFile = v
+	}
+	if v, ok := settings["saml_email_attribute"].(string); ok {
+		sso.SAML.EmailAttribute = v
+	}
+	if v, ok := settings["saml_groups_attribute"].(string); ok {
+		sso.SAML.GroupsAttribute = v
+	}
+
+	if v, ok := settings["group_roles"].(map[string]interface{}); ok {
+		groupRoles := make(map[string]string, len(v))
+		for group, value := range v {
+			role, _ := value.(string)
+			if !models.IsOperatorRole(role) {
+				return fmt.Errorf("group %q must map to admin, helpdesk or auditor", group)
+			}
+			groupRoles[group] = role
+		}
+		sso.GroupRoles = groupRoles
+	}
+	if v, ok := settings["default_role"].(string); ok {
+		if v != "" && !models.IsOperatorRole(v) {
+			return errors.New("default_role must be empty, admin, helpdesk or auditor")
+		}
+		sso.DefaultRole = v
+	}
+	return nil
+}
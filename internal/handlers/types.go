@@ -1,7 +1,11 @@
 // File: internal/handlers/types.go - Complete type definitions for the portal
 package handlers
 
-import "time"
+import (
+	"time"
+
+	"self-service-portal/internal/services/au10tix"
+)
 
 // VerificationStartRequest represents the request to start verification
 type VerificationStartRequest struct {
@@ -10,13 +14,7 @@ type VerificationStartRequest struct {
 	Email       string `json:"email" binding:"required"`
 	PhoneNumber string `json:"phoneNumber,omitempty"`
 	DateOfBirth string `json:"dateOfBirth,omitempty"`
-}
-
-// Au10tixSessionResponse represents a successful Au10tix session creation response
-type Au10tixSessionResponse struct {
-	SessionID  string `json:"session_id"`
-	SessionURL string `json:"session_url"`
-	Status     string `json:"status"`
+	Profile     string `json:"profile,omitempty"` // Workflow profile; the portal records the profile it used
 }
 
 // VerificationStatusResponse represents the response for verification status
@@ -47,10 +45,13 @@ type Au10tixJWTPayload struct {
 
 // PortalConfig represents the complete portal configuration
 type PortalConfig struct {
-	General GeneralConfig `json:"general"`
-	Auth    AuthConfig    `json:"auth"`
-	API     APIConfig     `json:"api"`
-	Updated time.Time     `json:"updated"`
+	General          GeneralConfig          `json:"general"`
+	Auth             AuthConfig             `json:"auth"`
+	API              APIConfig              `json:"api"`
+	IdentityMatching IdentityMatchingConfig `json:"identity_matching"`
+	SSO              SSOConfig              `json:"sso"`
+	Workflows        WorkflowConfig         `json:"workflows"`
+	Updated          time.Time              `json:"updated"`
 }
 
 // GeneralConfig represents general display and notification settings
@@ -63,18 +64,110 @@ type GeneralConfig struct {
 
 // AuthConfig represents authentication configuration
 type AuthConfig struct {
-	Au10tixToken string `json:"au10tix_token"`
-	SDOUrl       string `json:"sdo_url"`
-	SDOEmail     string `json:"sdo_email"`
-	SDOPassword  string `json:"sdo_password"`
+	Au10tixToken         string `json:"au10tix_token"`
+	Au10tixWebhookSecret string `json:"au10tix_webhook_secret,omitempty"`
+	Au10tixAuthMethod    string `json:"au10tix_auth_method,omitempty"`   // token or client_credentials; unset means token
+	Au10tixClientID      string `json:"au10tix_client_id,omitempty"`     // OAuth client for client_credentials
+	Au10tixClientSecret  string `json:"au10tix_client_secret,omitempty"` // Client secret, unless a private key is set
+	Au10tixPrivateKey    string `json:"au10tix_private_key,omitempty"`   // PEM key or JWK signing a private_key_jwt assertion
+	Au10tixIssuer        string `json:"au10tix_issuer,omitempty"`        // Authorization server; defaults to the iss of the pasted token
+	Au10tixScopes        string `json:"au10tix_scopes,omitempty"`        // Space separated; defaults to workflow:api
+	OnfidoAPIToken       string `json:"onfido_api_token,omitempty"`      // API token of the Onfido provider
+	OnfidoWebhookToken   string `json:"onfido_webhook_token,omitempty"`  // Token Onfido signs webhooks with
+	SDOUrl               string `json:"sdo_url"`
+	SDOEmail             string `json:"sdo_email"`
+	SDOPassword          string `json:"sdo_password"`
 }
 
 // APIConfig represents API configuration
 type APIConfig struct {
-	Au10tixBaseURL string `json:"au10tix_base_url"`
-	SDOApiURL      string `json:"sdo_api_url"`
-	APITimeout     int    `json:"api_timeout"`
-	APIRetries     int    `json:"api_retries"`
+	VerificationProvider  string   `json:"verification_provider,omitempty"` // au10tix, onfido or mock; unset means au10tix
+	Au10tixMode           string   `json:"au10tix_mode"`                    // production, sandbox or demo; unset means production
+	Au10tixBaseURL        string   `json:"au10tix_base_url"`                // Production API URL when the token does not name one
+	Au10tixSandboxURL     string   `json:"au10tix_sandbox_url"`             // Au10tix staging API used in sandbox mode
+	Au10tixAllowedHosts   []string `json:"au10tix_allowed_hosts,omitempty"` // Hosts tokens may be sent to; *.domain matches subdomains
+	Au10tixIssuerHosts    []string `json:"au10tix_issuer_hosts,omitempty"`  // Hosts of trusted token issuers
+	Au10tixJWKSFile       string   `json:"au10tix_jwks_file,omitempty"`     // Local key set used instead of the issuer's
+	Au10tixCABundle       string   `json:"au10tix_ca_bundle,omitempty"`     // PEM file trusted in addition to the system roots
+	OnfidoBaseURL         string   `json:"onfido_base_url,omitempty"`       // Onfido API of the account's region; defaults to the EU region
+	OnfidoWorkflowID      string   `json:"onfido_workflow_id,omitempty"`    // Onfido Studio workflow started for every verification
+	SDOApiURL             string   `json:"sdo_api_url"`
+	APITimeout            int      `json:"api_timeout"`
+	APIRetries            int      `json:"api_retries"`
+	ResultPollingInterval int      `json:"result_polling_interval"` // Seconds between fallback result polls, 0 disables polling
+}
+
+// WorkflowConfig holds the named Au10tix workflow profiles
+type WorkflowConfig struct {
+	DefaultProfile string                     `json:"default_profile,omitempty"` // Used when no profile is requested or matched; unset means standard
+	Profiles       map[string]WorkflowProfile `json:"profiles,omitempty"`        // Replaces the built-in standard profile when set
+}
+
+// WorkflowProfile configures the Au10tix workflow started for one population of users
+type WorkflowProfile struct {
+	Description  string              `json:"description,omitempty"`
+	Workflow     string              `json:"workflow"`               // Au10tix workflow name, e.g. Au10tix201
+	RequestTypes map[string][]string `json:"request_types"`          // Check -> capture sources, e.g. "faceCompare": ["camera"]
+	ShortURL     *bool               `json:"short_url,omitempty"`    // Shortened capture link; unset means true
+	CallbackURL  string              `json:"callback_url,omitempty"` // Webhook Au10tix notifies when the session completes
+	SuccessURL   string              `json:"success_url,omitempty"`  // Page the user returns to after capture
+	FailureURL   string              `json:"failure_url,omitempty"`  // Page the user returns to when capture fails
+	Selectable   bool                `json:"selectable,omitempty"`   // May be named in a verification request
+	Directories  []string            `json:"directories,omitempty"`  // SDO directories whose users get this profile
+	Groups       []string            `json:"groups,omitempty"`       // SDO groups whose members get this profile
+}
+
+// SSOConfig configures single sign-on for portal operators
+type SSOConfig struct {
+	OIDC        OIDCConfig        `json:"oidc"`
+	SAML        SAMLConfig        `json:"saml"`
+	GroupRoles  map[string]string `json:"group_roles"`            // IdP group -> portal role
+	DefaultRole string            `json:"default_role,omitempty"` // Role for users without a mapped group; empty denies login
+}
+
+// OIDCConfig configures OpenID Connect login (authorization code flow with PKCE)
+type OIDCConfig struct {
+	Enabled      bool     `json:"enabled"`
+	DisplayName  string   `json:"display_name,omitempty"`
+	IssuerURL    string   `json:"issuer_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	RedirectURL  string   `json:"redirect_url"` // e.g. https://portal.example.com/auth/oidc/callback
+	Scopes       []string `json:"scopes,omitempty"`
+	GroupsClaim  string   `json:"groups_claim,omitempty"`
+}
+
+// SAMLConfig configures the SAML 2.0 service provider
+type SAMLConfig struct {
+	Enabled         bool   `json:"enabled"`
+	DisplayName     string `json:"display_name,omitempty"`
+	RootURL         string `json:"root_url"` // Public portal URL; metadata and ACS live under /saml/
+	EntityID        string `json:"entity_id,omitempty"`
+	IDPMetadataURL  string `json:"idp_metadata_url"`
+	CertificateFile string `json:"certificate_file"`
+	KeyFile         string `json:"key_file"`
+	EmailAttribute  string `json:"email_attribute,omitempty"`
+	GroupsAttribute string `json:"groups_attribute,omitempty"`
+}
+
+// IdentityMatchingConfig controls the identity cross-check performed before SDO invitations
+type IdentityMatchingConfig struct {
+	Enabled              bool    `json:"enabled"`
+	Threshold            float64 `json:"threshold"`              // Minimum match score (0..1) for an automatic invitation
+	BelowThresholdAction string  `json:"below_threshold_action"` // "block" or "review"
+	RequireDateOfBirth   bool    `json:"require_date_of_birth"`
+	RequireVerification  bool    `json:"require_verification"` // Reject invitations that do not reference a verification
+}
+
+// Au10tixWebhookPayload represents a result callback sent by Au10tix
+type Au10tixWebhookPayload struct {
+	SessionID  string                 `json:"sessionId"`
+	WorkflowID string                 `json:"workflowId,omitempty"`
+	ID         string                 `json:"id,omitempty"`
+	Status     string                 `json:"status,omitempty"`
+	Result     interface{}            `json:"result,omitempty"`
+	Score      float64                `json:"score,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
 }
 
 // Au10tixTestRequest represents a request to test Au10tix connection
@@ -83,22 +176,15 @@ type Au10tixTestRequest struct {
 	BaseURL string `json:"base_url"`
 }
 
-// Au10tixWorkflowRequest represents the request structure for Au10tix workflow creation
-type Au10tixWorkflowRequest struct {
-	WorkflowOptions map[string]interface{} `json:"workflowOptions"`
-	ServiceOptions  ServiceOptions         `json:"serviceOptions"`
-}
+// Au10tixWorkflowRequest represents the request structure for Au10tix workflow creation,
+// built from a workflow profile
+type Au10tixWorkflowRequest = au10tix.WorkflowRequest
 
 // ServiceOptions represents the service options for Au10tix workflow
-type ServiceOptions struct {
-	Secureme SecuremeOptions `json:"secureme"`
-}
+type ServiceOptions = au10tix.ServiceOptions
 
 // SecuremeOptions represents the secureme options
-type SecuremeOptions struct {
-	ShortURL     bool                `json:"shortUrl"`
-	RequestTypes map[string][]string `json:"requestTypes"`
-}
+type SecuremeOptions = au10tix.SecuremeOptions
 
 // Au10tixWorkflowResponse represents the response from Au10tix workflow creation
 type Au10tixWorkflowResponse struct {
@@ -115,6 +201,7 @@ type Au10tixWorkflowResponse struct {
 type Au10tixResultResponse struct {
 	ID                  string                    `json:"id"`
 	Status              string                    `json:"status"`
+	Decision            string                    `json:"decision,omitempty"`
 	Result              Au10tixVerificationResult `json:"result,omitempty"`
 	Score               float64                   `json:"score,omitempty"`
 	IsDocumentAuthentic bool                      `json:"isDocumentAuthentic,omitempty"`
@@ -124,11 +211,48 @@ type Au10tixResultResponse struct {
 
 // Au10tixVerificationResult represents the detailed verification result
 type Au10tixVerificationResult struct {
-	IsDocumentAuthentic bool                   `json:"isDocumentAuthentic"`
-	IsFaceMatch         bool                   `json:"isFaceMatch"`
-	DocumentType        string                 `json:"documentType,omitempty"`
-	Confidence          string                 `json:"confidence,omitempty"`
-	Details             map[string]interface{} `json:"details,omitempty"`
+	DocumentAuthenticity string                 `json:"documentAuthenticity,omitempty"` // passed, failed, inconclusive or empty when not performed
+	FaceMatch            string                 `json:"faceMatch,omitempty"`
+	Liveness             string                 `json:"liveness,omitempty"`
+	IsDocumentAuthentic  bool                   `json:"isDocumentAuthentic"`
+	IsFaceMatch          bool                   `json:"isFaceMatch"`
+	IsLive               bool                   `json:"isLive"`
+	DocumentType         string                 `json:"documentType,omitempty"`
+	DocumentNumber       string                 `json:"documentNumber,omitempty"`
+	IssuingCountry       string                 `json:"issuingCountry,omitempty"`
+	FirstName            string                 `json:"firstName,omitempty"`
+	LastName             string                 `json:"lastName,omitempty"`
+	DateOfBirth          string                 `json:"dateOfBirth,omitempty"`
+	ExpiryDate           string                 `json:"expiryDate,omitempty"`
+	Confidence           string                 `json:"confidence,omitempty"`
+	ReasonCodes          map[string][]string    `json:"reasonCodes,omitempty"` // Keyed by check name, "overall" for session-level codes
+	Details              map[string]interface{} `json:"details,omitempty"`
+}
+
+// VerificationCheck represents the normalized result of a single verification check
+type VerificationCheck struct {
+	Status      string   `json:"status"` // passed, failed, inconclusive, not_performed
+	ReasonCodes []string `json:"reason_codes,omitempty"`
+}
+
+// VerificationOutcome represents the provider-independent result of an identity verification
+type VerificationOutcome struct {
+	Decision             string            `json:"decision"` // verified, failed, review
+	Score                float64           `json:"score,omitempty"`
+	DocumentType         string            `json:"document_type,omitempty"`
+	DocumentNumber       string            `json:"document_number,omitempty"`
+	IssuingCountry       string            `json:"issuing_country,omitempty"`
+	DocumentAuthenticity VerificationCheck `json:"document_authenticity"`
+	FaceMatch            VerificationCheck `json:"face_match"`
+	Liveness             VerificationCheck `json:"liveness"`
+	FirstName            string            `json:"first_name,omitempty"`
+	LastName             string            `json:"last_name,omitempty"`
+	DateOfBirth          string            `json:"date_of_birth,omitempty"`
+	ExpiryDate           string            `json:"expiry_date,omitempty"`
+	ReasonCodes          []string          `json:"reason_codes,omitempty"`
+	Provider             string            `json:"provider"`
+	EvaluatedAt          time.Time         `json:"evaluated_at"`
+	Review               *IdentityReview   `json:"review,omitempty"` // Manual decision on a review outcome
 }
 
 // SDOAuthRequest represents the SDO authentication request
@@ -3,8 +3,9 @@ package handlers
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,32 +13,104 @@ import (
 	"strings"
 	"time"
 
+	"self-service-portal/internal/services/au10tix"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type VerificationHandler struct {
 	configHandler *ConfigHandler
-	sessions      map[string]*VerificationSession // In-memory session storage
+	store         VerificationStore
+	flows         *EnrollmentFlowManager
+	audit         *AuditLog
+	demo          *au10tix.DemoClient // Used in Au10tix demo mode
+	mock          *au10tix.DemoClient // Used by the mock provider
 }
 
 type VerificationSession struct {
-	ID             string                   `json:"id"`
-	UserData       VerificationStartRequest `json:"user_data"`
-	Status         string                   `json:"status"`           // pending, in_progress, completed, failed
-	Result         string                   `json:"result,omitempty"` // verified, failed
-	Au10tixSession *Au10tixSessionResponse  `json:"au10tix_session,omitempty"`
-	CreatedAt      time.Time                `json:"created_at"`
-	UpdatedAt      time.Time                `json:"updated_at"`
-	Score          float64                  `json:"score,omitempty"`
-	Data           map[string]interface{}   `json:"data,omitempty"`
+	ID              string                   `json:"id"`
+	UserData        VerificationStartRequest `json:"user_data"`
+	Status          string                   `json:"status"`           // pending, in_progress, completed, failed, expired
+	Result          string                   `json:"result,omitempty"` // verified, failed, review
+	ProviderSession *ProviderSession         `json:"provider_session,omitempty"`
+	CreatedAt       time.Time                `json:"created_at"`
+	UpdatedAt       time.Time                `json:"updated_at"`
+	Score           float64                  `json:"score,omitempty"`
+	Data            map[string]interface{}   `json:"data,omitempty"`
+	Outcome         *VerificationOutcome     `json:"outcome,omitempty"`
+	IdentityMatch   *IdentityMatchResult     `json:"identity_match,omitempty"`
+}
+
+// Finished reports whether the verification reached a final status; its result no longer
+// changes at the provider
+func (s *VerificationSession) Finished() bool {
+	return s.Status == "completed" || s.Status == "failed" || s.Status == "expired"
 }
 
-func NewVerificationHandler(configHandler *ConfigHandler) *VerificationHandler {
+func NewVerificationHandler(configHandler *ConfigHandler, store VerificationStore) *VerificationHandler {
 	return &VerificationHandler{
 		configHandler: configHandler,
-		sessions:      make(map[string]*VerificationSession),
+		store:         store,
+		demo:          au10tix.NewDemoClient(demoCapturePath, demoProcessingTime),
+		mock:          au10tix.NewDemoClient(mockCapturePath, demoProcessingTime),
+	}
+}
+
+// SetEnrollmentFlows makes verification start and status checks drive the enrollment flow
+func (h *VerificationHandler) SetEnrollmentFlows(flows *EnrollmentFlowManager) {
+	h.flows = flows
+}
+
+// SetAuditLog records verification results in the audit log as they are stored
+func (h *VerificationHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// currentFlowForVerification returns the enrollment flow a new verification belongs to, nil for
+// operators, who verify users without one. It writes the error response and returns false when
+// verification may not be started.
+func (h *VerificationHandler) currentFlowForVerification(c *gin.Context, email string) (*EnrollmentFlow, bool) {
+	if !h.flows.enforcesFlow(c) {
+		return nil, true
+	}
+
+	flow, err := h.flows.Current(c)
+	if err == nil {
+		err = flow.Require(FlowIdentified, FlowVerificationStarted)
 	}
+	if err != nil {
+		respondFlowError(c, err)
+		return nil, false
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(email), flow.Email) {
+		log.Printf("🚫 Verification start rejected: %s does not match enrollment flow %s", email, flow.ID)
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "Verification must be started for the identified user",
+		})
+		return nil, false
+	}
+	return flow, true
+}
+
+// bindVerificationToFlow records the verification on the flow and advances it
+func (h *VerificationHandler) bindVerificationToFlow(c *gin.Context, flow *EnrollmentFlow, sessionID string) bool {
+	if flow == nil {
+		return true
+	}
+
+	flow.VerificationID = sessionID
+	if err := h.flows.Advance(flow, FlowVerificationStarted, "verification "+sessionID+" started"); err != nil {
+		log.Printf("❌ Failed to advance enrollment flow %s: %v", flow.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to update enrollment flow",
+		})
+		return false
+	}
+	return true
 }
 
 // Update the StartVerification method in verification.go
@@ -53,22 +126,54 @@ func (h *VerificationHandler) StartVerification(c *gin.Context) {
 	}
 
 	log.Printf("🚀 Starting verification for: %s %s (%s)", request.FirstName, request.LastName, request.Email)
+	setAuditTarget(c, request.Email)
+
+	flow, ok := h.currentFlowForVerification(c, request.Email)
+	if !ok {
+		return
+	}
 
-	// Get Au10tix token with fallback
-	au10tixToken, tokenSource, err := h.configHandler.GetAu10tixTokenWithFallback()
+	config, err := h.configHandler.LoadConfig()
 	if err != nil {
-		log.Printf("❌ Failed to get Au10tix token: %v", err)
+		log.Printf("❌ Failed to load config: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   "Au10tix token error",
+			"error":   "Configuration error",
 		})
 		return
 	}
 
-	log.Printf("🔑 Using Au10tix token from: %s", tokenSource)
+	profileName, profile, err := selectWorkflowProfile(config, request.Profile, flow)
+	if err != nil {
+		log.Printf("❌ No workflow profile for %s: %v", request.Email, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrWorkflowProfileMissing) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	request.Profile = profileName
+
+	provider := verificationProvider(config)
+	verifier, err := h.identityVerifier(config, provider)
+	if err != nil {
+		respondVerifierUnavailable(c, err)
+		return
+	}
+	caps := verifier.Capabilities()
+	log.Printf("🔑 Verification provider: %s, workflow profile: %s (%s)", provider, profileName, profile.Workflow)
 
-	// Create a demo session for testing if using fallback
 	sessionID := uuid.New().String()
+	addAuditDetail(c, "verification_id", sessionID)
+	addAuditDetail(c, "provider", provider)
+	if caps.Mode != "" {
+		addAuditDetail(c, "provider_mode", caps.Mode)
+	}
+	addAuditDetail(c, "workflow_profile", profileName)
 	session := &VerificationSession{
 		ID:        sessionID,
 		UserData:  request,
@@ -77,74 +182,45 @@ func (h *VerificationHandler) StartVerification(c *gin.Context) {
 		UpdatedAt: time.Now(),
 	}
 
-	if tokenSource == "static_fallback" {
-		log.Printf("⚠️ Using static fallback token - demo mode")
-		h.sessions[sessionID] = session
-		c.JSON(http.StatusOK, gin.H{
-			"success":        true,
-			"verificationId": sessionID,
-			"sessionUrl":     "", // Empty for demo mode
-			"message":        "Demo mode - using static fallback token",
-		})
+	// Create the provider session
+	providerSession, err := verifier.CreateSession(c.Request.Context(), VerificationRequest{UserData: request, Profile: profile})
+	if isVerifierUnavailable(err) {
+		respondVerifierUnavailable(c, err)
 		return
 	}
-
-	// Load full configuration for other settings
-	config, err := h.configHandler.LoadConfig()
 	if err != nil {
-		log.Printf("❌ Failed to load config: %v", err)
+		log.Printf("❌ Failed to create %s session: %v", provider, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   "Configuration error",
-		})
-		return
-	}
-
-	// Use the token we got from fallback method
-	config.Auth.Au10tixToken = au10tixToken
-
-	// Decode JWT token to get organization info
-	jwtPayload, err := h.configHandler.DecodeAu10tixToken(au10tixToken)
-	if err != nil {
-		log.Printf("❌ Failed to decode Au10tix token: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid Au10tix token configuration",
+			"error":   fmt.Sprintf("Failed to create verification session: %v", err),
 		})
 		return
 	}
 
-	// Check token expiration
-	if time.Now().Unix() > jwtPayload.EXP {
-		log.Printf("⏰ Au10tix token has expired")
-		c.JSON(http.StatusBadRequest, gin.H{
+	// Update session with the provider session
+	session.ProviderSession = providerSession
+	if err := h.saveSession(session); err != nil {
+		log.Printf("❌ Failed to persist verification session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   "Au10tix token has expired",
+			"error":   "Failed to store verification session",
 		})
 		return
 	}
 
-	// Create Au10tix session
-	sessionURL, au10tixSession, err := h.createAu10tixSession(config, jwtPayload, request)
-	if err != nil {
-		log.Printf("❌ Failed to create Au10tix session: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   fmt.Sprintf("Failed to create verification session: %v", err),
-		})
+	if !h.bindVerificationToFlow(c, flow, sessionID) {
 		return
 	}
 
-	// Update session with Au10tix info
-	session.Au10tixSession = au10tixSession
-	h.sessions[sessionID] = session
-
-	log.Printf("✅ Verification session created: %s (token source: %s)", sessionID, tokenSource)
+	log.Printf("✅ Verification session created: %s (provider: %s, credentials from: %s)", sessionID, provider, providerSession.CredentialSource)
 	c.JSON(http.StatusOK, gin.H{
 		"success":        true,
 		"verificationId": sessionID,
-		"sessionUrl":     sessionURL,
-		"tokenSource":    tokenSource,
+		"sessionUrl":     providerSession.SessionURL,
+		"provider":       provider,
+		"mode":           caps.Mode,
+		"tokenSource":    providerSession.CredentialSource,
+		"profile":        profileName,
 	})
 }
 
@@ -159,33 +235,8 @@ func (h *VerificationHandler) CheckVerificationResult(c *gin.Context) {
 		return
 	}
 
-	log.Printf("🔍 Checking Au10tix verification result for ID: %s", verificationID)
+	log.Printf("🔍 Checking verification result for ID: %s", verificationID)
 
-	// Get Au10tix token with fallback
-	au10tixToken, tokenSource, err := h.configHandler.GetAu10tixTokenWithFallback()
-	if err != nil {
-		log.Printf("❌ Failed to get Au10tix token: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Au10tix token error",
-		})
-		return
-	}
-
-	log.Printf("🔑 Using Au10tix token from: %s", tokenSource)
-
-	// Decode JWT token to get API URL
-	jwtPayload, err := h.configHandler.DecodeAu10tixToken(au10tixToken)
-	if err != nil {
-		log.Printf("❌ Failed to decode Au10tix token: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Invalid Au10tix token",
-		})
-		return
-	}
-
-	// Load configuration for other settings
 	config, err := h.configHandler.LoadConfig()
 	if err != nil {
 		log.Printf("❌ Failed to load config: %v", err)
@@ -196,318 +247,46 @@ func (h *VerificationHandler) CheckVerificationResult(c *gin.Context) {
 		return
 	}
 
-	baseURL := jwtPayload.APIUrl
-	if baseURL == "" {
-		baseURL = config.API.Au10tixBaseURL
-	}
-	baseURL = strings.TrimSuffix(baseURL, "/")
-
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: time.Duration(config.API.APITimeout) * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-
-	// Use the correct Au10tix result endpoint
-	resultURL := fmt.Sprintf("%s/result/v2/results/person/%s", baseURL, verificationID)
-	log.Printf("🔗 Checking Au10tix result: %s", resultURL)
-
-	req, err := http.NewRequest("GET", resultURL, nil)
+	provider := verificationProvider(config)
+	verifier, err := h.identityVerifier(config, provider)
 	if err != nil {
-		log.Printf("❌ Failed to create result request: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to create request",
-		})
+		respondVerifierUnavailable(c, err)
 		return
 	}
 
-	// Add query parameter for detailed results
-	q := req.URL.Query()
-	q.Add("includeDetailed", "true")
-	req.URL.RawQuery = q.Encode()
-
-	req.Header.Set("Authorization", "Bearer "+au10tixToken)
-	req.Header.Set("User-Agent", "SelfServicePortal/1.0")
-	req.Header.Set("Accept", "application/json")
-
-	// Rest of the method remains the same...
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("❌ Result request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Request failed",
-		})
-		return
+	result, err := verifier.GetResult(c.Request.Context(), verificationID)
+	if err == nil && !result.Final() {
+		err = ErrVerificationResultNotReady
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("❌ Failed to read result response: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to read response",
-		})
-		return
-	}
-
-	log.Printf("📡 Au10tix Result Response Status: %d, Body: %s", resp.StatusCode, string(body))
-
-	if resp.StatusCode != 200 {
-		c.JSON(resp.StatusCode, gin.H{
-			"success": false,
-			"error":   fmt.Sprintf("Au10tix result API error (status: %d): %s", resp.StatusCode, string(body)),
-		})
-		return
-	}
+		log.Printf("❌ Result request failed: %v", err)
 
-	// Parse and return the result
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		log.Printf("❌ Failed to parse result response: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to parse result",
-		})
+		switch {
+		case errors.Is(err, ErrVerificationResultNotReady):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Verification result not ready",
+			})
+		case isVerifierUnavailable(err):
+			respondVerifierUnavailable(c, err)
+		default:
+			c.JSON(http.StatusBadGateway, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("Result request failed: %v", err),
+			})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success":     true,
-		"result":      result,
-		"tokenSource": tokenSource,
+		"success":  true,
+		"result":   result.Data,
+		"outcome":  result.Outcome,
+		"provider": provider,
+		"mode":     verifier.Capabilities().Mode,
 	})
 }
 
-/// Quick fixes to try in your verification.go createAu10tixSession method
-
-// FIX 1: Try a simpler request format first
-// Update your createAu10tixSession method in verification.go
-
-func (h *VerificationHandler) createAu10tixSession(config *PortalConfig, jwtPayload *Au10tixJWTPayload, userData VerificationStartRequest) (string, *Au10tixSessionResponse, error) {
-	baseURL := jwtPayload.APIUrl
-	if baseURL == "" {
-		baseURL = config.API.Au10tixBaseURL
-	}
-	baseURL = strings.TrimSuffix(baseURL, "/")
-
-	// Get the token with fallback
-	token, tokenSource, err := h.configHandler.GetAu10tixTokenWithFallback()
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to get token: %w", err)
-	}
-
-	log.Printf("🔑 Using Au10tix token from: %s", tokenSource)
-	log.Printf("🏢 Organization: %s (ID: %d)", jwtPayload.ClientOrganizationName, jwtPayload.ClientOrganizationID)
-
-	// Check token expiration
-	if time.Now().Unix() > jwtPayload.EXP {
-		return "", nil, fmt.Errorf("JWT token expired at %s", time.Unix(jwtPayload.EXP, 0).Format("2006-01-02 15:04:05"))
-	}
-
-	// Create Au10tix workflow request (use the working format)
-	workflowRequest := map[string]interface{}{
-		"workflowOptions": map[string]interface{}{},
-		"serviceOptions": map[string]interface{}{
-			"secureme": map[string]interface{}{
-				"shortUrl": true,
-				"requestTypes": map[string]interface{}{
-					"idFront":     []string{"file", "camera"},
-					"idBack":      []string{"file", "camera"},
-					"faceCompare": []string{"camera"},
-				},
-			},
-		},
-	}
-
-	// Add user data if present
-	userDataMap := map[string]interface{}{}
-	if userData.FirstName != "" {
-		userDataMap["firstName"] = userData.FirstName
-	}
-	if userData.LastName != "" {
-		userDataMap["lastName"] = userData.LastName
-	}
-	if userData.Email != "" {
-		userDataMap["email"] = userData.Email
-	}
-	if userData.PhoneNumber != "" {
-		userDataMap["phoneNumber"] = userData.PhoneNumber
-	}
-	if userData.DateOfBirth != "" {
-		userDataMap["dateOfBirth"] = userData.DateOfBirth
-	}
-	if len(userDataMap) > 0 {
-		workflowRequest["userData"] = userDataMap
-	}
-
-	jsonData, err := json.Marshal(workflowRequest)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to marshal workflow request: %w", err)
-	}
-
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: time.Duration(config.API.APITimeout) * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-
-	// Use the working endpoint
-	workflowURL := baseURL + "/workflow/v1/workflows/person/Au10tix201"
-	log.Printf("🔗 Creating Au10tix workflow: %s", workflowURL)
-
-	req, err := http.NewRequest("POST", workflowURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "SelfServicePortal/1.0")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	log.Printf("📡 Au10tix Response Status: %d, Body: %s", resp.StatusCode, string(body))
-
-	// Check for success
-	if resp.StatusCode != 201 && resp.StatusCode != 200 {
-		return "", nil, fmt.Errorf("Au10tix API error (status: %d): %s", resp.StatusCode, string(body))
-	}
-
-	// Parse the successful response
-	var workflowResp map[string]interface{}
-	if err := json.Unmarshal(body, &workflowResp); err != nil {
-		return "", nil, fmt.Errorf("failed to parse workflow response: %w", err)
-	}
-
-	// Extract session ID and verification URL
-	var sessionID, verificationURL string
-
-	// Get session ID
-	if id, ok := workflowResp["sessionId"].(string); ok {
-		sessionID = id
-	}
-
-	// Get verification URL from response.securemeLink
-	if response, ok := workflowResp["response"].(map[string]interface{}); ok {
-		if link, ok := response["securemeLink"].(string); ok {
-			verificationURL = link
-		}
-	}
-
-	if verificationURL == "" {
-		return "", nil, fmt.Errorf("no verification URL found in Au10tix response")
-	}
-
-	// Create session response
-	sessionResp := &Au10tixSessionResponse{
-		SessionID:  sessionID,
-		SessionURL: verificationURL,
-		Status:     "created",
-	}
-
-	log.Printf("✅ Au10tix session created successfully:")
-	log.Printf("   Session ID: %s", sessionID)
-	log.Printf("   Verification URL: %s", verificationURL)
-
-	return verificationURL, sessionResp, nil
-}
-
-// Helper method to try creating a session
-func (h *VerificationHandler) tryCreateSession(client *http.Client, url, token string, requestBody map[string]interface{}) (string, *Au10tixSessionResponse, error) {
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", nil, err
-	}
-
-	// FIX 3: Make sure headers are exactly right
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "SelfServicePortal/1.0")
-
-	log.Printf("📤 Request to: %s", url)
-	log.Printf("📤 Body: %s", string(jsonData))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", nil, err
-	}
-
-	log.Printf("📡 Response %d: %s", resp.StatusCode, string(body))
-
-	if resp.StatusCode != 200 && resp.StatusCode != 201 {
-		return "", nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse successful response
-	var workflowResp map[string]interface{}
-	if err := json.Unmarshal(body, &workflowResp); err != nil {
-		return "", nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	// Extract URL and ID
-	var sessionURL, sessionID string
-
-	// Look for session URL
-	urlFields := []string{"securemeLink", "workflowUrl", "url", "link", "sessionUrl", "verificationUrl"}
-	for _, field := range urlFields {
-		if url, ok := workflowResp[field].(string); ok && url != "" {
-			sessionURL = url
-			break
-		}
-	}
-
-	// Look for session ID
-	idFields := []string{"id", "workflowId", "sessionId"}
-	for _, field := range idFields {
-		if id, ok := workflowResp[field].(string); ok && id != "" {
-			sessionID = id
-			break
-		}
-	}
-
-	if sessionURL == "" {
-		return "", nil, fmt.Errorf("no session URL found in response")
-	}
-
-	sessionResp := &Au10tixSessionResponse{
-		SessionID:  sessionID,
-		SessionURL: sessionURL,
-		Status:     "created",
-	}
-
-	return sessionURL, sessionResp, nil
-}
-
 // Au10tixProxy provides a proxy to Au10tix API (matching Python Flask functionality)
 func (h *VerificationHandler) Au10tixProxy(c *gin.Context) {
 	// Get the endpoint path
@@ -530,19 +309,25 @@ func (h *VerificationHandler) Au10tixProxy(c *gin.Context) {
 
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 
-	// Build the full API URL
-	baseURL := "https://eus-api.au10tixservicesstaging.com" // Default staging environment
-	apiURL := fmt.Sprintf("%s/%s", baseURL, endpoint)
+	config, err := h.configHandler.LoadConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to load configuration",
+		})
+		return
+	}
+
+	// Forward only to the configured Au10tix API, never to a host outside the allowlist
+	baseURL, err := au10tixAPIURL(config, nil)
+	if err != nil {
+		respondVerifierUnavailable(c, err)
+		return
+	}
+	apiURL := fmt.Sprintf("%s/%s", baseURL, strings.TrimPrefix(endpoint, "/"))
 
 	log.Printf("🔄 Au10tix API Proxy: %s %s", c.Request.Method, apiURL)
 
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	client := h.configHandler.au10tixHTTPClient(30 * time.Second)
 
 	// Prepare the request
 	var reqBody io.Reader
@@ -615,27 +400,80 @@ func (h *VerificationHandler) Au10tixProxy(c *gin.Context) {
 
 // GetSession retrieves a verification session by ID
 func (h *VerificationHandler) GetSession(sessionID string) (*VerificationSession, bool) {
-	session, exists := h.sessions[sessionID]
-	return session, exists
+	session, err := h.store.Get(sessionID)
+	if err != nil {
+		if !errors.Is(err, ErrVerificationNotFound) {
+			log.Printf("❌ Failed to load verification session %s: %v", sessionID, err)
+		}
+		return nil, false
+	}
+	return session, true
 }
 
 // UpdateSession updates a verification session
 func (h *VerificationHandler) UpdateSession(sessionID string, session *VerificationSession) {
-	h.sessions[sessionID] = session
+	session.ID = sessionID
+	if err := h.saveSession(session); err != nil {
+		log.Printf("❌ Failed to persist verification session %s: %v", sessionID, err)
+	}
 }
 
-// GetSessionByAu10tixID finds a session by Au10tix session ID
-func (h *VerificationHandler) GetSessionByAu10tixID(au10tixSessionID string) (*VerificationSession, string, bool) {
-	for id, session := range h.sessions {
-		if session.Au10tixSession != nil && session.Au10tixSession.SessionID == au10tixSessionID {
-			return session, id, true
+// GetSessionByProviderSession finds a session by the provider's session ID
+func (h *VerificationHandler) GetSessionByProviderSession(provider, providerSessionID string) (*VerificationSession, string, bool) {
+	session, err := h.store.GetByProviderSession(provider, providerSessionID)
+	if err != nil {
+		if !errors.Is(err, ErrVerificationNotFound) {
+			log.Printf("❌ Failed to load verification for %s session %s: %v", provider, providerSessionID, err)
 		}
+		return nil, "", false
 	}
-	return nil, "", false
+	return session, session.ID, true
 }
 
-// Replace the GetVerificationStatus method in verification.go with this version:
+// saveSession writes a verification session to the configured store and audits a new or
+// changed result, whether it came from the webhook, polling or a status check
+func (h *VerificationHandler) saveSession(session *VerificationSession) error {
+	previousResult := ""
+	if h.audit != nil {
+		if previous, err := h.store.Get(session.ID); err == nil {
+			previousResult = previous.Result
+		}
+	}
+
+	if err := h.store.Put(session); err != nil {
+		return err
+	}
+
+	if h.audit != nil && session.Result != "" && session.Result != previousResult {
+		details := map[string]interface{}{
+			"verification_id": session.ID,
+			"result":          session.Result,
+			"status":          session.Status,
+		}
+		if session.Score != 0 {
+			details["score"] = session.Score
+		}
+		if previousResult != "" {
+			details["previous_result"] = previousResult
+		}
+		h.audit.RecordSystem("system", AuditVerificationResult, session.UserData.Email, AuditOutcomeSuccess, details)
+	}
+	return nil
+}
 
+// listSessions returns stored sessions in any of the given statuses (all sessions when none given)
+func (h *VerificationHandler) listSessions(statuses ...string) []*VerificationSession {
+	sessions, err := h.store.List(VerificationFilter{Statuses: statuses})
+	if err != nil {
+		log.Printf("❌ Failed to list verification sessions: %v", err)
+		return nil
+	}
+	return sessions
+}
+
+// GetVerificationStatus returns the status of a verification, refreshed from the provider while
+// it is unfinished. Identity data and provider results are only included for operators and for
+// the visitor whose enrollment flow the verification belongs to.
 func (h *VerificationHandler) GetVerificationStatus(c *gin.Context) {
 	sessionID := c.Param("id")
 	if sessionID == "" {
@@ -657,79 +495,78 @@ func (h *VerificationHandler) GetVerificationStatus(c *gin.Context) {
 		return
 	}
 
-	// Try to update status from Au10tix if we have a session
-	if session.Au10tixSession != nil {
-		// Get Au10tix token with fallback
-		au10tixToken, tokenSource, err := h.configHandler.GetAu10tixTokenWithFallback()
-		if err == nil && au10tixToken != "" {
-			log.Printf("🔑 Checking Au10tix status using token from: %s", tokenSource)
-
-			// Load configuration for other settings
-			config, err := h.configHandler.LoadConfig()
-			if err == nil {
-				// Try to check Au10tix session status (won't fail if endpoints don't work)
-				if updatedSession, err := h.checkAu10tixSessionStatus(config, session); err == nil {
-					session = updatedSession
-					h.UpdateSession(sessionID, session)
-					log.Printf("✅ Successfully updated session status from Au10tix")
-				} else {
-					log.Printf("⚠️ Au10tix status check failed (continuing anyway): %v", err)
-				}
+	// Try to update an unfinished session from its provider
+	if session.ProviderSession != nil && !session.Finished() {
+		config, err := h.configHandler.LoadConfig()
+		if err == nil {
+			// Try to check the provider status (won't fail if endpoints don't work)
+			if updatedSession, err := h.checkProviderStatus(config, session); err == nil {
+				session = updatedSession
+				h.UpdateSession(sessionID, session)
+				log.Printf("✅ Successfully updated session status from %s", sessionProvider(session.ProviderSession))
 			} else {
-				log.Printf("⚠️ Failed to load config for Au10tix check: %v", err)
+				log.Printf("⚠️ Provider status check failed (continuing anyway): %v", err)
 			}
 		} else {
-			log.Printf("⚠️ No Au10tix token available for status check")
+			log.Printf("⚠️ Failed to load config for provider check: %v", err)
 		}
-	} else {
-		log.Printf("📊 No Au10tix session to check - returning current status")
 	}
 
-	// Prepare response with enhanced information
 	responseData := map[string]interface{}{
 		"success":    true,
 		"status":     session.Status,
 		"result":     session.Result,
-		"score":      session.Score,
-		"data":       session.Data,
 		"created_at": session.CreatedAt,
 		"updated_at": session.UpdatedAt,
-		"user_data":  session.UserData,
 	}
 
-	// Add Au10tix session info if available
-	if session.Au10tixSession != nil {
-		responseData["au10tix_session"] = map[string]interface{}{
-			"session_id":  session.Au10tixSession.SessionID,
-			"session_url": session.Au10tixSession.SessionURL,
-			"status":      session.Au10tixSession.Status,
+	// Report the enrollment flow state when this verification belongs to the caller's flow
+	ownFlow := false
+	if h.flows != nil {
+		if flow, err := h.flows.Current(c); err == nil && flow.VerificationID == sessionID {
+			responseData["flow_state"] = flow.State
+			ownFlow = true
 		}
 	}
 
-	// Enhanced logging: print full Au10tix verification data as pretty JSON
-	if session.Data != nil {
-		if pretty, err := json.MarshalIndent(session.Data, "", "  "); err == nil {
-			log.Printf("\n========== Au10tix Verification Data for session %s =========\n%s\n============================================================", sessionID, string(pretty))
+	if ownFlow || isOperatorRequest(c) {
+		responseData["score"] = session.Score
+		responseData["data"] = session.Data
+		responseData["outcome"] = session.Outcome
+		responseData["user_data"] = session.UserData
+
+		if session.ProviderSession != nil {
+			responseData["provider_session"] = map[string]interface{}{
+				"provider":    sessionProvider(session.ProviderSession),
+				"session_id":  session.ProviderSession.SessionID,
+				"session_url": session.ProviderSession.SessionURL,
+				"status":      session.ProviderSession.Status,
+			}
 		}
 	}
 
 	// Add helpful status messages
 	switch session.Status {
 	case "pending":
-		responseData["message"] = "Verification is pending - waiting for user to complete Au10tix workflow"
-		if session.Au10tixSession != nil {
+		responseData["message"] = "Verification is pending - waiting for user to complete the verification workflow"
+		if session.ProviderSession != nil {
 			responseData["next_step"] = "User should complete verification at the provided session URL"
 		}
 	case "in_progress":
-		responseData["message"] = "Verification is in progress - Au10tix is processing the submission"
+		responseData["message"] = "Verification is in progress - the provider is processing the submission"
 	case "completed":
-		if session.Result == "verified" {
+		switch session.Result {
+		case DecisionVerified:
 			responseData["message"] = "Verification completed successfully"
-		} else {
+		case DecisionReview:
+			responseData["message"] = "Verification completed and requires manual review"
+		default:
 			responseData["message"] = "Verification completed but failed validation"
 		}
 	case "failed":
 		responseData["message"] = "Verification failed"
+	case "expired":
+		responseData["message"] = "Verification expired before it was completed"
 	default:
 		responseData["message"] = "Unknown verification status"
 	}
@@ -739,151 +576,93 @@ func (h *VerificationHandler) GetVerificationStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, responseData)
 }
 
-// PollForResults automatically checks Au10tix for results and updates session
+// PollForResults automatically checks the provider for results and updates session
 func (h *VerificationHandler) PollForResults(sessionID string) error {
-	session, exists := h.sessions[sessionID]
+	session, exists := h.GetSession(sessionID)
 	if !exists {
 		return fmt.Errorf("session not found")
 	}
 
-	if session.Au10tixSession == nil {
-		return fmt.Errorf("no Au10tix session")
+	if session.ProviderSession == nil {
+		return fmt.Errorf("no provider session")
 	}
 
-	// Skip if already completed
-	if session.Status == "completed" {
+	// Skip if already finished
+	if session.Finished() {
 		return nil
 	}
 
-	log.Printf("🔄 Polling Au10tix results for session: %s", sessionID)
+	provider := sessionProvider(session.ProviderSession)
+	log.Printf("🔄 Polling %s results for session: %s", provider, sessionID)
 
-	// Get Au10tix token
-	au10tixToken, _, err := h.configHandler.GetAu10tixTokenWithFallback()
-	if err != nil {
-		return fmt.Errorf("failed to get token: %w", err)
-	}
-
-	// Decode token
-	jwtPayload, err := h.configHandler.DecodeAu10tixToken(au10tixToken)
+	config, err := h.configHandler.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to decode token: %w", err)
-	}
-
-	baseURL := jwtPayload.APIUrl
-	if baseURL == "" {
-		baseURL = "https://eus-api.au10tixservicesstaging.com"
+		return fmt.Errorf("failed to load config: %w", err)
 	}
-	baseURL = strings.TrimSuffix(baseURL, "/")
 
-	// Try to get results
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-
-	// Try the most likely result endpoint
-	resultURL := fmt.Sprintf("%s/result/v2/results/person/%s", baseURL, session.Au10tixSession.SessionID)
-
-	req, err := http.NewRequest("GET", resultURL, nil)
+	verifier, err := h.sessionVerifier(config, session)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	// Add query parameters
-	q := req.URL.Query()
-	q.Add("includeDetailed", "true")
-	req.URL.RawQuery = q.Encode()
-
-	req.Header.Set("Authorization", "Bearer "+au10tixToken)
-	req.Header.Set("User-Agent", "SelfServicePortal/1.0")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+	result, err := verifier.GetResult(context.Background(), session.ProviderSession.SessionID)
+	if errors.Is(err, ErrVerificationResultNotReady) || (err == nil && !result.Final()) {
+		// The verification might still be in progress
+		log.Printf("⏳ Verification results not ready yet for session: %s", sessionID)
+		return nil // Not an error, just not ready
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
-	}
-
-	log.Printf("📡 Au10tix Result Response: Status %d, Body: %s", resp.StatusCode, string(body))
-
-	if resp.StatusCode != 200 {
-		// If 404, verification might still be in progress
-		if resp.StatusCode == 404 {
-			log.Printf("⏳ Verification results not ready yet for session: %s", sessionID)
-			return nil // Not an error, just not ready
-		}
-		return fmt.Errorf("Au10tix result API error (status: %d): %s", resp.StatusCode, string(body))
-	}
-
-	// Parse results
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return fmt.Errorf("failed to parse result: %w", err)
-	}
-
-	// Update session with results
-	session.Status = "completed"
-	session.UpdatedAt = time.Now()
-	session.Data = result
-
-	// Extract specific result fields
-	if status, ok := result["status"].(string); ok {
-		switch strings.ToLower(status) {
-		case "verified", "passed", "approved", "success":
-			session.Result = "verified"
-		case "failed", "rejected", "denied":
-			session.Result = "failed"
-		default:
-			session.Result = status
-		}
-	}
-
-	if score, ok := result["score"].(float64); ok {
-		session.Score = score
+		return err
 	}
+	applyProviderResult(session, result)
 
 	// Save updated session
-	h.sessions[sessionID] = session
+	if err := h.saveSession(session); err != nil {
+		return fmt.Errorf("failed to persist results: %w", err)
+	}
 
 	log.Printf("✅ Updated verification session %s with results: %s", sessionID, session.Result)
 	return nil
 }
 
-// Add this to your VerificationHandler in verification.go
+// StartResultPolling starts background polling as a fallback for results that never
+// arrived through a provider webhook. A non-positive interval disables polling.
+func (h *VerificationHandler) StartResultPolling(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("🔕 Verification result polling disabled - relying on webhooks")
+		return
+	}
 
-// StartResultPolling starts background polling for pending verifications
-func (h *VerificationHandler) StartResultPolling() {
 	go func() {
-		ticker := time.NewTicker(30 * time.Second) // Poll every 30 seconds
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		log.Printf("🔄 Started Au10tix result polling service")
+		log.Printf("🔄 Started verification result polling fallback (every %v)", interval)
 
 		for range ticker.C {
-			h.pollPendingVerifications()
+			h.pollPendingVerifications(interval)
 		}
 	}()
 }
 
-// pollPendingVerifications checks all pending verifications for results
-func (h *VerificationHandler) pollPendingVerifications() {
+// pollPendingVerifications checks unfinished verifications that saw no update for at least quietPeriod
+func (h *VerificationHandler) pollPendingVerifications(quietPeriod time.Duration) {
 	pendingCount := 0
 
-	for sessionID, session := range h.sessions {
-		// Only poll sessions that are pending and have Au10tix session
-		if session.Status == "pending" && session.Au10tixSession != nil {
+	for _, session := range h.listSessions("pending", "in_progress") {
+		sessionID := session.ID
+		// Only poll sessions that have a provider session
+		if session.ProviderSession != nil {
 			// Don't poll sessions that are too old (older than 1 hour)
 			if time.Since(session.CreatedAt) > time.Hour {
 				continue
 			}
 
+			// Skip sessions recently updated by a webhook
+			if time.Since(session.UpdatedAt) < quietPeriod {
+				continue
+			}
+
 			pendingCount++
 
 			// Poll for results
@@ -904,8 +683,9 @@ func (h *VerificationHandler) CheckAllPendingResults(c *gin.Context) {
 
 	results := make([]map[string]interface{}, 0)
 
-	for sessionID, session := range h.sessions {
-		if session.Status == "pending" && session.Au10tixSession != nil {
+	for _, session := range h.listSessions("pending") {
+		sessionID := session.ID
+		if session.ProviderSession != nil {
 			result := map[string]interface{}{
 				"session_id": sessionID,
 				"created_at": session.CreatedAt,
@@ -917,7 +697,10 @@ func (h *VerificationHandler) CheckAllPendingResults(c *gin.Context) {
 				result["status"] = "error"
 			} else {
 				// Get updated session
-				updatedSession := h.sessions[sessionID]
+				updatedSession, _ := h.GetSession(sessionID)
+				if updatedSession == nil {
+					updatedSession = session
+				}
 				result["status"] = updatedSession.Status
 				result["result"] = updatedSession.Result
 				result["score"] = updatedSession.Score
@@ -938,19 +721,20 @@ func (h *VerificationHandler) CheckAllPendingResults(c *gin.Context) {
 func (h *VerificationHandler) GetAllSessions() map[string]*VerificationSession {
 	// Return a copy to prevent external modification
 	sessionsCopy := make(map[string]*VerificationSession)
-	for id, session := range h.sessions {
-		sessionsCopy[id] = session
+	for _, session := range h.listSessions() {
+		sessionsCopy[session.ID] = session
 	}
 	return sessionsCopy
 }
 
 // Alternative: GetAllSessionsData returns formatted session data
 func (h *VerificationHandler) GetAllSessionsData() []map[string]interface{} {
-	sessions := make([]map[string]interface{}, 0, len(h.sessions))
+	allSessions := h.listSessions()
+	sessions := make([]map[string]interface{}, 0, len(allSessions))
 
-	for id, session := range h.sessions {
+	for _, session := range allSessions {
 		sessionData := map[string]interface{}{
-			"id":         id,
+			"id":         session.ID,
 			"status":     session.Status,
 			"result":     session.Result,
 			"score":      session.Score,
@@ -959,9 +743,10 @@ func (h *VerificationHandler) GetAllSessionsData() []map[string]interface{} {
 			"updated_at": session.UpdatedAt,
 		}
 
-		if session.Au10tixSession != nil {
-			sessionData["au10tix_session_id"] = session.Au10tixSession.SessionID
-			sessionData["au10tix_session_url"] = session.Au10tixSession.SessionURL
+		if session.ProviderSession != nil {
+			sessionData["provider"] = sessionProvider(session.ProviderSession)
+			sessionData["provider_session_id"] = session.ProviderSession.SessionID
+			sessionData["provider_session_url"] = session.ProviderSession.SessionURL
 		}
 
 		sessions = append(sessions, sessionData)
@@ -970,179 +755,24 @@ func (h *VerificationHandler) GetAllSessionsData() []map[string]interface{} {
 	return sessions
 }
 
-// checkAu10tixSessionStatus checks the status of an Au10tix session
-// Replace the checkAu10tixSessionStatus method in verification.go with this improved version:
-
-func (h *VerificationHandler) checkAu10tixSessionStatus(config *PortalConfig, session *VerificationSession) (*VerificationSession, error) {
-	if session.Au10tixSession == nil {
-		return session, fmt.Errorf("no Au10tix session available")
-	}
-
-	// Get token with fallback
-	au10tixToken, tokenSource, err := h.configHandler.GetAu10tixTokenWithFallback()
-	if err != nil {
-		return session, fmt.Errorf("failed to get Au10tix token: %w", err)
-	}
-
-	log.Printf("🔑 Checking Au10tix status using token from: %s", tokenSource)
-
-	jwtPayload, err := h.configHandler.DecodeAu10tixToken(au10tixToken)
+// checkProviderStatus updates a session from its provider. A provider that cannot be reached
+// leaves the session as it is, so the verification keeps working while status checks fail.
+func (h *VerificationHandler) checkProviderStatus(config *PortalConfig, session *VerificationSession) (*VerificationSession, error) {
+	verifier, err := h.sessionVerifier(config, session)
 	if err != nil {
-		return session, fmt.Errorf("failed to decode token: %w", err)
+		return session, err
 	}
 
-	baseURL := jwtPayload.APIUrl
-	if baseURL == "" {
-		baseURL = config.API.Au10tixBaseURL
-	}
-	baseURL = strings.TrimSuffix(baseURL, "/")
-
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: time.Duration(config.API.APITimeout) * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-
-	au10tixSessionID := session.Au10tixSession.SessionID
-
-	// Try multiple endpoints to check status/results
-	statusEndpoints := []string{
-		// Result endpoints (more likely to work)
-		"/result/v2/results/person/" + au10tixSessionID,
-		"/api/v2/results/" + au10tixSessionID,
-		"/api/v1/results/" + au10tixSessionID,
-		"/results/" + au10tixSessionID,
-		"/workflow/v1/results/" + au10tixSessionID,
-		"/secure-me/v2/results/" + au10tixSessionID,
-		// Status endpoints (less likely to work based on 404 error)
-		"/api/v1/sessions/" + au10tixSessionID,
-		"/v1/sessions/" + au10tixSessionID,
-		"/sessions/" + au10tixSessionID,
-		"/workflow/v1/sessions/" + au10tixSessionID,
-	}
-
-	var lastError error
-	var workingResponse map[string]interface{}
-
-	for _, endpoint := range statusEndpoints {
-		statusURL := baseURL + endpoint
-		log.Printf("🔍 Trying Au10tix endpoint: %s", statusURL)
-
-		req, err := http.NewRequest("GET", statusURL, nil)
-		if err != nil {
-			lastError = err
-			continue
-		}
-
-		// Add query parameters for result endpoints
-		if strings.Contains(endpoint, "result") {
-			q := req.URL.Query()
-			q.Add("includeDetailed", "true")
-			req.URL.RawQuery = q.Encode()
-		}
-
-		req.Header.Set("Authorization", "Bearer "+au10tixToken)
-		req.Header.Set("User-Agent", "SelfServicePortal/1.0")
-		req.Header.Set("Accept", "application/json")
-
-		resp, err := client.Do(req)
-		if err != nil {
-			lastError = err
-			log.Printf("⚠️ Request failed for %s: %v", endpoint, err)
-			continue
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			lastError = err
-			log.Printf("⚠️ Failed to read response for %s: %v", endpoint, err)
-			continue
-		}
-
-		log.Printf("📡 Au10tix Response from %s: Status %d, Body: %s", endpoint, resp.StatusCode, string(body))
-
-		if resp.StatusCode == 200 {
-			// Parse successful response
-			var statusResp map[string]interface{}
-			if err := json.Unmarshal(body, &statusResp); err != nil {
-				log.Printf("⚠️ Failed to parse JSON response from %s: %v", endpoint, err)
-				continue
-			}
-
-			workingResponse = statusResp
-			log.Printf("✅ Found working Au10tix endpoint: %s", endpoint)
-			break
-
-		} else if resp.StatusCode == 404 {
-			log.Printf("🔍 Endpoint %s not found (404) - trying next", endpoint)
-			lastError = fmt.Errorf("endpoint not found: %s", endpoint)
-			continue
-
-		} else if resp.StatusCode == 401 {
-			lastError = fmt.Errorf("authentication failed (401)")
-			log.Printf("🔑 Authentication failed for %s", endpoint)
-			break // No point trying other endpoints if auth fails
-
-		} else {
-			lastError = fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
-			log.Printf("⚠️ HTTP error %d from %s: %s", resp.StatusCode, endpoint, string(body))
-		}
+	result, err := verifier.GetResult(context.Background(), session.ProviderSession.SessionID)
+	if isVerifierUnavailable(err) {
+		return session, err
 	}
-
-	// If no endpoint worked, handle gracefully
-	if workingResponse == nil {
-		log.Printf("⚠️ No Au10tix endpoint worked, keeping session as pending")
-		if lastError != nil {
-			log.Printf("⚠️ Last error: %v", lastError)
-		}
-
-		// Don't return an error - just log and keep session as is
-		// This allows the verification to continue working even if status checking fails
+	if err != nil {
+		log.Printf("⚠️ No %s status available, keeping session as pending: %v", sessionProvider(session.ProviderSession), err)
 		return session, nil
 	}
 
-	// Update session based on successful Au10tix response
-	session.UpdatedAt = time.Now()
-	session.Data = workingResponse
-
-	// Extract status information from response
-	if status, ok := workingResponse["status"].(string); ok {
-		switch strings.ToLower(status) {
-		case "completed", "success", "verified", "passed", "approved":
-			session.Status = "completed"
-			session.Result = "verified"
-		case "failed", "rejected", "denied":
-			session.Status = "completed"
-			session.Result = "failed"
-		case "in_progress", "processing", "pending":
-			session.Status = "in_progress"
-		default:
-			log.Printf("📊 Unknown Au10tix status: %s", status)
-			session.Status = "pending"
-		}
-	}
-
-	// Extract score if available
-	if score, ok := workingResponse["score"].(float64); ok {
-		session.Score = score
-	}
-
-	// Extract result if available
-	if result, ok := workingResponse["result"].(string); ok {
-		switch strings.ToLower(result) {
-		case "verified", "passed", "approved", "success":
-			session.Result = "verified"
-		case "failed", "rejected", "denied":
-			session.Result = "failed"
-		}
-	}
-
-	log.Printf("✅ Updated session status: %s, result: %s, score: %.2f",
-		session.Status, session.Result, session.Score)
-
+	applyProviderResult(session, result)
 	return session, nil
 }
 
@@ -1159,7 +789,7 @@ func (h *VerificationHandler) SimulateVerificationComplete(c *gin.Context) {
 
 	log.Printf("🎭 Simulating verification completion for session: %s", sessionID)
 
-	session, exists := h.sessions[sessionID]
+	session, exists := h.GetSession(sessionID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -1178,8 +808,18 @@ func (h *VerificationHandler) SimulateVerificationComplete(c *gin.Context) {
 		"document_type": "passport",
 		"confidence":    "high",
 	}
+	session.Outcome = &VerificationOutcome{
+		Decision:             DecisionVerified,
+		Score:                session.Score,
+		DocumentType:         "passport",
+		DocumentAuthenticity: VerificationCheck{Status: CheckPassed},
+		FaceMatch:            VerificationCheck{Status: CheckPassed},
+		Liveness:             VerificationCheck{Status: CheckNotPerformed},
+		Provider:             "simulated",
+		EvaluatedAt:          session.UpdatedAt,
+	}
 
-	h.sessions[sessionID] = session
+	h.UpdateSession(sessionID, session)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -1196,8 +836,8 @@ func (h *VerificationHandler) CheckSimulatedVerification(c *gin.Context) {
 	hasCompletedVerification := false
 	var lastCompletedSession *VerificationSession
 
-	for _, session := range h.sessions {
-		if session.Status == "completed" && session.Result == "verified" {
+	for _, session := range h.listSessions("completed") {
+		if session.Result == "verified" {
 			hasCompletedVerification = true
 			if lastCompletedSession == nil || session.UpdatedAt.After(lastCompletedSession.UpdatedAt) {
 				lastCompletedSession = session
@@ -1245,7 +885,14 @@ func (h *VerificationHandler) CreateSimulatedVerification(c *gin.Context) {
 		UpdatedAt: time.Now(),
 	}
 
-	h.sessions[sessionID] = session
+	if err := h.saveSession(session); err != nil {
+		log.Printf("❌ Failed to persist simulated verification session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to store verification session",
+		})
+		return
+	}
 
 	log.Printf("✅ Created simulated verification session: %s", sessionID)
 
@@ -1260,10 +907,7 @@ func (h *VerificationHandler) CreateSimulatedVerification(c *gin.Context) {
 func (h *VerificationHandler) ListVerificationSessions(c *gin.Context) {
 	log.Printf("📋 Listing all verification sessions")
 
-	sessions := make([]*VerificationSession, 0, len(h.sessions))
-	for _, session := range h.sessions {
-		sessions = append(sessions, session)
-	}
+	sessions := h.listSessions()
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
@@ -1276,14 +920,15 @@ func (h *VerificationHandler) ListVerificationSessions(c *gin.Context) {
 func (h *VerificationHandler) CleanupExpiredSessions() {
 	log.Printf("🧹 Cleaning up expired verification sessions")
 
-	now := time.Now()
 	expiry := 24 * time.Hour // Sessions expire after 24 hours
 
-	for id, session := range h.sessions {
-		if now.Sub(session.CreatedAt) > expiry {
-			log.Printf("🗑️ Removing expired session: %s", id)
-			delete(h.sessions, id)
-		}
+	expired, err := h.store.Expire(time.Now().Add(-expiry))
+	if err != nil {
+		log.Printf("❌ Failed to expire verification sessions: %v", err)
+		return
+	}
+	if expired > 0 {
+		log.Printf("🗑️ Marked %d verification sessions as expired", expired)
 	}
 }
 
@@ -1321,7 +966,7 @@ func (h *VerificationHandler) GetVerificationURL(c *gin.Context) {
 		return
 	}
 
-	if session.Au10tixSession == nil || session.Au10tixSession.SessionURL == "" {
+	if session.ProviderSession == nil || session.ProviderSession.SessionURL == "" {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error":   "Verification URL not available",
@@ -1331,7 +976,7 @@ func (h *VerificationHandler) GetVerificationURL(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":    true,
-		"sessionUrl": session.Au10tixSession.SessionURL,
+		"sessionUrl": session.ProviderSession.SessionURL,
 		"sessionId":  sessionID,
 		"status":     session.Status,
 		"createdAt":  session.CreatedAt,
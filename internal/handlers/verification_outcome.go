@@ -0,0 +1,418 @@
+// File: internal/handlers/verification_outcome.go - Normalization of Au10tix verification results
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Overall verification decisions stored in VerificationSession.Result
+const (
+	DecisionVerified = "verified"
+	DecisionFailed   = "failed"
+	DecisionReview   = "review"
+)
+
+// Per-check result states
+const (
+	CheckPassed       = "passed"
+	CheckFailed       = "failed"
+	CheckInconclusive = "inconclusive"
+	CheckNotPerformed = "not_performed"
+)
+
+// Reason codes added by the portal itself
+const (
+	ReasonDocumentExpired = "DOCUMENT_EXPIRED"
+	ReasonNoCheckResults  = "NO_CHECK_RESULTS"
+)
+
+// au10tixStatusMap maps every status string Au10tix reports to a session status
+var au10tixStatusMap = map[string]string{
+	"completed":      "completed",
+	"complete":       "completed",
+	"done":           "completed",
+	"finished":       "completed",
+	"success":        "completed",
+	"verified":       "completed",
+	"passed":         "completed",
+	"approved":       "completed",
+	"accepted":       "completed",
+	"failed":         "completed",
+	"rejected":       "completed",
+	"denied":         "completed",
+	"declined":       "completed",
+	"review":         "completed",
+	"manual_review":  "completed",
+	"suspected":      "completed",
+	"in_progress":    "in_progress",
+	"processing":     "in_progress",
+	"pending":        "in_progress",
+	"started":        "in_progress",
+	"awaiting_input": "in_progress",
+	"expired":        "expired",
+	"timeout":        "expired",
+}
+
+// au10tixDecisionMap maps Au10tix status and result strings to an overall decision
+var au10tixDecisionMap = map[string]string{
+	"success":       DecisionVerified,
+	"verified":      DecisionVerified,
+	"passed":        DecisionVerified,
+	"approved":      DecisionVerified,
+	"accepted":      DecisionVerified,
+	"failed":        DecisionFailed,
+	"rejected":      DecisionFailed,
+	"denied":        DecisionFailed,
+	"declined":      DecisionFailed,
+	"review":        DecisionReview,
+	"manual_review": DecisionReview,
+	"suspected":     DecisionReview,
+}
+
+// au10tixCheckMap maps the values Au10tix uses for individual checks to a check state
+var au10tixCheckMap = map[string]string{
+	"true":          CheckPassed,
+	"passed":        CheckPassed,
+	"pass":          CheckPassed,
+	"ok":            CheckPassed,
+	"success":       CheckPassed,
+	"match":         CheckPassed,
+	"matched":       CheckPassed,
+	"genuine":       CheckPassed,
+	"authentic":     CheckPassed,
+	"live":          CheckPassed,
+	"valid":         CheckPassed,
+	"verified":      CheckPassed,
+	"false":         CheckFailed,
+	"failed":        CheckFailed,
+	"fail":          CheckFailed,
+	"mismatch":      CheckFailed,
+	"no_match":      CheckFailed,
+	"fraud":         CheckFailed,
+	"forged":        CheckFailed,
+	"not_live":      CheckFailed,
+	"spoof":         CheckFailed,
+	"invalid":       CheckFailed,
+	"rejected":      CheckFailed,
+	"inconclusive":  CheckInconclusive,
+	"suspected":     CheckInconclusive,
+	"review":        CheckInconclusive,
+	"manual_review": CheckInconclusive,
+}
+
+// au10tixResultRoots are the objects Au10tix nests detailed results under, depending on the endpoint
+var au10tixResultRoots = []string{"", "sessionResult", "result", "data", "data.sessionResult", "processingResult"}
+
+// normalizeKey lowercases a status string and unifies separators
+func normalizeKey(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(value)
+}
+
+// normalizeAu10tixStatus maps an Au10tix status string to a session status, or "" when unknown
+func normalizeAu10tixStatus(value string) string {
+	return au10tixStatusMap[normalizeKey(value)]
+}
+
+// normalizeAu10tixDecision maps an Au10tix status or result string to a decision, or "" when undecided
+func normalizeAu10tixDecision(value string) string {
+	return au10tixDecisionMap[normalizeKey(value)]
+}
+
+// lookupPath resolves a dotted path such as "identity.firstName" in a decoded JSON object
+func lookupPath(data map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok || current == nil {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// findValue returns the first of keys found under any of the known result roots
+func findValue(data map[string]interface{}, keys ...string) (interface{}, bool) {
+	for _, root := range au10tixResultRoots {
+		for _, key := range keys {
+			path := key
+			if root != "" {
+				path = root + "." + key
+			}
+			if value, ok := lookupPath(data, path); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// findString returns the first non-empty string value found for keys
+func findString(data map[string]interface{}, keys ...string) string {
+	for _, root := range au10tixResultRoots {
+		for _, key := range keys {
+			path := key
+			if root != "" {
+				path = root + "." + key
+			}
+			if value, ok := lookupPath(data, path); ok {
+				if text, ok := value.(string); ok && strings.TrimSpace(text) != "" {
+					return strings.TrimSpace(text)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// findNumber returns the first numeric value found for keys
+func findNumber(data map[string]interface{}, keys ...string) (float64, bool) {
+	value, ok := findValue(data, keys...)
+	if !ok {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		if number, err := strconv.ParseFloat(v, 64); err == nil {
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+// checkState converts a boolean, string or nested check object into a check state and its reason codes
+func checkState(value interface{}) (string, []string) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return CheckPassed, nil
+		}
+		return CheckFailed, nil
+	case string:
+		if state, ok := au10tixCheckMap[normalizeKey(v)]; ok {
+			return state, nil
+		}
+	case map[string]interface{}:
+		state := ""
+		for _, key := range []string{"passed", "isPassed", "result", "status", "decision", "value"} {
+			if nested, ok := v[key]; ok {
+				if state, _ = checkState(nested); state != "" {
+					break
+				}
+			}
+		}
+		return state, reasonCodes(v)
+	}
+	return "", nil
+}
+
+// reasonCodes extracts reason codes from a check object
+func reasonCodes(data map[string]interface{}) []string {
+	var codes []string
+	for _, key := range []string{"reasonCodes", "reasons", "reasonCode", "rejectionReasons", "errors"} {
+		switch v := data[key].(type) {
+		case string:
+			if v != "" {
+				codes = append(codes, v)
+			}
+		case []interface{}:
+			for _, item := range v {
+				switch code := item.(type) {
+				case string:
+					codes = append(codes, code)
+				case float64:
+					codes = append(codes, strconv.FormatFloat(code, 'f', -1, 64))
+				case map[string]interface{}:
+					if text, ok := code["code"].(string); ok {
+						codes = append(codes, text)
+					} else if number, ok := code["code"].(float64); ok {
+						codes = append(codes, strconv.FormatFloat(number, 'f', -1, 64))
+					}
+				}
+			}
+		}
+	}
+	return codes
+}
+
+// findCheck returns the state and reason codes of the first check found for keys
+func findCheck(data map[string]interface{}, keys ...string) (string, []string) {
+	for _, root := range au10tixResultRoots {
+		for _, key := range keys {
+			path := key
+			if root != "" {
+				path = root + "." + key
+			}
+			if value, ok := lookupPath(data, path); ok {
+				if state, codes := checkState(value); state != "" || len(codes) > 0 {
+					return state, codes
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// parseAu10tixResult parses a detailed Au10tix result, session or webhook payload.
+// Au10tix nests the same fields differently per endpoint, so each field is looked up
+// under the known result roots rather than decoded into a fixed structure.
+func parseAu10tixResult(raw map[string]interface{}) *Au10tixResultResponse {
+	response := &Au10tixResultResponse{
+		ID:     findString(raw, "id", "sessionId", "workflowId"),
+		Status: findString(raw, "status", "completionStatus"),
+		Data:   raw,
+	}
+
+	// The result field is either a decision string or a nested object
+	if result, ok := raw["result"].(string); ok {
+		response.Decision = result
+	}
+	if response.Decision == "" {
+		response.Decision = findString(raw, "decision", "verdict", "overallResult")
+	}
+
+	if score, ok := findNumber(raw, "score", "overallScore", "riskScore"); ok {
+		response.Score = score
+	}
+
+	result := Au10tixVerificationResult{
+		DocumentType:   findString(raw, "documentType", "document.type", "document.documentType", "idType"),
+		DocumentNumber: findString(raw, "identity.idNumber", "document.documentNumber", "documentNumber", "document.number"),
+		IssuingCountry: findString(raw, "document.issuingCountry", "issuingCountry", "document.country", "countryCode", "country"),
+		FirstName:      findString(raw, "identity.firstName", "document.firstName", "firstName", "extractedData.firstName"),
+		LastName:       findString(raw, "identity.lastName", "document.lastName", "lastName", "extractedData.lastName"),
+		DateOfBirth:    findString(raw, "identity.dateOfBirth", "document.dateOfBirth", "dateOfBirth", "extractedData.dateOfBirth"),
+		ExpiryDate:     findString(raw, "document.expiryDate", "document.dateOfExpiry", "expiryDate", "dateOfExpiry", "extractedData.expiryDate"),
+		Confidence:     findString(raw, "confidence", "confidenceLevel"),
+		ReasonCodes:    map[string][]string{},
+	}
+
+	var codes []string
+	result.DocumentAuthenticity, codes = findCheck(raw, "isDocumentAuthentic", "documentAuthenticity", "documentVerification", "checks.documentAuthenticity", "document.authenticity")
+	if len(codes) > 0 {
+		result.ReasonCodes["document_authenticity"] = codes
+	}
+	result.FaceMatch, codes = findCheck(raw, "isFaceMatch", "faceMatch", "faceComparison", "checks.faceMatch", "biometrics.faceMatch")
+	if len(codes) > 0 {
+		result.ReasonCodes["face_match"] = codes
+	}
+	result.Liveness, codes = findCheck(raw, "isLive", "liveness", "livenessCheck", "checks.liveness", "biometrics.liveness")
+	if len(codes) > 0 {
+		result.ReasonCodes["liveness"] = codes
+	}
+	if codes := reasonCodes(raw); len(codes) > 0 {
+		result.ReasonCodes["overall"] = codes
+	}
+	if len(result.ReasonCodes) == 0 {
+		result.ReasonCodes = nil
+	}
+
+	result.IsDocumentAuthentic = result.DocumentAuthenticity == CheckPassed
+	result.IsFaceMatch = result.FaceMatch == CheckPassed
+	result.IsLive = result.Liveness == CheckPassed
+
+	response.Result = result
+	response.IsDocumentAuthentic = result.IsDocumentAuthentic
+	response.IsFaceMatch = result.IsFaceMatch
+	return response
+}
+
+// newVerificationCheck builds a normalized check from a parsed check state
+func newVerificationCheck(state string, codes []string) VerificationCheck {
+	if state == "" {
+		state = CheckNotPerformed
+	}
+	return VerificationCheck{Status: state, ReasonCodes: codes}
+}
+
+// documentExpired reports whether a parsed expiry date lies in the past
+func documentExpired(expiryDate string, now time.Time) bool {
+	if len(expiryDate) < len("2006-01-02") {
+		return false
+	}
+	expiry, err := time.Parse("2006-01-02", expiryDate[:len("2006-01-02")])
+	if err != nil {
+		return false
+	}
+	return expiry.Add(24 * time.Hour).Before(now)
+}
+
+// Outcome normalizes the parsed result. An explicit Au10tix decision always wins; otherwise,
+// when final is set, the decision is derived from the individual checks and is "review" if
+// they are not conclusive. Non-final results without an explicit decision have no decision.
+func (r *Au10tixResultResponse) Outcome(final bool) *VerificationOutcome {
+	now := time.Now()
+	result := r.Result
+
+	outcome := &VerificationOutcome{
+		Score:                r.Score,
+		DocumentType:         result.DocumentType,
+		DocumentNumber:       result.DocumentNumber,
+		IssuingCountry:       result.IssuingCountry,
+		DocumentAuthenticity: newVerificationCheck(result.DocumentAuthenticity, result.ReasonCodes["document_authenticity"]),
+		FaceMatch:            newVerificationCheck(result.FaceMatch, result.ReasonCodes["face_match"]),
+		Liveness:             newVerificationCheck(result.Liveness, result.ReasonCodes["liveness"]),
+		FirstName:            result.FirstName,
+		LastName:             result.LastName,
+		DateOfBirth:          result.DateOfBirth,
+		ExpiryDate:           result.ExpiryDate,
+		ReasonCodes:          result.ReasonCodes["overall"],
+		Provider:             "au10tix",
+		EvaluatedAt:          now,
+	}
+
+	expired := documentExpired(result.ExpiryDate, now)
+	if expired {
+		outcome.ReasonCodes = append(outcome.ReasonCodes, ReasonDocumentExpired)
+	}
+
+	outcome.Decision = normalizeAu10tixDecision(r.Decision)
+	if outcome.Decision == "" {
+		outcome.Decision = normalizeAu10tixDecision(r.Status)
+	}
+	if outcome.Decision != "" || !final {
+		return outcome
+	}
+
+	// Derive the decision from the checks that were performed
+	performed, failed, inconclusive := 0, false, false
+	for _, check := range []VerificationCheck{outcome.DocumentAuthenticity, outcome.FaceMatch, outcome.Liveness} {
+		switch check.Status {
+		case CheckPassed:
+			performed++
+		case CheckFailed:
+			performed++
+			failed = true
+		case CheckInconclusive:
+			performed++
+			inconclusive = true
+		}
+	}
+
+	switch {
+	case failed || expired:
+		outcome.Decision = DecisionFailed
+	case inconclusive:
+		outcome.Decision = DecisionReview
+	case performed > 0:
+		outcome.Decision = DecisionVerified
+	default:
+		outcome.Decision = DecisionReview
+		outcome.ReasonCodes = append(outcome.ReasonCodes, ReasonNoCheckResults)
+	}
+	return outcome
+}
+
+// String summarizes the outcome for log output
+func (o *VerificationOutcome) String() string {
+	return fmt.Sprintf("decision=%s document=%s face=%s liveness=%s reasons=%v",
+		o.Decision, o.DocumentAuthenticity.Status, o.FaceMatch.Status, o.Liveness.Status, o.ReasonCodes)
+}
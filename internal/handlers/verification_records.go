@@ -0,0 +1,153 @@
+// File: internal/handlers/verification_records.go - Mapping between verification sessions and database records
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+
+	"self-service-portal/internal/models"
+)
+
+// Session statuses used by the handlers mapped to the persisted status constants
+var sessionStatusToModel = map[string]string{
+	"pending":     models.VerificationStatusPending,
+	"in_progress": models.VerificationStatusInProgress,
+	"completed":   models.VerificationStatusCompleted,
+	"failed":      models.VerificationStatusFailed,
+	"expired":     models.VerificationStatusExpired,
+	"rejected":    models.VerificationStatusRejected,
+}
+
+func modelStatusFromSession(status string) string {
+	if modelStatus, ok := sessionStatusToModel[status]; ok {
+		return modelStatus
+	}
+	return models.VerificationStatusPending
+}
+
+func sessionStatusFromModel(status string) string {
+	for sessionStatus, modelStatus := range sessionStatusToModel {
+		if modelStatus == status {
+			return sessionStatus
+		}
+	}
+	return "pending"
+}
+
+// toVerificationRecord converts a session into its database representation
+func toVerificationRecord(session *VerificationSession, userID *uint) *models.Verification {
+	record := &models.Verification{
+		UserID:    userID,
+		SessionID: session.ID,
+		Type:      models.VerificationTypeDocs,
+		Status:    modelStatusFromSession(session.Status),
+		Decision:  session.Result,
+		Score:     session.Score,
+		CreatedAt: session.CreatedAt,
+		UpdatedAt: session.UpdatedAt,
+	}
+
+	if session.ProviderSession != nil {
+		record.Provider = sessionProvider(session.ProviderSession)
+		record.ProviderSessionID = session.ProviderSession.SessionID
+		record.VerificationURL = session.ProviderSession.SessionURL
+		record.ProviderStatus = session.ProviderSession.Status
+	}
+
+	if requestData, err := json.Marshal(session.UserData); err == nil {
+		record.RequestData = string(requestData)
+	}
+
+	if session.Data != nil {
+		if result, err := json.Marshal(session.Data); err == nil {
+			record.Result = string(result)
+		}
+	}
+
+	if session.Outcome != nil {
+		if outcome, err := json.Marshal(session.Outcome); err == nil {
+			record.Outcome = string(outcome)
+		}
+	}
+
+	if session.IdentityMatch != nil {
+		if match, err := json.Marshal(session.IdentityMatch); err == nil {
+			record.IdentityMatch = string(match)
+		}
+	}
+
+	if session.Status == "completed" || session.Status == "failed" {
+		completedAt := session.UpdatedAt
+		record.CompletedAt = &completedAt
+	}
+
+	return record
+}
+
+// fromVerificationRecord rebuilds a session from its database representation
+func fromVerificationRecord(record *models.Verification) *VerificationSession {
+	session := &VerificationSession{
+		ID:        record.SessionID,
+		Status:    sessionStatusFromModel(record.Status),
+		Result:    record.Decision,
+		Score:     record.Score,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+
+	if record.RequestData != "" {
+		if err := json.Unmarshal([]byte(record.RequestData), &session.UserData); err != nil {
+			log.Printf("⚠️ Failed to decode request data for verification %s: %v", record.SessionID, err)
+		}
+	} else if record.User != nil {
+		session.UserData = VerificationStartRequest{
+			FirstName: record.User.FirstName,
+			LastName:  record.User.LastName,
+			Email:     record.User.Email,
+		}
+	}
+
+	if record.ProviderSessionID != "" || record.VerificationURL != "" {
+		provider := record.Provider
+		if provider == "" {
+			provider = ProviderAu10tix
+		}
+		status := record.ProviderStatus
+		if status == "" {
+			// Rows stored before the provider status was kept
+			status = "created"
+		}
+		session.ProviderSession = &ProviderSession{
+			Provider:   provider,
+			SessionID:  record.ProviderSessionID,
+			SessionURL: record.VerificationURL,
+			Status:     status,
+		}
+	}
+
+	if record.Result != "" {
+		if err := json.Unmarshal([]byte(record.Result), &session.Data); err != nil {
+			log.Printf("⚠️ Failed to decode result for verification %s: %v", record.SessionID, err)
+		}
+	}
+
+	if record.Outcome != "" {
+		var outcome VerificationOutcome
+		if err := json.Unmarshal([]byte(record.Outcome), &outcome); err != nil {
+			log.Printf("⚠️ Failed to decode outcome for verification %s: %v", record.SessionID, err)
+		} else {
+			session.Outcome = &outcome
+		}
+	}
+
+	if record.IdentityMatch != "" {
+		var match IdentityMatchResult
+		if err := json.Unmarshal([]byte(record.IdentityMatch), &match); err != nil {
+			log.Printf("⚠️ Failed to decode identity match for verification %s: %v", record.SessionID, err)
+		} else {
+			session.IdentityMatch = &match
+		}
+	}
+
+	return session
+}
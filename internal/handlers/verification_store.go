@@ -0,0 +1,402 @@
+// File: internal/handlers/verification_store.go - Storage backends for verification sessions
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"self-service-portal/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// ErrVerificationNotFound is returned when a verification session does not exist in the store
+var ErrVerificationNotFound = errors.New("verification session not found")
+
+// Verification store backends selectable through VERIFICATION_STORE
+const (
+	VerificationStoreMemory = "memory"
+	VerificationStoreSQL    = "sql"
+	VerificationStoreFile   = "file"
+)
+
+// VerificationFilter narrows the sessions returned by VerificationStore.List
+type VerificationFilter struct {
+	Statuses     []string  // Match any of these session statuses (all when empty)
+	Email        string    // Match the email the verification was started for
+	CreatedAfter time.Time // Only sessions created after this time (ignored when zero)
+	Limit        int       // Maximum number of sessions returned, newest first (unlimited when 0)
+}
+
+// VerificationStore persists verification sessions. Implementations must be safe for
+// concurrent use and must not share session pointers with callers.
+type VerificationStore interface {
+	Get(sessionID string) (*VerificationSession, error)
+	Put(session *VerificationSession) error
+	List(filter VerificationFilter) ([]*VerificationSession, error)
+	GetByProviderSession(provider, providerSessionID string) (*VerificationSession, error)
+	Expire(createdBefore time.Time) (int, error)
+}
+
+// NewVerificationStore creates the verification store backend selected by kind
+func NewVerificationStore(kind string, db *gorm.DB, filePath string) (VerificationStore, error) {
+	switch strings.ToLower(kind) {
+	case VerificationStoreMemory:
+		return NewMemoryVerificationStore(), nil
+	case VerificationStoreSQL, "":
+		if db == nil {
+			return nil, fmt.Errorf("sql verification store requires a database connection")
+		}
+		return NewSQLVerificationStore(db), nil
+	case VerificationStoreFile:
+		return NewFileVerificationStore(filePath)
+	default:
+		return nil, fmt.Errorf("unknown verification store: %s", kind)
+	}
+}
+
+// copyVerificationSession returns a copy that does not share mutable state with the original
+func copyVerificationSession(session *VerificationSession) *VerificationSession {
+	clone := *session
+	if session.ProviderSession != nil {
+		providerSession := *session.ProviderSession
+		clone.ProviderSession = &providerSession
+	}
+	if session.Data != nil {
+		clone.Data = copyJSONValue(session.Data).(map[string]interface{})
+	}
+	if session.Outcome != nil {
+		outcome := *session.Outcome
+		outcome.DocumentAuthenticity.ReasonCodes = slices.Clone(outcome.DocumentAuthenticity.ReasonCodes)
+		outcome.FaceMatch.ReasonCodes = slices.Clone(outcome.FaceMatch.ReasonCodes)
+		outcome.Liveness.ReasonCodes = slices.Clone(outcome.Liveness.ReasonCodes)
+		outcome.ReasonCodes = slices.Clone(outcome.ReasonCodes)
+		outcome.Review = copyIdentityReview(outcome.Review)
+		clone.Outcome = &outcome
+	}
+	if session.IdentityMatch != nil {
+		match := *session.IdentityMatch
+		match.Components = slices.Clone(match.Components)
+		match.Reasons = slices.Clone(match.Reasons)
+		match.Review = copyIdentityReview(match.Review)
+		clone.IdentityMatch = &match
+	}
+	return &clone
+}
+
+// copyIdentityReview returns a copy of the review, nil when there is none
+func copyIdentityReview(review *IdentityReview) *IdentityReview {
+	if review == nil {
+		return nil
+	}
+	clone := *review
+	return &clone
+}
+
+// copyJSONValue copies the maps and slices of a decoded JSON value so the copy can be changed
+// without touching the original
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = copyJSONValue(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = copyJSONValue(item)
+		}
+		return clone
+	default:
+		return value
+	}
+}
+
+// matches reports whether a session satisfies the filter
+func (f VerificationFilter) matches(session *VerificationSession) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			if session.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Email != "" && !strings.EqualFold(session.UserData.Email, f.Email) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !session.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	return true
+}
+
+// isUnfinished reports whether a session can still expire
+func isUnfinished(session *VerificationSession) bool {
+	return session.Status == "pending" || session.Status == "in_progress"
+}
+
+// MemoryVerificationStore keeps sessions in process memory
+type MemoryVerificationStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*VerificationSession
+}
+
+// NewMemoryVerificationStore creates an empty in-memory store
+func NewMemoryVerificationStore() *MemoryVerificationStore {
+	return &MemoryVerificationStore{
+		sessions: make(map[string]*VerificationSession),
+	}
+}
+
+func (s *MemoryVerificationStore) Get(sessionID string) (*VerificationSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return nil, ErrVerificationNotFound
+	}
+	return copyVerificationSession(session), nil
+}
+
+func (s *MemoryVerificationStore) Put(session *VerificationSession) error {
+	if session.ID == "" {
+		return fmt.Errorf("verification session ID is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = copyVerificationSession(session)
+	return nil
+}
+
+func (s *MemoryVerificationStore) List(filter VerificationFilter) ([]*VerificationSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]*VerificationSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		if filter.matches(session) {
+			sessions = append(sessions, copyVerificationSession(session))
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(sessions) > filter.Limit {
+		sessions = sessions[:filter.Limit]
+	}
+	return sessions, nil
+}
+
+func (s *MemoryVerificationStore) GetByProviderSession(provider, providerSessionID string) (*VerificationSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, session := range s.sessions {
+		if session.ProviderSession != nil && session.ProviderSession.SessionID == providerSessionID &&
+			sessionProvider(session.ProviderSession) == provider {
+			return copyVerificationSession(session), nil
+		}
+	}
+	return nil, ErrVerificationNotFound
+}
+
+func (s *MemoryVerificationStore) Expire(createdBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.expireLocked(createdBefore), nil
+}
+
+func (s *MemoryVerificationStore) expireLocked(createdBefore time.Time) int {
+	expired := 0
+	now := time.Now()
+	for _, session := range s.sessions {
+		if isUnfinished(session) && session.CreatedAt.Before(createdBefore) {
+			session.Status = "expired"
+			session.UpdatedAt = now
+			expired++
+		}
+	}
+	return expired
+}
+
+// FileVerificationStore keeps sessions in memory and writes them to a single JSON file
+// after every change. It is intended for small single-instance deployments.
+type FileVerificationStore struct {
+	*MemoryVerificationStore
+	path    string
+	writeMu sync.Mutex
+}
+
+// NewFileVerificationStore loads the store from path, creating the file on first write
+func NewFileVerificationStore(path string) (*FileVerificationStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file verification store requires a path")
+	}
+
+	store := &FileVerificationStore{
+		MemoryVerificationStore: NewMemoryVerificationStore(),
+		path:                    path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read verification store file: %w", err)
+	}
+	if len(data) > 0 {
+		var sessions []*VerificationSession
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, fmt.Errorf("failed to parse verification store file: %w", err)
+		}
+		for _, session := range sessions {
+			store.sessions[session.ID] = session
+		}
+		log.Printf("📥 Loaded %d verification sessions from %s", len(sessions), path)
+	}
+
+	return store, nil
+}
+
+func (s *FileVerificationStore) Put(session *VerificationSession) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.MemoryVerificationStore.Put(session); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *FileVerificationStore) Expire(createdBefore time.Time) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	expired := s.expireLocked(createdBefore)
+	s.mu.Unlock()
+
+	if expired == 0 {
+		return 0, nil
+	}
+	return expired, s.flush()
+}
+
+// flush writes all sessions to a temporary file and atomically replaces the store file
+func (s *FileVerificationStore) flush() error {
+	sessions, err := s.MemoryVerificationStore.List(VerificationFilter{})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal verification sessions: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create verification store directory: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write verification store file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace verification store file: %w", err)
+	}
+	return nil
+}
+
+// SQLVerificationStore persists sessions in the models.Verification table
+type SQLVerificationStore struct {
+	db *gorm.DB
+}
+
+// NewSQLVerificationStore creates a store backed by the given database
+func NewSQLVerificationStore(db *gorm.DB) *SQLVerificationStore {
+	return &SQLVerificationStore{db: db}
+}
+
+func (s *SQLVerificationStore) Get(sessionID string) (*VerificationSession, error) {
+	record, err := database.GetVerificationBySessionID(s.db, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVerificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromVerificationRecord(record), nil
+}
+
+// Put writes the session, linking it to the user by email. Sessions without an email, such as
+// simulated ones, are stored without a user.
+func (s *SQLVerificationStore) Put(session *VerificationSession) error {
+	var userID *uint
+	if email := session.UserData.Email; email != "" {
+		user, err := database.FindOrCreateUser(s.db, email, session.UserData.FirstName, session.UserData.LastName)
+		if err != nil {
+			return fmt.Errorf("failed to resolve user %s: %w", email, err)
+		}
+		userID = &user.ID
+	}
+
+	return database.SaveVerification(s.db, toVerificationRecord(session, userID))
+}
+
+func (s *SQLVerificationStore) List(filter VerificationFilter) ([]*VerificationSession, error) {
+	query := database.VerificationQuery{
+		Email:        filter.Email,
+		CreatedAfter: filter.CreatedAfter,
+		Limit:        filter.Limit,
+	}
+	for _, status := range filter.Statuses {
+		query.Statuses = append(query.Statuses, modelStatusFromSession(status))
+	}
+
+	records, err := database.ListVerifications(s.db, query)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*VerificationSession, 0, len(records))
+	for i := range records {
+		sessions = append(sessions, fromVerificationRecord(&records[i]))
+	}
+	return sessions, nil
+}
+
+func (s *SQLVerificationStore) GetByProviderSession(provider, providerSessionID string) (*VerificationSession, error) {
+	record, err := database.GetVerificationByProviderSession(s.db, provider, providerSessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVerificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromVerificationRecord(record), nil
+}
+
+func (s *SQLVerificationStore) Expire(createdBefore time.Time) (int, error) {
+	expired, err := database.ExpireVerificationsBefore(s.db, createdBefore)
+	return int(expired), err
+}
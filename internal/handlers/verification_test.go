@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"self-service-portal/internal/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// newVerificationTestRouter serves POST /start-verification with the mock provider and
+// enrollment flows, for callers with the given role
+func newVerificationTestRouter(t *testing.T, role string) (*gin.Engine, VerificationStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	configPath := filepath.Join(t.TempDir(), "portal-config.json")
+	if err := os.WriteFile(configPath, []byte(`{"api":{"verification_provider":"mock"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryVerificationStore()
+	handler := NewVerificationHandler(&ConfigHandler{configFilePath: configPath}, store)
+	handler.SetEnrollmentFlows(NewEnrollmentFlowManager(NewMemoryEnrollmentFlowStore(), store))
+
+	r := gin.New()
+	r.Use(sessions.Sessions("portal_session", cookie.NewStore([]byte("test-session-key-0123456789abcdef"))))
+	r.POST("/start-verification", func(c *gin.Context) {
+		c.Set("role", role)
+	}, handler.StartVerification)
+	return r, store
+}
+
+func TestStartVerificationWithoutFlow(t *testing.T) {
+	tests := []struct {
+		role string
+		want int
+	}{
+		{role: models.RoleAdmin, want: http.StatusOK},
+		{role: models.RoleHelpdesk, want: http.StatusOK},
+		{role: models.RoleSelfService, want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			r, store := newVerificationTestRouter(t, tt.role)
+
+			body := `{"firstName":"Jane","lastName":"Doe","email":"jane.doe@example.com","dateOfBirth":"1990-01-31"}`
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/start-verification", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				VerificationID string `json:"verificationId"`
+				Provider       string `json:"provider"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Provider != ProviderMock {
+				t.Errorf("provider = %q, want %q", response.Provider, ProviderMock)
+			}
+			session, err := store.Get(response.VerificationID)
+			if err != nil {
+				t.Fatalf("verification %s was not stored: %v", response.VerificationID, err)
+			}
+			if session.UserData.Email != "jane.doe@example.com" {
+				t.Errorf("stored email = %q", session.UserData.Email)
+			}
+		})
+	}
+}
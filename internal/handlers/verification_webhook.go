@@ -0,0 +1,135 @@
+// File: internal/handlers/verification_webhook.go - Identity verification provider result callbacks
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBodySize limits the size of accepted callback bodies
+const maxWebhookBodySize = 1 << 20
+
+// VerificationWebhook handles POST /api/webhooks/:provider result callbacks. Each provider
+// authenticates its own callbacks; sessions are looked up by the provider's session ID.
+func (h *VerificationHandler) VerificationWebhook(c *gin.Context) {
+	provider := c.Param("provider")
+	if !isVerificationProvider(provider) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Unknown verification provider",
+		})
+		return
+	}
+
+	config, err := h.configHandler.LoadConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load configuration",
+		})
+		return
+	}
+	verifier, err := h.identityVerifier(config, provider)
+	if err != nil {
+		respondVerifierUnavailable(c, err)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Failed to read request body",
+		})
+		return
+	}
+
+	event, err := verifier.ParseWebhook(c.Request, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWebhookNotConfigured):
+			log.Printf("❌ %s webhook rejected: no webhook secret configured", provider)
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   "Webhook receiver is not configured",
+			})
+		case errors.Is(err, ErrWebhookSignature):
+			log.Printf("🚫 %s webhook with invalid signature from IP: %s", provider, c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Invalid webhook signature",
+			})
+		case errors.Is(err, ErrWebhookTimestamp):
+			log.Printf("🚫 %s webhook with stale timestamp from IP: %s", provider, c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Webhook timestamp is too old or too far in the future",
+			})
+		case errors.Is(err, ErrWebhookNotSupported):
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Provider does not send webhooks",
+			})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	log.Printf("📬 %s webhook received for session: %s (status: %s)", provider, event.SessionID, event.Status)
+
+	session, sessionID, found := h.GetSessionByProviderSession(provider, event.SessionID)
+	if !found {
+		log.Printf("⚠️ %s webhook for unknown session: %s", provider, event.SessionID)
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Verification session not found",
+		})
+		return
+	}
+
+	// A finished verification keeps its result; late or replayed callbacks do not change it
+	if session.Finished() {
+		log.Printf("⏭️ Ignoring %s webhook for finished session %s (status: %s)", provider, sessionID, session.Status)
+		c.JSON(http.StatusOK, gin.H{
+			"success":        true,
+			"verificationId": sessionID,
+			"ignored":        true,
+		})
+		return
+	}
+
+	if event.Result == nil {
+		// Notification without result data - fetch the result from the provider
+		if err := h.PollForResults(sessionID); err != nil {
+			log.Printf("⚠️ Failed to fetch results after webhook for session %s: %v", sessionID, err)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"success": false,
+				"error":   "Failed to fetch verification result",
+			})
+			return
+		}
+	} else {
+		applyProviderResult(session, event.Result)
+		if err := h.saveSession(session); err != nil {
+			log.Printf("❌ Failed to persist webhook result for session %s: %v", sessionID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "Failed to store verification result",
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"verificationId": sessionID,
+	})
+}
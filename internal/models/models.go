@@ -4,7 +4,16 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // User represents a user in the system
@@ -16,21 +25,151 @@ type User struct {
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	LastLogin *time.Time `json:"last_login,omitempty"`
+	Role      string     `gorm:"not null;default:'self_service';index" json:"role"`
+
+	// Portal operator credentials; users without a password hash cannot log in to the portal
+	PasswordHash        string     `json:"-"`
+	PasswordChangedAt   *time.Time `json:"password_changed_at,omitempty"`
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+
+	// Single sign-on identity; set for operators provisioned from an OIDC or SAML login
+	IdentityProvider string `gorm:"index:idx_users_external_identity" json:"identity_provider,omitempty"`
+	ExternalID       string `gorm:"index:idx_users_external_identity" json:"-"`
+	SSOLinkAllowed   bool   `gorm:"not null;default:false" json:"sso_link_allowed"` // Set by an admin to let the next SSO login with this email claim the password account
 }
 
 // Verification represents an identity verification session
 type Verification struct {
-	ID              uint       `gorm:"primaryKey" json:"id"`
-	UserID          uint       `gorm:"not null" json:"user_id"`
-	SessionID       string     `gorm:"uniqueIndex;not null" json:"session_id"`
-	Type            string     `gorm:"not null" json:"type"`
-	Status          string     `gorm:"not null;default:'PENDING'" json:"status"`
-	VerificationURL string     `json:"verification_url,omitempty"`
-	Result          string     `gorm:"type:text" json:"result,omitempty"`
-	CreatedAt       time.Time  `json:"created_at"`
-	UpdatedAt       time.Time  `json:"updated_at"`
-	CompletedAt     *time.Time `json:"completed_at,omitempty"`
-	User            User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	UserID            *uint      `gorm:"index" json:"user_id,omitempty"` // Nil for sessions without an email, such as simulations
+	SessionID         string     `gorm:"uniqueIndex;not null" json:"session_id"`
+	Type              string     `gorm:"not null" json:"type"`
+	Status            string     `gorm:"not null;default:'PENDING'" json:"status"`
+	Decision          string     `json:"decision,omitempty"`
+	Score             float64    `json:"score,omitempty"`
+	Provider          string     `gorm:"index" json:"provider,omitempty"` // Identity verification provider; empty on older rows, which are Au10tix
+	ProviderSessionID string     `gorm:"column:au10tix_session_id;index" json:"provider_session_id,omitempty"`
+	ProviderStatus    string     `json:"provider_status,omitempty"` // Session status as the provider reported it
+	VerificationURL   string     `json:"verification_url,omitempty"`
+	RequestData       string     `gorm:"type:text" json:"request_data,omitempty"`
+	Result            string     `gorm:"type:text" json:"result,omitempty"`
+	Outcome           string     `gorm:"type:text" json:"outcome,omitempty"`
+	IdentityMatch     string     `gorm:"type:text" json:"identity_match,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	User              *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// EnrollmentFlow represents the server-side state of a self-service enrollment
+type EnrollmentFlow struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	FlowID         string    `gorm:"uniqueIndex;not null" json:"flow_id"`
+	State          string    `gorm:"not null;index" json:"state"`
+	SDOUserID      string    `gorm:"index" json:"sdo_user_id"`
+	Email          string    `gorm:"index" json:"email"`
+	Directory      string    `json:"directory,omitempty"`
+	Groups         string    `gorm:"type:text" json:"groups,omitempty"`
+	VerificationID string    `gorm:"index" json:"verification_id,omitempty"`
+	InvitationIDs  string    `gorm:"type:text" json:"invitation_ids,omitempty"`
+	History        string    `gorm:"type:text" json:"history,omitempty"`
+	FailureReason  string    `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SDOCredential is an SDO connection held on the server for a portal session or API token.
+// The bearer token is stored encrypted; service account credentials carry no token of their own.
+type SDOCredential struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	CredentialID   string     `gorm:"uniqueIndex;not null" json:"credential_id"`
+	BaseURL        string     `gorm:"not null" json:"base_url"`
+	Email          string     `gorm:"index" json:"email,omitempty"`
+	Token          string     `gorm:"type:text" json:"-"`
+	ServiceAccount bool       `json:"service_account"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIToken records a bearer token issued to a machine client. The token itself is never
+// stored; the record lets it be listed and revoked by its ID (jti claim).
+type APIToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TokenID   string     `gorm:"uniqueIndex;not null" json:"token_id"`
+	Name      string     `gorm:"not null" json:"name"`
+	Subject   string     `gorm:"not null;index" json:"subject"`
+	Scopes    string     `gorm:"not null" json:"scopes"`
+	KeyID     string     `gorm:"not null" json:"key_id"`
+	IssuedBy  string     `json:"issued_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+}
+
+// APISigningKey is a key pair that signs API tokens. The private key is stored encrypted.
+// Retired keys no longer sign but stay published until the tokens they signed have expired.
+type APISigningKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	KeyID      string     `gorm:"uniqueIndex;not null" json:"kid"`
+	Algorithm  string     `gorm:"not null" json:"alg"`
+	PrivateKey string     `gorm:"type:text;not null" json:"-"`
+	PublicKey  string     `gorm:"type:text;not null" json:"public_key"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+}
+
+// AuditEvent is one entry of the append-only audit log. Hash covers the entry's content and the
+// previous entry's hash, so changing or deleting an entry breaks the chain from that point on.
+type AuditEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	Sequence   uint64    `gorm:"uniqueIndex;not null" json:"sequence"`
+	OccurredAt time.Time `gorm:"index;not null" json:"occurred_at"`
+	Actor      string    `gorm:"index;not null" json:"actor"`
+	ActorRole  string    `json:"actor_role,omitempty"`
+	Action     string    `gorm:"index;not null" json:"action"`
+	Target     string    `gorm:"index" json:"target,omitempty"`
+	Outcome    string    `gorm:"index;not null" json:"outcome"`
+	IP         string    `json:"ip,omitempty"`
+	RequestID  string    `gorm:"index" json:"request_id,omitempty"`
+	Details    string    `gorm:"type:text" json:"details,omitempty"`
+	Before     string    `gorm:"type:text" json:"before,omitempty"`
+	After      string    `gorm:"type:text" json:"after,omitempty"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `gorm:"uniqueIndex;not null" json:"hash"`
+}
+
+// ErrAuditEventImmutable is returned when an audit event is updated or deleted through gorm
+var ErrAuditEventImmutable = errors.New("audit events cannot be modified")
+
+// ComputeHash returns the SHA-256 chain hash of the event. Fields are length-prefixed so that
+// moving text between fields changes the hash.
+func (e *AuditEvent) ComputeHash() string {
+	h := sha256.New()
+	for _, field := range []string{
+		strconv.FormatUint(e.Sequence, 10), e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		e.Actor, e.ActorRole, e.Action, e.Target, e.Outcome, e.IP, e.RequestID,
+		e.Details, e.Before, e.After, e.PrevHash,
+	} {
+		writeHashField(h, field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeHashField(h hash.Hash, field string) {
+	fmt.Fprintf(h, "%d:%s;", len(field), field)
+}
+
+// BeforeUpdate keeps audit events append-only
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// BeforeDelete keeps audit events append-only
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
 }
 
 // ConfigSetting represents configuration settings
@@ -44,6 +183,12 @@ type ConfigSetting struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// SchemaMigration records a one-time data migration that has been applied to the database
+type SchemaMigration struct {
+	Version   string    `gorm:"primaryKey" json:"version"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
 // Helper methods for User
 func (u *User) FullName() string {
 	return u.FirstName + " " + u.LastName
@@ -54,6 +199,91 @@ func (u *User) UpdateLastLogin() {
 	u.LastLogin = &now
 }
 
+// User role constants
+const (
+	RoleAdmin       = "admin"        // Manages configuration and portal accounts
+	RoleHelpdesk    = "helpdesk"     // Searches users, sends invitations and reviews identity matches
+	RoleAuditor     = "auditor"      // Read-only access to configuration and verifications
+	RoleSelfService = "self_service" // End users enrolling themselves through the self-service flow
+)
+
+// IsOperatorRole reports whether the role is given to portal staff rather than end users
+func IsOperatorRole(role string) bool {
+	return role == RoleAdmin || role == RoleHelpdesk || role == RoleAuditor
+}
+
+// PasswordHashCost is the bcrypt cost used for portal operator passwords
+const PasswordHashCost = 12
+
+// MinPasswordLength is the minimum length of a portal operator password
+const MinPasswordLength = 12
+
+// ValidatePassword checks a new portal operator password against the password policy
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > 72 {
+		return fmt.Errorf("password must be at most 72 characters")
+	}
+	return nil
+}
+
+// IsPortalOperator reports whether the user is portal staff, signing in with a password or SSO
+func (u *User) IsPortalOperator() bool {
+	return IsOperatorRole(u.Role)
+}
+
+// Identity providers for portal operators
+const (
+	IdentityProviderOIDC = "oidc"
+	IdentityProviderSAML = "saml"
+)
+
+// SetPassword stores a bcrypt hash of the password and clears any lockout
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordHashCost)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	u.PasswordHash = string(hash)
+	u.PasswordChangedAt = &now
+	u.FailedLoginAttempts = 0
+	u.LockedUntil = nil
+	return nil
+}
+
+// CheckPassword reports whether the password matches the stored hash
+func (u *User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// IsLocked reports whether the account is locked out at the given time
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// RegisterFailedLogin counts a failed login and locks the account once the limit is reached
+func (u *User) RegisterFailedLogin(maxAttempts int, lockout time.Duration) {
+	u.FailedLoginAttempts++
+	if u.FailedLoginAttempts >= maxAttempts {
+		until := time.Now().Add(lockout)
+		u.LockedUntil = &until
+		u.FailedLoginAttempts = 0
+	}
+}
+
+// RegisterSuccessfulLogin resets the failure counter and records the login time
+func (u *User) RegisterSuccessfulLogin() {
+	u.FailedLoginAttempts = 0
+	u.LockedUntil = nil
+	u.UpdateLastLogin()
+}
+
 // Verification status constants
 const (
 	VerificationStatusPending    = "PENDING"
@@ -0,0 +1,127 @@
+// File: internal/secrets/file.go - Secrets from portal-config.json, the file and mounted directory providers
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"self-service-portal/internal/config"
+)
+
+// FileProvider reads credentials from the auth section of the portal configuration file,
+// decrypting secrets that the configuration page stored encrypted
+type FileProvider struct {
+	path string
+}
+
+// NewFileProvider creates a provider for the given configuration file
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+// NewFileProviderFromEnv reads CONFIG_FILE_PATH, the same file the configuration page writes
+func NewFileProviderFromEnv() *FileProvider {
+	return NewFileProvider(getEnv("CONFIG_FILE_PATH", "portal-config.json"))
+}
+
+func (p *FileProvider) Name() string { return "file" }
+
+func (p *FileProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	portalConfig, err := config.LoadPortalConfigFile(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	switch name {
+	case SDOURL:
+		value = portalConfig.Auth.SDOURL
+	case SDOEmail:
+		value = portalConfig.Auth.SDOEmail
+	case SDOPassword:
+		value = portalConfig.Auth.SDOPassword
+	case Au10tixToken:
+		value = portalConfig.Auth.Au10tixToken
+	case Au10tixWebhookSecret:
+		value = portalConfig.Auth.Au10tixWebhookSecret
+	case Au10tixClientID:
+		value = portalConfig.Auth.Au10tixClientID
+	case Au10tixClientSecret:
+		value = portalConfig.Auth.Au10tixClientSecret
+	case Au10tixPrivateKey:
+		value = portalConfig.Auth.Au10tixPrivateKey
+	case OnfidoAPIToken:
+		value = portalConfig.Auth.OnfidoAPIToken
+	case OnfidoWebhookToken:
+		value = portalConfig.Auth.OnfidoWebhookToken
+	}
+	if value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// EnvProvider reads credentials from environment variables named after the secret in upper
+// case with an optional prefix, e.g. SDO_PASSWORD or PORTAL_SDO_PASSWORD
+type EnvProvider struct {
+	prefix string
+}
+
+// NewEnvProvider creates a provider for variables with the given prefix
+func NewEnvProvider(prefix string) *EnvProvider {
+	return &EnvProvider{prefix: prefix}
+}
+
+func (p *EnvProvider) Name() string { return "env" }
+
+func (p *EnvProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	value := os.Getenv(strings.ToUpper(p.prefix + name))
+	if value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// DefaultSecretsDir is where the dir provider looks when SECRETS_DIR is not set
+const DefaultSecretsDir = "/var/run/secrets/portal"
+
+// DirProvider reads one file per secret from a mounted directory, such as a Kubernetes
+// secret volume with keys sdo_email, sdo_password and au10tix_token. Files are read on
+// every refresh, so updated mounts are picked up once the cache expires.
+type DirProvider struct {
+	dir string
+}
+
+// NewDirProvider creates a provider for the given directory
+func NewDirProvider(dir string) *DirProvider {
+	return &DirProvider{dir: dir}
+}
+
+func (p *DirProvider) Name() string { return "dir" }
+
+func (p *DirProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
@@ -0,0 +1,204 @@
+// File: internal/secrets/provider.go - Pluggable sources for SDO and Au10tix credentials
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Secret names understood by every provider
+const (
+	SDOURL               = "sdo_url"
+	SDOEmail             = "sdo_email"
+	SDOPassword          = "sdo_password"
+	Au10tixToken         = "au10tix_token"
+	Au10tixWebhookSecret = "au10tix_webhook_secret"
+	Au10tixClientID      = "au10tix_client_id"
+	Au10tixClientSecret  = "au10tix_client_secret"
+	Au10tixPrivateKey    = "au10tix_private_key"
+	OnfidoAPIToken       = "onfido_api_token"
+	OnfidoWebhookToken   = "onfido_webhook_token"
+)
+
+// ErrNotFound is returned by a provider that has no value for a secret
+var ErrNotFound = errors.New("secret not found")
+
+// DefaultCacheTTL is how long resolved secrets are reused before the providers are asked again
+const DefaultCacheTTL = 5 * time.Minute
+
+// Provider is a source of credentials. GetSecret returns ErrNotFound when the provider
+// has no value so the next provider in the store is consulted.
+type Provider interface {
+	Name() string
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// cacheEntry is a resolved secret and where it came from
+type cacheEntry struct {
+	value     string
+	source    string
+	err       error
+	fetchedAt time.Time
+}
+
+// Store resolves secrets from an ordered list of providers and caches the results for a TTL.
+// Expired entries are refreshed on the next lookup; if every provider fails with an error
+// other than ErrNotFound the previous value keeps being served.
+type Store struct {
+	providers []Provider
+	ttl       time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewStore creates a store that consults the providers in order
+func NewStore(ttl time.Duration, providers ...Provider) *Store {
+	return &Store{
+		providers: providers,
+		ttl:       ttl,
+		entries:   make(map[string]cacheEntry),
+	}
+}
+
+// Providers lists the names of the configured providers in lookup order
+func (s *Store) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for _, provider := range s.providers {
+		names = append(names, provider.Name())
+	}
+	return names
+}
+
+// Get returns the value of a secret
+func (s *Store) Get(ctx context.Context, name string) (string, error) {
+	value, _, err := s.Lookup(ctx, name)
+	return value, err
+}
+
+// Lookup returns the value of a secret and the name of the provider that supplied it
+func (s *Store) Lookup(ctx context.Context, name string) (string, string, error) {
+	s.mu.Lock()
+	cached, ok := s.entries[name]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < s.ttl {
+		return cached.value, cached.source, cached.err
+	}
+
+	entry := s.resolve(ctx, name)
+	if entry.err != nil && !errors.Is(entry.err, ErrNotFound) && ok && cached.err == nil {
+		log.Printf("⚠️ Failed to refresh secret %s, serving cached value from %s: %v", name, cached.source, entry.err)
+		entry = cached
+		entry.fetchedAt = time.Now()
+	}
+
+	s.mu.Lock()
+	s.entries[name] = entry
+	s.mu.Unlock()
+	return entry.value, entry.source, entry.err
+}
+
+// resolve asks each provider in turn
+func (s *Store) resolve(ctx context.Context, name string) cacheEntry {
+	var failures []string
+	for _, provider := range s.providers {
+		value, err := provider.GetSecret(ctx, name)
+		if err == nil && value != "" {
+			return cacheEntry{value: value, source: provider.Name(), fetchedAt: time.Now()}
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("⚠️ Secret provider %s failed for %s: %v", provider.Name(), name, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+		}
+	}
+
+	entry := cacheEntry{err: ErrNotFound, fetchedAt: time.Now()}
+	if len(failures) > 0 {
+		entry.err = fmt.Errorf("secret %s unavailable (%s)", name, strings.Join(failures, "; "))
+	}
+	return entry
+}
+
+// Invalidate drops cached secrets so the next lookup reads the providers again,
+// for example after the configuration file was saved
+func (s *Store) Invalidate() {
+	s.mu.Lock()
+	s.entries = make(map[string]cacheEntry)
+	s.mu.Unlock()
+}
+
+var (
+	defaultStoreOnce sync.Once
+	defaultStore     *Store
+)
+
+// Default returns the process-wide store configured from the environment:
+//
+//	SECRET_PROVIDERS   comma separated lookup order of file, env, dir and vault (default file)
+//	SECRETS_CACHE_TTL  cache lifetime such as 5m (default 5m)
+//
+// See the individual providers for their settings.
+func Default() *Store {
+	defaultStoreOnce.Do(func() {
+		ttl := DefaultCacheTTL
+		if value := os.Getenv("SECRETS_CACHE_TTL"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				log.Printf("⚠️ Invalid SECRETS_CACHE_TTL %q, using %s", value, DefaultCacheTTL)
+			} else {
+				ttl = parsed
+			}
+		}
+
+		var providers []Provider
+		for _, name := range strings.Split(getEnv("SECRET_PROVIDERS", "file"), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			provider, err := providerFromEnv(name)
+			if err != nil {
+				log.Printf("⚠️ Secret provider %s disabled: %v", name, err)
+				continue
+			}
+			providers = append(providers, provider)
+		}
+		if len(providers) == 0 {
+			log.Printf("⚠️ No usable secret providers configured, reading credentials from the config file")
+			providers = append(providers, NewFileProviderFromEnv())
+		}
+
+		defaultStore = NewStore(ttl, providers...)
+		log.Printf("🔑 Secret providers: %s (cache %s)", strings.Join(defaultStore.Providers(), ", "), ttl)
+	})
+	return defaultStore
+}
+
+// providerFromEnv builds a provider by name from its environment settings
+func providerFromEnv(name string) (Provider, error) {
+	switch name {
+	case "file":
+		return NewFileProviderFromEnv(), nil
+	case "env":
+		return NewEnvProvider(os.Getenv("SECRETS_ENV_PREFIX")), nil
+	case "dir":
+		return NewDirProvider(getEnv("SECRETS_DIR", DefaultSecretsDir)), nil
+	case "vault":
+		return NewVaultProviderFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown secret provider %q", name)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,165 @@
+// File: internal/secrets/vault.go - Secrets from a Vault-compatible HTTP key/value engine
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VaultConfig configures the Vault KV provider
+type VaultConfig struct {
+	Address   string // e.g. https://vault.example.com:8200
+	Token     string
+	TokenFile string // read on every request so tokens renewed by an agent are picked up
+	Namespace string
+	Mount     string // KV engine mount, default secret
+	Path      string // secret path within the mount, default self-service-portal
+	KVVersion int    // 1 or 2, default 2
+	Timeout   time.Duration
+}
+
+// VaultProvider reads credentials from the keys of one secret in a Vault KV engine
+type VaultProvider struct {
+	config VaultConfig
+	client *http.Client
+}
+
+// NewVaultProvider creates a provider for the configured KV secret
+func NewVaultProvider(cfg VaultConfig) (*VaultProvider, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if cfg.Token == "" && cfg.TokenFile == "" {
+		return nil, errors.New("vault token or token file is required")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	if cfg.Path == "" {
+		cfg.Path = "self-service-portal"
+	}
+	if cfg.KVVersion == 0 {
+		cfg.KVVersion = 2
+	}
+	if cfg.KVVersion != 1 && cfg.KVVersion != 2 {
+		return nil, fmt.Errorf("unsupported KV version %d", cfg.KVVersion)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+
+	return &VaultProvider{config: cfg, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// NewVaultProviderFromEnv reads VAULT_ADDR, VAULT_TOKEN or VAULT_TOKEN_FILE, VAULT_NAMESPACE,
+// VAULT_KV_MOUNT, VAULT_KV_PATH and VAULT_KV_VERSION
+func NewVaultProviderFromEnv() (*VaultProvider, error) {
+	cfg := VaultConfig{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		TokenFile: os.Getenv("VAULT_TOKEN_FILE"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Mount:     os.Getenv("VAULT_KV_MOUNT"),
+		Path:      os.Getenv("VAULT_KV_PATH"),
+	}
+	if version := os.Getenv("VAULT_KV_VERSION"); version != "" {
+		parsed, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VAULT_KV_VERSION %q", version)
+		}
+		cfg.KVVersion = parsed
+	}
+	return NewVaultProvider(cfg)
+}
+
+func (p *VaultProvider) Name() string { return "vault" }
+
+func (p *VaultProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	data, err := p.readSecret(ctx)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[name].(string)
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// readSecret fetches all keys of the configured secret
+func (p *VaultProvider) readSecret(ctx context.Context) (map[string]interface{}, error) {
+	token, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+
+	secretURL := p.config.Address + "/v1/" + url.PathEscape(p.config.Mount) + "/"
+	if p.config.KVVersion == 2 {
+		secretURL += "data/"
+	}
+	secretURL += strings.TrimLeft(p.config.Path, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.config.Namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d for %s/%s", resp.StatusCode, p.config.Mount, p.config.Path)
+	}
+
+	var envelope struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse vault response: %w", err)
+	}
+	if p.config.KVVersion == 1 {
+		return envelope.Data, nil
+	}
+
+	// KV version 2 nests the key/value pairs under data.data
+	data, _ := envelope.Data["data"].(map[string]interface{})
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (p *VaultProvider) token() (string, error) {
+	if p.config.TokenFile == "" {
+		return p.config.Token, nil
+	}
+	data, err := os.ReadFile(p.config.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
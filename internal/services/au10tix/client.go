@@ -0,0 +1,388 @@
+// File: internal/services/au10tix/client.go
+// Au10tix API client shared by the verification handlers
+
+package au10tix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StagingBaseURL is the Au10tix staging API, the default for sandbox mode
+const StagingBaseURL = "https://eus-api.au10tixservicesstaging.com"
+
+// DefaultWorkflow is the workflow used for person verification
+const DefaultWorkflow = "Au10tix201"
+
+// ErrResultNotReady is returned by GetResult while Au10tix is still processing the session
+var ErrResultNotReady = errors.New("verification result not ready")
+
+// API is the part of the Au10tix API the portal uses. Client talks to Au10tix; DemoClient
+// answers locally with scripted results.
+type API interface {
+	CreateWorkflow(ctx context.Context, workflow string, request *WorkflowRequest) (*WorkflowResponse, error)
+	GetResult(ctx context.Context, sessionID string) (*Result, error)
+	GetSession(ctx context.Context, sessionID string) (*Session, error)
+}
+
+// TokenSource supplies bearer tokens that can be renewed, such as TokenManager
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+	Refresh(ctx context.Context, rejected string) (string, error)
+}
+
+// Client talks to the Au10tix workflow and result APIs
+type Client struct {
+	BaseURL    string
+	Token      string
+	Tokens     TokenSource // Replaces Token when set; a rejected token is renewed once per request
+	Client     *http.Client
+	MaxRetries int           // Retries after the first attempt for 429, and for 5xx and network errors on GETs
+	MinBackoff time.Duration // Base delay for exponential backoff
+	MaxBackoff time.Duration // Upper bound for a single backoff delay
+}
+
+// APIError describes a non-successful Au10tix response
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Au10tix API error (status: %d): %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed when repeated
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// WorkflowRequest is the body of a workflow creation request
+type WorkflowRequest struct {
+	WorkflowOptions map[string]interface{} `json:"workflowOptions"`
+	ServiceOptions  ServiceOptions         `json:"serviceOptions"`
+	UserData        map[string]string      `json:"userData,omitempty"`
+}
+
+// ServiceOptions holds per-service workflow options
+type ServiceOptions struct {
+	Secureme SecuremeOptions `json:"secureme"`
+}
+
+// SecuremeOptions configures the Secure.me capture experience
+type SecuremeOptions struct {
+	ShortURL     bool                `json:"shortUrl"`
+	RequestTypes map[string][]string `json:"requestTypes"`         // Check -> capture sources (file, camera)
+	SuccessURL   string              `json:"successUrl,omitempty"` // Page the user returns to after capture
+	FailureURL   string              `json:"failureUrl,omitempty"` // Page the user returns to when capture fails
+}
+
+// WorkflowResponse is the response of a workflow creation request
+type WorkflowResponse struct {
+	SessionID    string `json:"sessionId"`
+	ID           string `json:"id,omitempty"`
+	WorkflowID   string `json:"workflowId,omitempty"`
+	SecuremeLink string `json:"securemeLink,omitempty"`
+	WorkflowURL  string `json:"workflowUrl,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Link         string `json:"link,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Response     struct {
+		SecuremeLink string `json:"securemeLink"`
+	} `json:"response"`
+}
+
+// SessionURL returns the capture URL the end user should open
+func (r *WorkflowResponse) SessionURL() string {
+	for _, link := range []string{r.Response.SecuremeLink, r.SecuremeLink, r.WorkflowURL, r.URL, r.Link} {
+		if link != "" {
+			return link
+		}
+	}
+	return ""
+}
+
+// Identifier returns the Au10tix session ID of the created workflow
+func (r *WorkflowResponse) Identifier() string {
+	for _, id := range []string{r.SessionID, r.ID, r.WorkflowID} {
+		if id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// Result is a verification result as returned by the result API
+type Result struct {
+	ID     string                 `json:"id"`
+	Status string                 `json:"status"`
+	Score  float64                `json:"score"`
+	Raw    map[string]interface{} `json:"-"`
+}
+
+// Session is the processing state of an Au10tix session
+type Session struct {
+	ID     string                 `json:"id"`
+	Status string                 `json:"status"`
+	Raw    map[string]interface{} `json:"-"`
+}
+
+// NewClient creates a client for the given API base URL and bearer token. Certificates are
+// verified against the system roots; replace Client to trust a custom CA bundle.
+func NewClient(baseURL, token string, timeout time.Duration, retries int) *Client {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	if retries < 0 {
+		retries = 0
+	}
+
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		Client:     &http.Client{Timeout: timeout},
+		MaxRetries: retries,
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+}
+
+// CreateWorkflow starts a person verification workflow and returns the capture session
+func (c *Client) CreateWorkflow(ctx context.Context, workflow string, request *WorkflowRequest) (*WorkflowResponse, error) {
+	if workflow == "" {
+		workflow = DefaultWorkflow
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal workflow request: %w", err)
+	}
+
+	log.Printf("Au10tix Client: Creating workflow %s", workflow)
+	respBody, err := c.do(ctx, http.MethodPost, "/workflow/v1/workflows/person/"+url.PathEscape(workflow), nil, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var workflowResp WorkflowResponse
+	if err := json.Unmarshal(respBody, &workflowResp); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow response: %w", err)
+	}
+
+	if workflowResp.SessionURL() == "" {
+		return nil, fmt.Errorf("no verification URL found in Au10tix response")
+	}
+
+	log.Printf("Au10tix Client: Workflow created, session ID: %s", workflowResp.Identifier())
+	return &workflowResp, nil
+}
+
+// GetResult fetches the detailed verification result for a session.
+// It returns ErrResultNotReady while the result does not exist yet.
+func (c *Client) GetResult(ctx context.Context, sessionID string) (*Result, error) {
+	query := url.Values{}
+	query.Set("includeDetailed", "true")
+
+	respBody, err := c.do(ctx, http.MethodGet, "/result/v2/results/person/"+url.PathEscape(sessionID), query, nil)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, ErrResultNotReady
+		}
+		return nil, err
+	}
+
+	var result Result
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse result: %w", err)
+	}
+	if err := json.Unmarshal(respBody, &result.Raw); err != nil {
+		return nil, fmt.Errorf("failed to parse result: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GetSession fetches the processing state of a session
+func (c *Client) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	respBody, err := c.do(ctx, http.MethodGet, "/workflow/v1/sessions/"+url.PathEscape(sessionID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(respBody, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	}
+	if err := json.Unmarshal(respBody, &session.Raw); err != nil {
+		return nil, fmt.Errorf("failed to parse session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// do performs a request, retrying with exponential backoff and jitter. GETs are retried after
+// 5xx, 429 and network errors. Other requests may have been processed before such a failure,
+// so creating a workflow twice cannot use up a second credit; they are only retried after 429.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte) ([]byte, error) {
+	if c.Token == "" && c.Tokens == nil {
+		return nil, fmt.Errorf("Au10tix token is not configured")
+	}
+	if c.BaseURL == "" {
+		return nil, fmt.Errorf("Au10tix API URL is not configured")
+	}
+
+	requestURL := c.BaseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.backoff(attempt, lastErr)
+			log.Printf("Au10tix Client: Retrying %s %s in %v (attempt %d/%d): %v", method, path, delay, attempt, c.MaxRetries, lastErr)
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		respBody, err := c.doAuthorized(ctx, method, requestURL, body)
+		if err == nil {
+			return respBody, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && !apiErr.Retryable() {
+			return nil, err
+		}
+		if method != http.MethodGet && (apiErr == nil || apiErr.StatusCode != http.StatusTooManyRequests) {
+			return nil, err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// retryAfterError carries the Retry-After hint of a 429 response
+type retryAfterError struct {
+	*APIError
+	retryAfter time.Duration
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.APIError
+}
+
+// doAuthorized sends a request with the current token. A token from Tokens that Au10tix
+// rejects with 401 is renewed and the request repeated once.
+func (c *Client) doAuthorized(ctx context.Context, method, requestURL string, body []byte) ([]byte, error) {
+	if c.Tokens == nil {
+		return c.doOnce(ctx, method, requestURL, body, c.Token)
+	}
+
+	token, err := c.Tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain Au10tix access token: %w", err)
+	}
+	respBody, err := c.doOnce(ctx, method, requestURL, body, token)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		return respBody, err
+	}
+	fresh, refreshErr := c.Tokens.Refresh(ctx, token)
+	if refreshErr != nil {
+		log.Printf("❌ Au10tix token refresh failed, returning original 401: %v", refreshErr)
+		return nil, err
+	}
+	return c.doOnce(ctx, method, requestURL, body, fresh)
+}
+
+func (c *Client) doOnce(ctx context.Context, method, requestURL string, body []byte, token string) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("User-Agent", "SelfServicePortal/1.0")
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	log.Printf("Au10tix Client: %s %s -> %d", method, req.URL.Path, resp.StatusCode)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			return nil, &retryAfterError{APIError: apiErr, retryAfter: time.Duration(seconds) * time.Second}
+		}
+		return nil, apiErr
+	}
+
+	return respBody, nil
+}
+
+// backoff returns the delay before the given retry attempt using full jitter, never more than
+// MaxBackoff
+func (c *Client) backoff(attempt int, lastErr error) time.Duration {
+	var hinted *retryAfterError
+	if errors.As(lastErr, &hinted) && hinted.retryAfter > 0 {
+		if hinted.retryAfter > c.MaxBackoff {
+			return c.MaxBackoff
+		}
+		return hinted.retryAfter
+	}
+
+	ceiling := c.MinBackoff << uint(attempt-1)
+	if ceiling <= 0 || ceiling > c.MaxBackoff {
+		ceiling = c.MaxBackoff
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling))) + c.MinBackoff/2
+	if delay > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+	return delay
+}
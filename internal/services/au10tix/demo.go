@@ -0,0 +1,259 @@
+// File: internal/services/au10tix/demo.go
+// Built-in stand-in for the Au10tix API used in demo mode
+
+package au10tix
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DemoProvider is the provider reported for outcomes produced by DemoClient
+const DemoProvider = "au10tix-demo"
+
+// Demo scenarios. The scenario of a session is picked by the first keyword found in the
+// user's email address, last name or first name, so "jane+review@example.com" or a test user
+// named "Review Tester" ends in manual review.
+const (
+	DemoScenarioVerified = "verified"
+	DemoScenarioFailed   = "failed"
+	DemoScenarioReview   = "review"
+	DemoScenarioExpired  = "expired"
+	DemoScenarioMismatch = "mismatch"
+)
+
+// demoKeywords maps the keywords that select a scenario, in the order they are checked
+var demoKeywords = []struct {
+	keyword  string
+	scenario string
+}{
+	{"fail", DemoScenarioFailed},
+	{"review", DemoScenarioReview},
+	{"expired", DemoScenarioExpired},
+	{"mismatch", DemoScenarioMismatch},
+}
+
+// demoSession is a workflow created by DemoClient
+type demoSession struct {
+	id       string
+	scenario string
+	userData map[string]string
+	created  time.Time
+	readyAt  time.Time // When the result becomes available; moved forward by Submit
+}
+
+// DemoClient answers workflow, session and result requests locally with scripted results. It
+// never contacts Au10tix and needs no token. Sessions live in memory only.
+type DemoClient struct {
+	captureURL     string
+	processingTime time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*demoSession
+}
+
+// NewDemoClient creates a demo provider. Capture links point to captureURL followed by the
+// session ID; results become available processingTime after a session is created.
+func NewDemoClient(captureURL string, processingTime time.Duration) *DemoClient {
+	return &DemoClient{
+		captureURL:     strings.TrimSuffix(captureURL, "/"),
+		processingTime: processingTime,
+		sessions:       make(map[string]*demoSession),
+	}
+}
+
+// DemoScenario returns the scenario the demo provider plays for the given user data
+func DemoScenario(userData map[string]string) string {
+	haystack := strings.ToLower(userData["email"] + " " + userData["lastName"] + " " + userData["firstName"])
+	for _, candidate := range demoKeywords {
+		if strings.Contains(haystack, candidate.keyword) {
+			return candidate.scenario
+		}
+	}
+	return DemoScenarioVerified
+}
+
+// CreateWorkflow records a demo session and returns a link to the portal's demo capture page
+func (d *DemoClient) CreateWorkflow(ctx context.Context, workflow string, request *WorkflowRequest) (*WorkflowResponse, error) {
+	suffix := make([]byte, 12)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate demo session ID: %w", err)
+	}
+
+	now := time.Now()
+	session := &demoSession{
+		id:       "demo-" + hex.EncodeToString(suffix),
+		scenario: DemoScenario(request.UserData),
+		userData: request.UserData,
+		created:  now,
+		readyAt:  now.Add(d.processingTime),
+	}
+
+	d.mu.Lock()
+	d.sessions[session.id] = session
+	d.mu.Unlock()
+
+	log.Printf("Au10tix Demo: Created session %s (scenario: %s)", session.id, session.scenario)
+
+	response := &WorkflowResponse{SessionID: session.id, Status: "created"}
+	response.Response.SecuremeLink = d.captureURL + "/" + session.id
+	return response, nil
+}
+
+// GetSession reports the session as processing until its result is ready
+func (d *DemoClient) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	session, ok := d.lookup(sessionID)
+	if !ok {
+		return nil, &APIError{StatusCode: http.StatusNotFound, Body: "demo session not found"}
+	}
+
+	status := "processing"
+	if d.ready(session) {
+		status = "completed"
+	}
+	return &Session{
+		ID:     session.id,
+		Status: status,
+		Raw:    map[string]interface{}{"id": session.id, "status": status, "demo": true},
+	}, nil
+}
+
+// GetResult returns the scripted result once the processing time has passed
+func (d *DemoClient) GetResult(ctx context.Context, sessionID string) (*Result, error) {
+	session, ok := d.lookup(sessionID)
+	if !ok || !d.ready(session) {
+		return nil, ErrResultNotReady
+	}
+
+	// Decode the result like a response body so it has the same shape as a real one
+	body, err := json.Marshal(demoResult(session, time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build demo result: %w", err)
+	}
+	var result Result
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse demo result: %w", err)
+	}
+	if err := json.Unmarshal(body, &result.Raw); err != nil {
+		return nil, fmt.Errorf("failed to parse demo result: %w", err)
+	}
+	return &result, nil
+}
+
+// Scenario returns the scenario of a demo session, or "" for unknown sessions
+func (d *DemoClient) Scenario(sessionID string) string {
+	if session, ok := d.lookup(sessionID); ok {
+		return session.scenario
+	}
+	return ""
+}
+
+// Submit makes the result of a session available now, as if the capture had been completed and
+// processed. It reports whether the session exists.
+func (d *DemoClient) Submit(sessionID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	session, ok := d.sessions[sessionID]
+	if ok && time.Now().Before(session.readyAt) {
+		session.readyAt = time.Now()
+	}
+	return ok
+}
+
+// Submitted reports whether the result of a session is available
+func (d *DemoClient) Submitted(sessionID string) bool {
+	session, ok := d.lookup(sessionID)
+	return ok && d.ready(session)
+}
+
+// ProcessingTime is how long after creation a demo result becomes available
+func (d *DemoClient) ProcessingTime() time.Duration {
+	return d.processingTime
+}
+
+func (d *DemoClient) lookup(sessionID string) (*demoSession, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	session, ok := d.sessions[sessionID]
+	return session, ok
+}
+
+func (d *DemoClient) ready(session *demoSession) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !time.Now().Before(session.readyAt)
+}
+
+// demoResult builds a detailed result in the shape of the Au10tix result API
+func demoResult(session *demoSession, now time.Time) map[string]interface{} {
+	firstName, lastName := session.userData["firstName"], session.userData["lastName"]
+	if firstName == "" {
+		firstName = "Jordan"
+	}
+	if lastName == "" {
+		lastName = "Sample"
+	}
+	dateOfBirth := session.userData["dateOfBirth"]
+	if dateOfBirth == "" {
+		dateOfBirth = "1990-01-01"
+	}
+
+	passed := map[string]interface{}{"status": "passed"}
+	documentAuthenticity, faceMatch, liveness := passed, passed, passed
+	expiryDate := now.AddDate(5, 0, 0).Format("2006-01-02")
+	result, score := "approved", 0.97
+	var reasons []string
+
+	switch session.scenario {
+	case DemoScenarioFailed:
+		documentAuthenticity = map[string]interface{}{"status": "failed", "reasonCodes": []string{"DOCUMENT_TAMPERED"}}
+		result, score = "rejected", 0.21
+		reasons = []string{"DOCUMENT_TAMPERED"}
+	case DemoScenarioReview:
+		faceMatch = map[string]interface{}{"status": "inconclusive", "reasonCodes": []string{"FACE_LOW_QUALITY"}}
+		result, score = "review", 0.62
+		reasons = []string{"FACE_LOW_QUALITY"}
+	case DemoScenarioExpired:
+		expiryDate = now.AddDate(-2, 0, 0).Format("2006-01-02")
+		result, score = "rejected", 0.88
+	case DemoScenarioMismatch:
+		// A genuine document that belongs to someone else
+		firstName, lastName, dateOfBirth = "Alex", "Different", "1975-06-15"
+	}
+
+	raw := map[string]interface{}{
+		"id":           session.id,
+		"status":       "completed",
+		"result":       result,
+		"score":        score,
+		"demo":         true,
+		"scenario":     session.scenario,
+		"documentType": "PASSPORT",
+		"identity": map[string]interface{}{
+			"firstName":   firstName,
+			"lastName":    lastName,
+			"dateOfBirth": dateOfBirth,
+			"idNumber":    "D" + strings.ToUpper(session.id[len(session.id)-8:]),
+		},
+		"document": map[string]interface{}{
+			"issuingCountry": "USA",
+			"expiryDate":     expiryDate,
+		},
+		"documentAuthenticity": documentAuthenticity,
+		"faceMatch":            faceMatch,
+		"liveness":             liveness,
+	}
+	if len(reasons) > 0 {
+		raw["reasonCodes"] = reasons
+	}
+	return raw
+}
@@ -0,0 +1,220 @@
+// File: internal/services/au10tix/keys.go
+// Signature verification of Au10tix access tokens against the issuer's JSON Web Key Set
+
+package au10tix
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// DefaultKeySetTTL is how long fetched keys are used before the issuer is asked again
+const DefaultKeySetTTL = time.Hour
+
+// keySetRefetchInterval limits fetches triggered by tokens signed with an unknown key
+const keySetRefetchInterval = time.Minute
+
+// Errors returned by KeySet.Verify
+var (
+	ErrUntrustedIssuer   = errors.New("token issuer is not trusted")
+	ErrUnknownSigningKey = errors.New("token is signed with an unknown key")
+	ErrInvalidSignature  = errors.New("token signature is invalid")
+)
+
+// tokenAlgorithms are the signature algorithms accepted for Au10tix tokens
+var tokenAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+}
+
+// keySetEntry is the cached key set of one issuer or file
+type keySetEntry struct {
+	keys      jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+// KeySet verifies token signatures with the keys published by the token's issuer. Key sets
+// are cached per issuer for the TTL and fetched again early when a token names an unknown key,
+// so key rotation at the issuer needs no restart.
+type KeySet struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*keySetEntry
+}
+
+// NewKeySet creates a key set that fetches keys with the given client. A TTL of zero uses
+// DefaultKeySetTTL.
+func NewKeySet(client *http.Client, ttl time.Duration) *KeySet {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if ttl <= 0 {
+		ttl = DefaultKeySetTTL
+	}
+	return &KeySet{client: client, ttl: ttl, entries: make(map[string]*keySetEntry)}
+}
+
+// Verify checks the signature of a token and returns its verified claims. trusted decides
+// whether keys of the token's issuer may be used at all. With jwksFile set, keys are read from
+// that file instead of the issuer, for offline tests and air-gapped installations. Expiry is
+// left to the caller.
+func (k *KeySet) Verify(ctx context.Context, token, jwksFile string, trusted func(issuer string) bool) ([]byte, error) {
+	parsed, err := jwt.ParseSigned(token, tokenAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if len(parsed.Headers) != 1 {
+		return nil, fmt.Errorf("%w: expected one signature", ErrInvalidSignature)
+	}
+
+	var unverified jwt.Claims
+	if err := parsed.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	issuer := strings.TrimSuffix(unverified.Issuer, "/")
+	if issuer == "" || !trusted(issuer) {
+		return nil, fmt.Errorf("%w: %q", ErrUntrustedIssuer, unverified.Issuer)
+	}
+
+	keyID := parsed.Headers[0].KeyID
+	key, err := k.key(ctx, issuer, jwksFile, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims json.RawMessage
+	if err := parsed.Claims(key, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return claims, nil
+}
+
+// Invalidate drops all cached key sets
+func (k *KeySet) Invalidate() {
+	k.mu.Lock()
+	k.entries = make(map[string]*keySetEntry)
+	k.mu.Unlock()
+}
+
+// key finds the public key with the given ID, fetching the key set when it is not cached,
+// expired, or lacks the key and was not fetched within the last minute
+func (k *KeySet) key(ctx context.Context, issuer, jwksFile, keyID string) (*jose.JSONWebKey, error) {
+	source := issuer
+	if jwksFile != "" {
+		source = "file:" + jwksFile
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	entry := k.entries[source]
+	if entry == nil || time.Since(entry.fetchedAt) > k.ttl {
+		if err := k.loadLocked(ctx, source, issuer, jwksFile); err != nil {
+			if entry == nil {
+				return nil, err
+			}
+			// Keep verifying with the expired keys while the issuer is unreachable
+			log.Printf("⚠️ Au10tix JWKS refresh failed, using keys from %s: %v", entry.fetchedAt.Format(time.RFC3339), err)
+		} else {
+			entry = k.entries[source]
+		}
+	}
+
+	key := findKey(entry.keys, keyID)
+	if key == nil && time.Since(entry.fetchedAt) > keySetRefetchInterval {
+		if err := k.loadLocked(ctx, source, issuer, jwksFile); err != nil {
+			return nil, err
+		}
+		key = findKey(k.entries[source].keys, keyID)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w (kid %q)", ErrUnknownSigningKey, keyID)
+	}
+	return key, nil
+}
+
+// loadLocked reads the key set from the file or the issuer; the caller holds k.mu
+func (k *KeySet) loadLocked(ctx context.Context, source, issuer, jwksFile string) error {
+	var data []byte
+	var err error
+	if jwksFile != "" {
+		data, err = os.ReadFile(jwksFile)
+		if err != nil {
+			return fmt.Errorf("failed to read Au10tix JWKS file: %w", err)
+		}
+	} else {
+		data, err = k.fetch(ctx, issuer)
+		if err != nil {
+			return err
+		}
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("failed to parse Au10tix JWKS from %s: %w", source, err)
+	}
+	k.entries[source] = &keySetEntry{keys: keys, fetchedAt: time.Now()}
+	return nil
+}
+
+// fetch downloads the key set published by the issuer
+func (k *KeySet) fetch(ctx context.Context, issuer string) ([]byte, error) {
+	jwksURI := discoverIssuer(ctx, k.client, issuer).JWKSURI
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Au10tix JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Au10tix JWKS: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Au10tix JWKS request to %s answered %d", jwksURI, resp.StatusCode)
+	}
+	return data, nil
+}
+
+// findKey returns the public signing key with the given ID. Tokens without a key ID are only
+// accepted from issuers that publish a single key.
+func findKey(keys jose.JSONWebKeySet, keyID string) *jose.JSONWebKey {
+	candidates := keys.Keys
+	if keyID != "" {
+		candidates = keys.Key(keyID)
+	} else if len(candidates) != 1 {
+		return nil
+	}
+	for _, key := range candidates {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		public := key.Public()
+		if !public.Valid() {
+			continue
+		}
+		return &public
+	}
+	return nil
+}
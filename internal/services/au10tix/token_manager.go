@@ -0,0 +1,434 @@
+// File: internal/services/au10tix/token_manager.go
+// Au10tix access tokens obtained with the OAuth client-credentials flow
+
+package au10tix
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// DefaultScope is requested when the credentials name no scopes
+const DefaultScope = "workflow:api"
+
+// ClientCredentials identify the portal to the Au10tix authorization server. Exactly one of
+// ClientSecret and PrivateKey is used; a private key signs a client assertion
+// (private_key_jwt) and takes precedence over a secret.
+type ClientCredentials struct {
+	Issuer       string // Authorization server, the iss claim of Au10tix tokens
+	ClientID     string
+	ClientSecret string
+	PrivateKey   string   // PEM encoded RSA or EC key, or a private JWK
+	Scopes       []string // DefaultScope when empty
+}
+
+// AuthMethod names how the client authenticates at the token endpoint
+func (c ClientCredentials) AuthMethod() string {
+	if c.PrivateKey != "" {
+		return "private_key_jwt"
+	}
+	return "client_secret_basic"
+}
+
+// ClientCredentialsFunc returns the client credentials. It is called for every token request,
+// so credentials rotated in the secret providers are used for the next token.
+type ClientCredentialsFunc func(ctx context.Context) (ClientCredentials, error)
+
+const (
+	// tokenRefreshMargin renews tokens this long before they expire so requests in flight do not fail
+	tokenRefreshMargin = 5 * time.Minute
+	// tokenRetryInterval keeps broken credentials from hammering the authorization server
+	tokenRetryInterval = 10 * time.Second
+	// clientAssertionLifetime is the validity of a signed client assertion
+	clientAssertionLifetime = 5 * time.Minute
+	// defaultTokenLifetime is assumed for responses without expires_in or exp claim
+	defaultTokenLifetime = 30 * time.Minute
+)
+
+// TokenManager obtains Au10tix access tokens with the client-credentials grant and caches them
+// until shortly before they expire. Token requests are serialized, so concurrent verifications
+// wait for a single request instead of each fetching a token.
+type TokenManager struct {
+	credentials ClientCredentialsFunc
+	client      *http.Client
+
+	mu            sync.Mutex
+	token         string
+	expiresAt     time.Time
+	issuer        string
+	tokenEndpoint string
+	authMethod    string
+	scope         string
+	lastIssuedAt  time.Time
+	lastError     string
+	lastErrorAt   time.Time
+	issueCount    int
+	renewCount    int
+	failures      int
+}
+
+// NewTokenManager creates a manager that requests tokens with the given HTTP client; nil uses
+// a client with a 30 second timeout
+func NewTokenManager(credentials ClientCredentialsFunc, client *http.Client) *TokenManager {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &TokenManager{credentials: credentials, client: client}
+}
+
+// Token returns a valid access token, requesting one when there is none yet or the current
+// one is about to expire
+func (m *TokenManager) Token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.validLocked() {
+		return m.token, nil
+	}
+	if err := m.requestLocked(ctx); err != nil {
+		return "", err
+	}
+	return m.token, nil
+}
+
+// Refresh replaces a token that Au10tix rejected. When another request already renewed it the
+// newer token is returned without asking the authorization server again.
+func (m *TokenManager) Refresh(ctx context.Context, rejected string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != rejected && m.validLocked() {
+		return m.token, nil
+	}
+
+	log.Printf("🔄 Au10tix access token rejected, requesting a new one")
+	m.renewCount++
+	m.token = ""
+	if err := m.requestLocked(ctx); err != nil {
+		return "", err
+	}
+	return m.token, nil
+}
+
+// Invalidate drops the cached token and token endpoint so the next request starts over, for
+// example after the client credentials were changed
+func (m *TokenManager) Invalidate() {
+	m.mu.Lock()
+	m.token = ""
+	m.expiresAt = time.Time{}
+	m.tokenEndpoint = ""
+	m.lastErrorAt = time.Time{}
+	m.mu.Unlock()
+}
+
+// Status reports the state of the cached token without revealing it
+func (m *TokenManager) Status() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := map[string]interface{}{
+		"valid":                m.validLocked(),
+		"issuer":               m.issuer,
+		"token_endpoint":       m.tokenEndpoint,
+		"auth_method":          m.authMethod,
+		"scope":                m.scope,
+		"issue_count":          m.issueCount,
+		"renew_count":          m.renewCount,
+		"consecutive_failures": m.failures,
+		"timestamp":            time.Now().Unix(),
+	}
+
+	if m.validLocked() {
+		status["status"] = "active"
+		status["token_expires_at"] = m.expiresAt.Unix()
+		status["refresh_at"] = m.expiresAt.Add(-tokenRefreshMargin).Unix()
+	} else {
+		status["status"] = "no_token"
+	}
+	if !m.lastIssuedAt.IsZero() {
+		status["last_issued_at"] = m.lastIssuedAt.Unix()
+	}
+	if m.lastError != "" {
+		status["last_error"] = m.lastError
+		status["last_error_at"] = m.lastErrorAt.Unix()
+	}
+
+	return status
+}
+
+// validLocked reports whether the current token can still be used
+func (m *TokenManager) validLocked() bool {
+	return m.token != "" && time.Now().Add(tokenRefreshMargin).Before(m.expiresAt)
+}
+
+// requestLocked fetches a new token; the caller holds m.mu
+func (m *TokenManager) requestLocked(ctx context.Context) error {
+	if m.failures > 0 && time.Since(m.lastErrorAt) < tokenRetryInterval {
+		return fmt.Errorf("Au10tix token request failed recently: %s", m.lastError)
+	}
+
+	credentials, err := m.credentials(ctx)
+	if err != nil {
+		// Missing credentials are a configuration problem rather than an issuer failure
+		return err
+	}
+	if credentials.ClientID == "" {
+		return errors.New("Au10tix client ID is not configured")
+	}
+	if credentials.ClientSecret == "" && credentials.PrivateKey == "" {
+		return errors.New("Au10tix client secret or private key is not configured")
+	}
+	if credentials.Issuer == "" {
+		return errors.New("Au10tix token issuer is not configured")
+	}
+
+	scope := strings.Join(credentials.Scopes, " ")
+	if scope == "" {
+		scope = DefaultScope
+	}
+	issuer := strings.TrimSuffix(credentials.Issuer, "/")
+	m.issuer = issuer
+	m.authMethod = credentials.AuthMethod()
+	m.scope = scope
+
+	token, expiresAt, err := m.fetchLocked(ctx, issuer, credentials, scope)
+	if err != nil {
+		m.failures++
+		m.lastError = err.Error()
+		m.lastErrorAt = time.Now()
+		log.Printf("❌ Au10tix token request failed (%d in a row): %v", m.failures, err)
+		return err
+	}
+
+	m.token = token
+	m.expiresAt = expiresAt
+	m.lastIssuedAt = time.Now()
+	m.issueCount++
+	m.failures = 0
+	log.Printf("✅ Au10tix access token issued by %s, valid until %s", issuer, expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// tokenResponse is the body of a successful token request
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// fetchLocked performs the client-credentials grant against the issuer's token endpoint
+func (m *TokenManager) fetchLocked(ctx context.Context, issuer string, credentials ClientCredentials, scope string) (string, time.Time, error) {
+	if m.tokenEndpoint == "" {
+		m.tokenEndpoint = discoverIssuer(ctx, m.client, issuer).TokenEndpoint
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", scope)
+
+	if credentials.PrivateKey != "" {
+		assertion, err := clientAssertion(credentials, m.tokenEndpoint)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		form.Set("client_id", credentials.ClientID)
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", assertion)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "SelfServicePortal/1.0")
+	if credentials.PrivateKey == "" {
+		req.SetBasicAuth(url.QueryEscape(credentials.ClientID), url.QueryEscape(credentials.ClientSecret))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token endpoint answered %d: %s", resp.StatusCode, oauthError(body))
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("token endpoint returned no access token")
+	}
+
+	fallback := time.Now().Add(defaultTokenLifetime)
+	if token.ExpiresIn > 0 {
+		fallback = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token.AccessToken, tokenExpiry(token.AccessToken, fallback), nil
+}
+
+// oauthError extracts the error description of a failed token request
+func oauthError(body []byte) string {
+	var failure struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if json.Unmarshal(body, &failure) == nil && failure.Error != "" {
+		if failure.Description != "" {
+			return failure.Error + " - " + failure.Description
+		}
+		return failure.Error
+	}
+	if len(body) > 200 {
+		body = body[:200]
+	}
+	return string(body)
+}
+
+// clientAssertion signs the private_key_jwt assertion for the token endpoint
+func clientAssertion(credentials ClientCredentials, audience string) (string, error) {
+	key, err := parsePrivateKey(credentials.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	options := (&jose.SignerOptions{}).WithType("JWT")
+	if key.KeyID != "" {
+		options = options.WithHeader("kid", key.KeyID)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: signingAlgorithm(key), Key: key.Key}, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to create client assertion signer: %w", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate client assertion ID: %w", err)
+	}
+	now := time.Now()
+	claims := jwt.Claims{
+		Issuer:    credentials.ClientID,
+		Subject:   credentials.ClientID,
+		Audience:  jwt.Audience{audience},
+		ID:        hex.EncodeToString(id),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Expiry:    jwt.NewNumericDate(now.Add(clientAssertionLifetime)),
+	}
+
+	assertion, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		return "", fmt.Errorf("failed to sign client assertion: %w", err)
+	}
+	return assertion, nil
+}
+
+// signingAlgorithm picks the algorithm named by a JWK, otherwise RS256 for RSA keys and the
+// ECDSA algorithm matching the curve of EC keys
+func signingAlgorithm(key *jose.JSONWebKey) jose.SignatureAlgorithm {
+	if key.Algorithm != "" {
+		return jose.SignatureAlgorithm(key.Algorithm)
+	}
+	if ecKey, ok := key.Key.(*ecdsa.PrivateKey); ok {
+		switch ecKey.Curve.Params().BitSize {
+		case 384:
+			return jose.ES384
+		case 521:
+			return jose.ES512
+		}
+		return jose.ES256
+	}
+	return jose.RS256
+}
+
+// parsePrivateKey reads a PEM encoded PKCS#8, PKCS#1 or SEC 1 key, or a private JWK
+func parsePrivateKey(value string) (*jose.JSONWebKey, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") {
+		var key jose.JSONWebKey
+		if err := key.UnmarshalJSON([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid Au10tix private key JWK: %w", err)
+		}
+		if key.IsPublic() {
+			return nil, errors.New("Au10tix private key JWK holds a public key")
+		}
+		return &key, nil
+	}
+
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("Au10tix private key is neither PEM nor a JWK")
+	}
+
+	var key crypto.Signer
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported Au10tix private key type")
+		}
+		key = signer
+	} else if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = rsaKey
+	} else if ecKey, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		key = ecKey
+	} else {
+		return nil, fmt.Errorf("invalid Au10tix private key: %w", err)
+	}
+
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		return nil, errors.New("Au10tix private key must be RSA or EC")
+	}
+	return &jose.JSONWebKey{Key: key}, nil
+}
+
+// tokenExpiry reads the exp claim of a JWT access token. The signature is not checked; the
+// value only decides when to renew, Au10tix remains the judge of whether the token is valid.
+func tokenExpiry(token string, fallback time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fallback
+	}
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return fallback
+	}
+	return time.Unix(claims.ExpiresAt, 0)
+}
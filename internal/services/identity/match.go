@@ -0,0 +1,231 @@
+// File: internal/services/identity/match.go - Fuzzy identity matching between directory and document data
+package identity
+
+import (
+	"strings"
+)
+
+// Reason codes reported by Match
+const (
+	ReasonDocumentNameMissing = "DOCUMENT_NAME_MISSING"
+	ReasonNameMismatch        = "NAME_MISMATCH"
+	ReasonEmailMismatch       = "EMAIL_MISMATCH"
+	ReasonDateOfBirthMismatch = "DOB_MISMATCH"
+	ReasonDateOfBirthMissing  = "DOB_MISSING"
+)
+
+// Component weights; components that cannot be compared are left out of the weighted score
+const (
+	weightDocumentName = 0.5
+	weightClaimedName  = 0.2
+	weightEmail        = 0.1
+	weightDateOfBirth  = 0.2
+)
+
+// nameMismatchScore is the similarity below which a name comparison is reported as a mismatch
+const nameMismatchScore = 0.8
+
+// Person holds the identity attributes compared by Match
+type Person struct {
+	FirstName   string `json:"first_name,omitempty"`
+	LastName    string `json:"last_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+}
+
+// Options configures Match
+type Options struct {
+	RequireDateOfBirth bool
+}
+
+// Component is the score of a single compared attribute
+type Component struct {
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Weight float64 `json:"weight"`
+}
+
+// Result is the outcome of comparing a directory user with verified identity data
+type Result struct {
+	Score      float64     `json:"score"`
+	Components []Component `json:"components"`
+	Reasons    []string    `json:"reasons,omitempty"`
+	HardFail   bool        `json:"hard_fail"` // Set when a check failed that no score can compensate for
+}
+
+// Match compares the directory user with the names and date of birth extracted from the
+// identity document and with the data the user entered when starting verification.
+// A document without a name scores zero, since the entered data alone proves nothing.
+func Match(directory, document, claimed Person, opts Options) Result {
+	var result Result
+	addComponent := func(name string, score, weight float64) {
+		result.Components = append(result.Components, Component{Name: name, Score: score, Weight: weight})
+	}
+
+	if document.FirstName == "" && document.LastName == "" {
+		result.Reasons = append(result.Reasons, ReasonDocumentNameMissing)
+		addComponent("document_name", 0, weightDocumentName)
+	} else {
+		score := NameSimilarity(document.FirstName, document.LastName, directory.FirstName, directory.LastName)
+		if score < nameMismatchScore {
+			result.Reasons = append(result.Reasons, ReasonNameMismatch)
+		}
+		addComponent("document_name", score, weightDocumentName)
+	}
+
+	if claimed.FirstName != "" || claimed.LastName != "" {
+		addComponent("claimed_name", NameSimilarity(claimed.FirstName, claimed.LastName, directory.FirstName, directory.LastName), weightClaimedName)
+	}
+
+	if claimed.Email != "" && directory.Email != "" {
+		score := 0.0
+		if strings.EqualFold(strings.TrimSpace(claimed.Email), strings.TrimSpace(directory.Email)) {
+			score = 1
+		} else {
+			result.Reasons = append(result.Reasons, ReasonEmailMismatch)
+		}
+		addComponent("email", score, weightEmail)
+	}
+
+	documentDOB, documentOK := ParseDate(document.DateOfBirth)
+	claimedDOB, claimedOK := ParseDate(claimed.DateOfBirth)
+	directoryDOB, directoryOK := ParseDate(directory.DateOfBirth)
+	switch {
+	case documentOK && (claimedOK || directoryOK):
+		score := 1.0
+		if (claimedOK && !documentDOB.Equal(claimedDOB)) || (directoryOK && !documentDOB.Equal(directoryDOB)) {
+			score = 0
+			result.HardFail = true
+			result.Reasons = append(result.Reasons, ReasonDateOfBirthMismatch)
+		}
+		addComponent("date_of_birth", score, weightDateOfBirth)
+	case opts.RequireDateOfBirth:
+		result.HardFail = true
+		result.Reasons = append(result.Reasons, ReasonDateOfBirthMissing)
+		addComponent("date_of_birth", 0, weightDateOfBirth)
+	}
+
+	var total, weights float64
+	for _, component := range result.Components {
+		total += component.Score * component.Weight
+		weights += component.Weight
+	}
+	if weights > 0 {
+		result.Score = total / weights
+	}
+	return result
+}
+
+// NameSimilarity returns a 0..1 similarity of two first/last name pairs. It tolerates
+// diacritics, transliteration, extra middle names, initials and swapped name order.
+func NameSimilarity(firstA, lastA, firstB, lastB string) float64 {
+	firstTokensA, lastTokensA := NormalizeName(firstA), NormalizeName(lastA)
+	firstTokensB, lastTokensB := NormalizeName(firstB), NormalizeName(lastB)
+
+	structured := weightedNames(firstTokensA, lastTokensA, firstTokensB, lastTokensB)
+	swapped := weightedNames(firstTokensA, lastTokensA, lastTokensB, firstTokensB) * 0.95
+
+	allA := append(append([]string{}, firstTokensA...), lastTokensA...)
+	allB := append(append([]string{}, firstTokensB...), lastTokensB...)
+	combined := tokenSetSimilarity(allA, allB) * 0.95
+
+	return max(structured, swapped, combined)
+}
+
+// weightedNames weights the last name higher, as given names are more often abbreviated
+func weightedNames(firstA, lastA, firstB, lastB []string) float64 {
+	if len(firstA) == 0 || len(firstB) == 0 {
+		return tokenSetSimilarity(lastA, lastB)
+	}
+	return 0.4*tokenSetSimilarity(firstA, firstB) + 0.6*tokenSetSimilarity(lastA, lastB)
+}
+
+// tokenSetSimilarity matches every token of the shorter name against its best counterpart in
+// the longer one, so that middle names present on only one side do not lower the score
+func tokenSetSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	// Concatenated comparison covers names split differently, e.g. "Mary Jane" and "Maryjane"
+	joined := jaroWinkler(strings.Join(a, ""), strings.Join(b, ""))
+
+	var total float64
+	for _, token := range a {
+		var best float64
+		for _, candidate := range b {
+			best = max(best, tokenSimilarity(token, candidate))
+		}
+		total += best
+	}
+	return max(total/float64(len(a)), joined)
+}
+
+// umlautFolder folds the ae/oe/ue spellings of German umlauts, which NormalizeName reduces to a, o, u
+var umlautFolder = strings.NewReplacer("ae", "a", "oe", "o", "ue", "u")
+
+// tokenSimilarity compares two name tokens, treating a single letter as an initial
+func tokenSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if (len(a) == 1 && strings.HasPrefix(b, a)) || (len(b) == 1 && strings.HasPrefix(a, b)) {
+		return 0.9
+	}
+	return max(jaroWinkler(a, b), jaroWinkler(umlautFolder.Replace(a), umlautFolder.Replace(b)))
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings
+func jaroWinkler(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(max(len(ra), len(rb))/2-1, 0)
+
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		start, end := max(0, i-window), min(len(rb), i+window+1)
+		for j := start; j < end; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,81 @@
+// File: internal/services/identity/normalize.go - Name and date normalization for identity matching
+package identity
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// transliterations covers letters that do not decompose into a Latin base letter
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i",
+	'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s",
+	'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+// NormalizeName lowercases, strips diacritics, transliterates to Latin and splits a name into tokens
+func NormalizeName(name string) []string {
+	decomposed, _, err := transform.String(transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+	if err != nil {
+		decomposed = name
+	}
+
+	var builder strings.Builder
+	for _, r := range strings.ToLower(decomposed) {
+		if latin, ok := transliterations[r]; ok {
+			builder.WriteString(latin)
+			continue
+		}
+		if r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			builder.WriteRune(r)
+			continue
+		}
+		// Hyphens, apostrophes, dots and anything unknown separate tokens
+		builder.WriteRune(' ')
+	}
+	return strings.Fields(builder.String())
+}
+
+// dateLayouts are the date formats seen in directory data, documents and the start form
+var dateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006/01/02",
+	"02.01.2006",
+	"20060102",
+	"02 Jan 2006",
+	"January 2, 2006",
+}
+
+// ParseDate parses a date of birth in any of the supported layouts
+func ParseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	// Timestamps with a time part after a date prefix
+	if len(value) > len("2006-01-02") {
+		if parsed, err := time.Parse("2006-01-02", value[:len("2006-01-02")]); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,258 @@
+// File: internal/services/onfido/client.go
+// Onfido API client: applicants, Studio workflow runs and webhook signatures
+
+package onfido
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the Onfido API of the EU region; US and CA accounts use api.us.onfido.com
+// and api.ca.onfido.com
+const DefaultBaseURL = "https://api.eu.onfido.com"
+
+// APIVersion is the API version the client speaks
+const APIVersion = "v3.6"
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the raw webhook body, keyed with the
+// webhook token
+const SignatureHeader = "X-SHA2-Signature"
+
+// Workflow run statuses
+const (
+	StatusAwaitingInput = "awaiting_input"
+	StatusProcessing    = "processing"
+	StatusApproved      = "approved"
+	StatusDeclined      = "declined"
+	StatusReview        = "review"
+	StatusAbandoned     = "abandoned"
+	StatusError         = "error"
+)
+
+// maxResponseSize limits the size of API responses read into memory
+const maxResponseSize = 4 << 20
+
+// ErrInvalidWebhook is returned by ParseWebhook for bodies that are not Onfido events
+var ErrInvalidWebhook = errors.New("invalid Onfido webhook payload")
+
+// Client talks to the Onfido API with an API token
+type Client struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewClient creates a client for the given API base URL and API token
+func NewClient(baseURL, token string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// APIError describes a non-successful Onfido response
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("Onfido API error (status: %d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Onfido API error (status: %d, %s): %s", e.StatusCode, e.Type, e.Message)
+}
+
+// Applicant is the person a workflow run verifies
+type Applicant struct {
+	ID        string `json:"id,omitempty"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email,omitempty"`
+	DOB       string `json:"dob,omitempty"` // YYYY-MM-DD
+}
+
+// WorkflowRunLink configures the hosted link of a workflow run
+type WorkflowRunLink struct {
+	URL                  string `json:"url,omitempty"`
+	CompletedRedirectURL string `json:"completed_redirect_url,omitempty"`
+	ExpiredRedirectURL   string `json:"expired_redirect_url,omitempty"`
+}
+
+// WorkflowRunRequest is the body of a workflow run creation request
+type WorkflowRunRequest struct {
+	WorkflowID  string                 `json:"workflow_id"`
+	ApplicantID string                 `json:"applicant_id"`
+	Link        *WorkflowRunLink       `json:"link,omitempty"`
+	CustomData  map[string]interface{} `json:"custom_data,omitempty"`
+}
+
+// WorkflowRun is a Studio workflow run: the capture link, the status and, once finished, the
+// outputs the workflow was configured to return
+type WorkflowRun struct {
+	ID          string                 `json:"id"`
+	WorkflowID  string                 `json:"workflow_id"`
+	ApplicantID string                 `json:"applicant_id"`
+	Status      string                 `json:"status"`
+	Reasons     []string               `json:"reasons,omitempty"`
+	Output      map[string]interface{} `json:"output,omitempty"`
+	Link        WorkflowRunLink        `json:"link"`
+	Raw         map[string]interface{} `json:"-"`
+}
+
+// Finished reports whether the run reached a final status
+func (r *WorkflowRun) Finished() bool {
+	switch r.Status {
+	case StatusApproved, StatusDeclined, StatusReview, StatusAbandoned, StatusError:
+		return true
+	}
+	return false
+}
+
+// CreateApplicant creates the applicant a workflow run is started for
+func (c *Client) CreateApplicant(ctx context.Context, applicant Applicant) (*Applicant, error) {
+	var created Applicant
+	if err := c.do(ctx, http.MethodPost, "/applicants", applicant, &created, nil); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// CreateWorkflowRun starts a workflow for an applicant and returns the run with its capture link
+func (c *Client) CreateWorkflowRun(ctx context.Context, request WorkflowRunRequest) (*WorkflowRun, error) {
+	var run WorkflowRun
+	if err := c.do(ctx, http.MethodPost, "/workflow_runs", request, &run, &run.Raw); err != nil {
+		return nil, err
+	}
+	log.Printf("Onfido Client: Created workflow run %s (status: %s)", run.ID, run.Status)
+	return &run, nil
+}
+
+// GetWorkflowRun returns the current state of a workflow run
+func (c *Client) GetWorkflowRun(ctx context.Context, runID string) (*WorkflowRun, error) {
+	var run WorkflowRun
+	if err := c.do(ctx, http.MethodGet, "/workflow_runs/"+url.PathEscape(runID), nil, &run, &run.Raw); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// do sends a request and decodes the response into out, and into raw when given
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}, raw *map[string]interface{}) error {
+	if c.Token == "" {
+		return errors.New("Onfido API token is not configured")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Onfido request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/"+APIVersion+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create Onfido request: %w", err)
+	}
+	req.Header.Set("Authorization", "Token token="+c.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Onfido request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read Onfido response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError(resp.StatusCode, data)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse Onfido response: %w", err)
+	}
+	if raw != nil {
+		if err := json.Unmarshal(data, raw); err != nil {
+			return fmt.Errorf("failed to parse Onfido response: %w", err)
+		}
+	}
+	return nil
+}
+
+// apiError decodes Onfido's error object, falling back to the raw body
+func apiError(status int, body []byte) *APIError {
+	var decoded struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &decoded); err == nil && decoded.Error.Message != "" {
+		return &APIError{StatusCode: status, Type: decoded.Error.Type, Message: decoded.Error.Message}
+	}
+	return &APIError{StatusCode: status, Message: strings.TrimSpace(string(body))}
+}
+
+// WebhookEvent is the body Onfido posts to a webhook
+type WebhookEvent struct {
+	Payload struct {
+		ResourceType string `json:"resource_type"`
+		Action       string `json:"action"`
+		Object       struct {
+			ID          string `json:"id"`
+			Status      string `json:"status"`
+			CompletedAt string `json:"completed_at_iso8601"`
+			Href        string `json:"href"`
+		} `json:"object"`
+	} `json:"payload"`
+}
+
+// VerifySignature checks the signature header against the HMAC of body in constant time
+func VerifySignature(token string, body []byte, signature string) bool {
+	provided, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(provided) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(body)
+	return hmac.Equal(provided, mac.Sum(nil))
+}
+
+// ParseWebhook decodes a webhook body whose signature has been verified
+func ParseWebhook(body []byte) (*WebhookEvent, error) {
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	if event.Payload.ResourceType == "" || event.Payload.Object.ID == "" {
+		return nil, fmt.Errorf("%w: no resource", ErrInvalidWebhook)
+	}
+	return &event, nil
+}
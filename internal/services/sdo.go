@@ -5,6 +5,7 @@ package services
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -36,14 +37,51 @@ type SDOAuthResponse struct {
 }
 
 type SDOUser struct {
-	ID             json.Number `json:"id"`
-	DisplayName    string      `json:"displayName"`
-	Username       string      `json:"username"`
-	Email          string      `json:"email"`
-	FirstName      string      `json:"firstName"`
-	LastName       string      `json:"lastName"`
-	DirectoryName  string      `json:"directoryName"`
-	OrganizationID string      `json:"organizationId"`
+	ID             json.Number   `json:"id"`
+	DisplayName    string        `json:"displayName"`
+	Username       string        `json:"username"`
+	Email          string        `json:"email"`
+	FirstName      string        `json:"firstName"`
+	LastName       string        `json:"lastName"`
+	DirectoryName  string        `json:"directoryName"`
+	OrganizationID string        `json:"organizationId"`
+	Groups         SDOGroupNames `json:"groups,omitempty"`
+}
+
+// SDOGroupNames holds the names of the groups a user belongs to. SDO lists groups either as
+// names or as objects with a name, depending on the version.
+type SDOGroupNames []string
+
+func (g *SDOGroupNames) UnmarshalJSON(data []byte) error {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		// Ignore shapes this portal does not know rather than failing the user lookup
+		*g = nil
+		return nil
+	}
+
+	names := make(SDOGroupNames, 0, len(entries))
+	for _, entry := range entries {
+		var name string
+		if err := json.Unmarshal(entry, &name); err != nil {
+			var group struct {
+				Name        string `json:"name"`
+				DisplayName string `json:"displayName"`
+			}
+			if err := json.Unmarshal(entry, &group); err != nil {
+				continue
+			}
+			name = group.Name
+			if name == "" {
+				name = group.DisplayName
+			}
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	*g = names
+	return nil
 }
 
 type SDOSearchResponse struct {
@@ -129,11 +167,24 @@ type SDOErrorResponse struct {
 	Status  int         `json:"status,omitempty"`
 }
 
+// sdoTransport carries every SDO API call. It verifies certificates against the system roots and
+// refuses anything older than TLS 1.2.
+var sdoTransport = newSDOTransport()
+
+func newSDOTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	return transport
+}
+
+// NewSDOHTTPClient returns a client for SDO API calls with the given timeout
+func NewSDOHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: sdoTransport}
+}
+
 func NewSDOService() *SDOService {
 	return &SDOService{
-		Client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		Client: NewSDOHTTPClient(30 * time.Second),
 	}
 }
 
@@ -142,9 +193,7 @@ func NewSDOServiceWithAuth(baseURL, token string) *SDOService {
 	return &SDOService{
 		BaseURL: baseURL,
 		Token:   token,
-		Client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		Client:  NewSDOHTTPClient(30 * time.Second),
 	}
 }
 
@@ -212,8 +261,6 @@ func (s *SDOService) Authenticate(baseURL, email, password string) (*SDOAuthResp
 		return nil, fmt.Errorf("failed to marshal auth request: %v", err)
 	}
 
-	log.Printf("SDO Service: Request payload: %s", string(jsonData))
-
 	req, err := http.NewRequest("POST", authURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create auth request: %v", err)
@@ -242,7 +289,10 @@ func (s *SDOService) Authenticate(baseURL, email, password string) (*SDOAuthResp
 		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	log.Printf("SDO Service: Response body (first 500 chars): %s", string(body)[:min(len(string(body)), 500)])
+	// Successful responses carry the bearer token, so only failures are logged in full
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("SDO Service: Response body (first 500 chars): %s", string(body)[:min(len(string(body)), 500)])
+	}
 	log.Printf("SDO Service: Response Content-Type: %s", resp.Header.Get("Content-Type"))
 
 	// Check if response is HTML instead of JSON
@@ -367,6 +417,55 @@ func (s *SDOService) SearchUsers(query string, pageSize int) (*SDOSearchResponse
 	return &searchResp, nil
 }
 
+// GetUser retrieves a single directory user by ID
+func (s *SDOService) GetUser(userID string) (*SDOUser, error) {
+	if s.Token == "" {
+		return nil, fmt.Errorf("not authenticated with SDO")
+	}
+
+	userURL := s.BaseURL + "/api/users/" + url.PathEscape(userID)
+	log.Printf("SDO Service: Fetching user %s", userID)
+
+	req, err := http.NewRequest("GET", userURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("user request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user response: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("authentication expired, please re-authenticate")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user lookup failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Some SDO versions wrap the user in a "user" object
+	var wrapped struct {
+		User *SDOUser `json:"user"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err == nil && wrapped.User != nil {
+		return wrapped.User, nil
+	}
+
+	var user SDOUser
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, fmt.Errorf("failed to parse user response: %v", err)
+	}
+	return &user, nil
+}
+
 // SendInvitation sends an invitation to a user
 func (s *SDOService) SendInvitation(userID, invitationType string) (*SDOInvitationDetails, error) {
 	// Use the correct API endpoint as specified by the user
@@ -384,8 +483,6 @@ func (s *SDOService) SendInvitation(userID, invitationType string) (*SDOInvitati
 
 	log.Printf("SDO Service: Sending invitation to user %s with type %s", userID, invitationType)
 	log.Printf("SDO Service: Request URL: %s", inviteURL)
-	log.Printf("SDO Service: Request payload: %s", string(jsonData))
-
 	req, err := http.NewRequest("POST", inviteURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create invitation request: %v", err)
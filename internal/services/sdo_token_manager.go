@@ -0,0 +1,269 @@
+// File: internal/services/sdo_token_manager.go - Shared, self-refreshing SDO session for the portal service account
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SDOServiceAccount is the SDO login the portal uses on behalf of its visitors
+type SDOServiceAccount struct {
+	URL      string
+	Email    string
+	Password string
+}
+
+// SDOServiceAccountFunc returns the service account. It is called for every authentication,
+// so credentials rotated in the secret providers are picked up on the next sign-in.
+type SDOServiceAccountFunc func(ctx context.Context) (SDOServiceAccount, error)
+
+// DefaultSDOTokenLifetime is assumed for tokens that do not carry an exp claim
+const DefaultSDOTokenLifetime = 30 * time.Minute
+
+const (
+	// sdoTokenRefreshMargin renews tokens shortly before they expire so requests in flight do not fail
+	sdoTokenRefreshMargin = time.Minute
+	// sdoAuthRetryInterval keeps a broken service account from hammering SDO with logins
+	sdoAuthRetryInterval = 5 * time.Second
+)
+
+// SDOTokenManager holds one SDO bearer token for the service account and shares it between all
+// sessions. Authentication is serialized, so concurrent requests wait for a single login instead
+// of each signing in. Requests sent through Client() carry the current token and are retried once
+// with a fresh token when SDO answers 401.
+type SDOTokenManager struct {
+	account  SDOServiceAccountFunc
+	lifetime time.Duration
+
+	mu          sync.Mutex
+	baseURL     string
+	token       string
+	expiresAt   time.Time
+	lastAuthAt  time.Time
+	lastError   string
+	lastErrorAt time.Time
+	authCount   int
+	reauthCount int
+	failures    int
+}
+
+// NewSDOTokenManager creates a manager for the service account. A lifetime of zero uses DefaultSDOTokenLifetime.
+func NewSDOTokenManager(account SDOServiceAccountFunc, lifetime time.Duration) *SDOTokenManager {
+	if lifetime <= 0 {
+		lifetime = DefaultSDOTokenLifetime
+	}
+	return &SDOTokenManager{account: account, lifetime: lifetime}
+}
+
+// Token returns the SDO base URL and a valid bearer token, signing in when there is no token yet
+// or the current one is about to expire
+func (m *SDOTokenManager) Token(ctx context.Context) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.validLocked() {
+		return m.baseURL, m.token, nil
+	}
+	if err := m.authenticateLocked(ctx); err != nil {
+		return "", "", err
+	}
+	return m.baseURL, m.token, nil
+}
+
+// Refresh replaces a token that SDO rejected. When another request already renewed it the
+// newer token is returned without signing in again.
+func (m *SDOTokenManager) Refresh(ctx context.Context, rejected string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != rejected && m.validLocked() {
+		return m.baseURL, m.token, nil
+	}
+
+	log.Printf("🔄 SDO service token rejected, re-authenticating")
+	m.reauthCount++
+	m.token = ""
+	if err := m.authenticateLocked(ctx); err != nil {
+		return "", "", err
+	}
+	return m.baseURL, m.token, nil
+}
+
+// Invalidate drops the current token so the next request signs in again, for example after the
+// service account credentials were changed
+func (m *SDOTokenManager) Invalidate() {
+	m.mu.Lock()
+	m.token = ""
+	m.expiresAt = time.Time{}
+	m.lastErrorAt = time.Time{}
+	m.mu.Unlock()
+}
+
+// Service returns an SDOService bound to the shared token whose requests refresh it on 401
+func (m *SDOTokenManager) Service(ctx context.Context) (*SDOService, error) {
+	baseURL, token, err := m.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &SDOService{BaseURL: baseURL, Token: token, Client: m.Client(30 * time.Second)}, nil
+}
+
+// Client returns an HTTP client that sends the shared token with every request and retries
+// once after re-authenticating when SDO answers 401
+func (m *SDOTokenManager) Client(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &sdoTokenTransport{manager: m, base: sdoTransport},
+	}
+}
+
+// GetConnectionStatus reports the health of the shared SDO session
+func (m *SDOTokenManager) GetConnectionStatus() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := map[string]interface{}{
+		"connected":            m.validLocked(),
+		"base_url":             m.baseURL,
+		"timestamp":            time.Now().Unix(),
+		"auth_count":           m.authCount,
+		"reauth_count":         m.reauthCount,
+		"consecutive_failures": m.failures,
+	}
+
+	if m.validLocked() {
+		status["status"] = "authenticated"
+		status["auth_status"] = "authenticated"
+		status["token_expires_at"] = m.expiresAt.Unix()
+	} else {
+		status["status"] = "not_authenticated"
+		status["auth_status"] = "unauthenticated"
+	}
+	if !m.lastAuthAt.IsZero() {
+		status["last_auth_at"] = m.lastAuthAt.Unix()
+	}
+	if m.lastError != "" {
+		status["last_error"] = m.lastError
+		status["last_error_at"] = m.lastErrorAt.Unix()
+	}
+
+	return status
+}
+
+// validLocked reports whether the current token can still be used
+func (m *SDOTokenManager) validLocked() bool {
+	return m.token != "" && time.Now().Add(sdoTokenRefreshMargin).Before(m.expiresAt)
+}
+
+// authenticateLocked signs in with the service account; the caller holds m.mu
+func (m *SDOTokenManager) authenticateLocked(ctx context.Context) error {
+	if m.failures > 0 && time.Since(m.lastErrorAt) < sdoAuthRetryInterval {
+		return fmt.Errorf("SDO authentication failed recently: %s", m.lastError)
+	}
+
+	account, err := m.account(ctx)
+	if err != nil {
+		// Missing credentials are a configuration problem rather than an SDO failure
+		return err
+	}
+
+	service := NewSDOService()
+	authResp, err := service.Authenticate(account.URL, account.Email, account.Password)
+	if err == nil && authResp.Token == "" {
+		err = errors.New("SDO returned no token")
+	}
+	if err != nil {
+		m.failures++
+		m.lastError = err.Error()
+		m.lastErrorAt = time.Now()
+		log.Printf("❌ SDO service account authentication failed (%d in a row): %v", m.failures, err)
+		return err
+	}
+
+	now := time.Now()
+	m.baseURL = service.BaseURL
+	m.token = authResp.Token
+	m.expiresAt = sdoTokenExpiry(authResp.Token, now.Add(m.lifetime))
+	m.lastAuthAt = now
+	m.authCount++
+	m.failures = 0
+	log.Printf("✅ SDO service account authenticated, token valid until %s", m.expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// sdoTokenExpiry reads the exp claim of a JWT bearer token. The signature is not checked; the
+// value only decides when to renew, SDO remains the judge of whether the token is valid.
+func sdoTokenExpiry(token string, fallback time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fallback
+	}
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return fallback
+	}
+	return time.Unix(claims.ExpiresAt, 0)
+}
+
+// sdoTokenTransport applies the shared token to outgoing requests and renews it on 401
+type sdoTokenTransport struct {
+	manager *SDOTokenManager
+	base    http.RoundTripper
+}
+
+func (t *sdoTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, token, err := t.manager.Token(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("SDO service account unavailable: %w", err)
+	}
+
+	resp, err := t.base.RoundTrip(withBearer(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The body must be replayable to retry; requests built from bytes buffers and readers are
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	_, fresh, refreshErr := t.manager.Refresh(req.Context(), token)
+	if refreshErr != nil {
+		log.Printf("❌ SDO token refresh failed, returning original 401: %v", refreshErr)
+		return resp, nil
+	}
+
+	retry := withBearer(req, fresh)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	resp.Body.Close()
+
+	log.Printf("🔁 Retrying %s %s with renewed SDO token", req.Method, req.URL.Path)
+	return t.base.RoundTrip(retry)
+}
+
+// withBearer copies the request with the given bearer token, as RoundTrippers must not modify their input
+func withBearer(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
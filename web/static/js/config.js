@@ -8,6 +8,9 @@ const config = {
     theme: 'light'
 };
 
+// Stored secrets come back from the server masked; sending the mask back keeps them unchanged
+const MASKED_SECRET = '********';
+
 $(document).ready(function() {
     // Toggle password visibility
     $('.toggle-password').click(function() {
@@ -300,7 +303,7 @@ $(document).ready(function() {
             showNotification('Settings saved successfully!', 'success');
 
             // Additional specific settings
-            if (section === 'auth' && data.au10tix_token) {
+            if (section === 'auth' && data.au10tix_token && data.au10tix_token !== MASKED_SECRET) {
                 localStorage.setItem('au10tixToken', data.au10tix_token);
             }
 
@@ -330,7 +333,7 @@ $(document).ready(function() {
                 toast.show();
 
                 // If saving auth settings, store the Au10tix token in localStorage
-                if (section === 'auth' && data.au10tix_token) {
+                if (section === 'auth' && data.au10tix_token && data.au10tix_token !== MASKED_SECRET) {
                     localStorage.setItem('au10tixToken', data.au10tix_token);
                 }
 
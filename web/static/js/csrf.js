@@ -0,0 +1,45 @@
+/* csrf.js - Sends the session's CSRF token with every state-changing request to the portal.
+ * Include after jQuery (when the page uses it):
+ *   <script src="/static/js/csrf.js" data-csrf-token="{{.csrfToken}}"></script>
+ */
+(function () {
+    const script = document.currentScript;
+    const token = script ? script.dataset.csrfToken : '';
+    if (!token) {
+        console.warn('CSRF token missing; state-changing requests will be rejected');
+        return;
+    }
+
+    const safeMethods = ['GET', 'HEAD', 'OPTIONS', 'TRACE'];
+
+    function needsToken(method, url) {
+        if (safeMethods.includes((method || 'GET').toUpperCase())) {
+            return false;
+        }
+        // Never hand the token to other sites
+        return new URL(url, window.location.href).origin === window.location.origin;
+    }
+
+    window.portalCSRFToken = token;
+
+    const originalFetch = window.fetch;
+    window.fetch = function (input, init) {
+        init = init || {};
+        const method = init.method || (input instanceof Request ? input.method : 'GET');
+        const url = input instanceof Request ? input.url : String(input);
+        if (needsToken(method, url)) {
+            const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+            headers.set('X-CSRF-Token', token);
+            init = Object.assign({}, init, { headers: headers });
+        }
+        return originalFetch.call(this, input, init);
+    };
+
+    if (window.jQuery) {
+        window.jQuery.ajaxPrefilter(function (options, originalOptions, xhr) {
+            if (needsToken(options.type, options.url)) {
+                xhr.setRequestHeader('X-CSRF-Token', token);
+            }
+        });
+    }
+})();
@@ -3785,7 +3785,8 @@ function enrollOctopus() {
         data: JSON.stringify({
             email: userData.email,
             userId: userData.id,
-            type: 'OCTOPUS'
+            type: 'OCTOPUS',
+            verificationId: typeof verificationSessionId !== 'undefined' ? verificationSessionId : null
         }),
         success: function(response) {
             console.log('OCTOPUS invitation response:', response);
@@ -3809,13 +3810,14 @@ function enrollOctopus() {
                 updateStep4ButtonText();
                 $('#step-4-next').prop('disabled', false);
             } else {
-                $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>Failed to send OCTOPUS invitation: ' + (response.octopus_error || 'No invitation ID received') + '</div>');
+                $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>Failed to send OCTOPUS invitation: ' + (response.error || response.octopus_error || 'No invitation ID received') + '</div>');
                 $('#step-4-next').prop('disabled', true);
             }
         },
         error: function(xhr) {
             console.error('OCTOPUS invitation error:', xhr);
-            $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>Server error sending OCTOPUS invitation.</div>');
+            const message = (xhr.responseJSON && xhr.responseJSON.error) || 'Server error sending OCTOPUS invitation.';
+            $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>' + $('<div>').text(message).html() + '</div>');
             $('#step-4-next').prop('disabled', true);
         }
     });
@@ -3833,7 +3835,8 @@ function enrollFIDO() {
         data: JSON.stringify({
             email: userData.email,
             userId: userData.id,
-            type: 'FIDO'
+            type: 'FIDO',
+            verificationId: typeof verificationSessionId !== 'undefined' ? verificationSessionId : null
         }),
         success: function(response) {
             console.log('FIDO invitation response:', response);
@@ -3863,13 +3866,14 @@ function enrollFIDO() {
                 updateStep4ButtonText();
                 $('#step-4-next').prop('disabled', false);
             } else {
-                $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>Failed to send FIDO invitation: ' + (response.fido_error || 'No invitation ID received') + '</div>');
+                $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>Failed to send FIDO invitation: ' + (response.error || response.fido_error || 'No invitation ID received') + '</div>');
                 $('#step-4-next').prop('disabled', true);
             }
         },
         error: function(xhr) {
             console.error('FIDO invitation error:', xhr);
-            $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>Server error sending FIDO invitation.</div>');
+            const message = (xhr.responseJSON && xhr.responseJSON.error) || 'Server error sending FIDO invitation.';
+            $('#step-4-alerts').html('<div class="alert alert-danger"><i class="bi bi-x-circle me-2"></i>' + $('<div>').text(message).html() + '</div>');
             $('#step-4-next').prop('disabled', true);
         }
     });